@@ -0,0 +1,125 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// mutatingOps are the operations audited to a WithLogger logger.
+var mutatingOps = map[string]bool{
+	"SaveIdentity":             true,
+	"SaveIdentities":           true,
+	"FindOrCreateIdentity":     true,
+	"SaveIdentityInsertOnly":   true,
+	"SaveAndReload":            true,
+	"DeleteIdentity":           true,
+	"ForceDeleteIdentity":      true,
+	"DeleteIdentities":         true,
+	"DeleteWhere":              true,
+	"PurgeDeleted":             true,
+	"ExpireDisabledIdentities": true,
+	"RenameIdentity":           true,
+	"Rekey":                    true,
+	"IncrementBtn":             true,
+	"SetDisabled":              true,
+	"SetHardlock":              true,
+	"SetSQRLOnly":              true,
+	"ClaimAndDisable":          true,
+	"RotateEncryptionKey":      true,
+	"HashIdentityKeys":         true,
+}
+
+// idkRejections are the errors that mean a caller-supplied identity key was
+// refused, in the order their messages are used as the logged reason.
+var idkRejections = []error{
+	ErrEmptyIdentityKey,
+	ErrIdentityKeyTooLong,
+	ErrInvalidIdentityKeyFormat,
+}
+
+// rowsNote carries the number of rows a mutation changed from the
+// statement that knows it to the operation's audit record.
+type rowsNote struct {
+	rows  int64
+	noted bool
+}
+
+// rowsNoteKey is the context key of the operation's *rowsNote.
+type rowsNoteKey struct{}
+
+// noteRows records n as the number of rows changed by the operation running
+// in ctx, for its audit record. It does nothing when the operation is not
+// audited.
+func noteRows(ctx context.Context, n int64) {
+	if note, ok := ctx.Value(rowsNoteKey{}).(*rowsNote); ok {
+		note.rows, note.noted = n, true
+	}
+}
+
+// logOp writes the records of a completed operation to the WithLogger
+// logger: a Warn for an identity key that failed validation, and an audit
+// record for a mutation. Neither carries a key or key material; the
+// identity key appears only as its IdkHash fingerprint, and a failure only
+// as its ErrorClass. Both carry the correlation_id of ctx when it has one.
+func (as *AuthStore) logOp(ctx context.Context, op, idk string, note *rowsNote, dur time.Duration, err error) {
+	logger := as.cfg.logger
+	if reason := idkRejection(err); reason != "" {
+		attrs := append(opAttrs(ctx, op), slog.String("reason", reason))
+		if idk != "" {
+			attrs = append(attrs, slog.String("idk_hash", IdkHash(idk)), slog.Int("idk_len", len(idk)))
+		}
+		logger.LogAttrs(ctx, slog.LevelWarn, "gormauthstore: identity key rejected", attrs...)
+		return
+	}
+	if !mutatingOps[op] {
+		return
+	}
+	failed := err != nil && !errors.Is(err, ssp.ErrNotFound)
+	affected := err == nil
+	if note != nil && note.noted {
+		affected = affected && note.rows > 0
+	}
+	attrs := append(opAttrs(ctx, op), slog.Bool("affected", affected), slog.Duration("duration", dur))
+	if idk != "" {
+		attrs = append(attrs, slog.String("idk_hash", IdkHash(idk)))
+	}
+	if note != nil && note.noted {
+		attrs = append(attrs, slog.Int64("rows", note.rows))
+	}
+	level := slog.LevelInfo
+	if failed {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", ErrorClass(err)))
+	}
+	logger.LogAttrs(ctx, level, "gormauthstore: "+op, attrs...)
+}
+
+// opAttrs returns the attributes every record of op starts with: the
+// operation and, if ctx carries one, its correlation ID.
+func opAttrs(ctx context.Context, op string) []slog.Attr {
+	attrs := []slog.Attr{slog.String("op", op)}
+	if id, ok := CorrelationIDFromContext(ctx); ok {
+		attrs = append(attrs, slog.String("correlation_id", id))
+	}
+	return attrs
+}
+
+// idkRejection returns the message of the identity key rule err reports
+// breaking, or "" if err is not a key rejection. The message of the
+// sentinel is used rather than err's, which a WithValidator may have built
+// from the key itself.
+func idkRejection(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, rejection := range idkRejections {
+		if errors.Is(err, rejection) {
+			return rejection.Error()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package gormauthstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// logRecords parses the JSON records written to buf.
+func logRecords(t *testing.T, buf *strings.Builder) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("parse %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// TestWithLogger_Audit verifies mutations are audited with a fingerprint of
+// the key and whether they affected a row, and that no key material is
+// logged.
+func TestWithLogger_Audit(t *testing.T) {
+	var buf strings.Builder
+	_, store := newTestStoreWithOptions(t, WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	identity := newTestIdentity().withIdk("audit-idk").withSuk("audit-suk").withVuk("audit-vuk").
+		withPidk("audit-pidk").withRekeyed("audit-rekeyed").build()
+
+	if err := store.SaveIdentity(identity); err != nil {
+		t.Fatalf("SaveIdentity failed: %v", err)
+	}
+	if _, err := store.FindIdentity("audit-idk"); err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if err := store.DeleteIdentity("audit-idk"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+	if err := store.DeleteIdentity("audit-idk"); err != nil {
+		t.Fatalf("repeated DeleteIdentity failed: %v", err)
+	}
+
+	if out := buf.String(); strings.Contains(out, "audit-") {
+		t.Fatalf("log leaks identity data: %s", out)
+	}
+	records := logRecords(t, &buf)
+	want := []struct {
+		op       string
+		affected bool
+	}{
+		{"SaveIdentity", true},
+		{"DeleteIdentity", true},
+		{"DeleteIdentity", false},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records: got %v, want %d", records, len(want))
+	}
+	for i, w := range want {
+		r := records[i]
+		if r["op"] != w.op || r["affected"] != w.affected || r["level"] != "INFO" ||
+			r["idk_hash"] != IdkHash("audit-idk") || r["duration"] == nil {
+			t.Errorf("record %d: got %v, want op %s affected %v", i, r, w.op, w.affected)
+		}
+	}
+}
+
+// TestWithLogger_FailureClass verifies a failed mutation is logged with the
+// class of its error, not a driver message that quotes the key.
+func TestWithLogger_FailureClass(t *testing.T) {
+	var buf strings.Builder
+	db, store := newTestStoreWithOptions(t, WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	err := db.Callback().Create().Before("gorm:create").Register("test:quoting", func(tx *gorm.DB) {
+		tx.AddError(errors.New("Error 1062: Duplicate entry 'audit-leak' for key 'PRIMARY'"))
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	if err := store.SaveIdentity(newTestIdentity().withIdk("audit-leak").build()); !errors.Is(err, ErrDuplicateIdentity) {
+		t.Fatalf("expected ErrDuplicateIdentity, got %v", err)
+	}
+
+	if out := buf.String(); strings.Contains(out, "audit-leak") {
+		t.Fatalf("log leaks the identity key: %s", out)
+	}
+	records := logRecords(t, &buf)
+	if len(records) != 1 || records[0]["level"] != "WARN" || records[0]["error"] != ErrDuplicateIdentity.Error() {
+		t.Errorf("records: got %v, want one Warn with error %q", records, ErrDuplicateIdentity.Error())
+	}
+}
+
+// TestWithLogger_Rejections verifies keys failing validation are logged at
+// Warn with the broken rule but without the key, even when a validator's
+// error quotes it.
+func TestWithLogger_Rejections(t *testing.T) {
+	var buf strings.Builder
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	db, store := newTestStoreWithOptions(t, WithLogger(logger))
+	payload := "x' OR '1'='1"
+	if _, err := store.FindIdentity(payload); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Fatalf("expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+	quoting := NewAuthStore(db, WithLogger(logger), WithValidator(func(idk string) error {
+		return errors.Join(ErrInvalidIdentityKeyFormat, errors.New("bad key "+idk))
+	}))
+	if _, err := quoting.ClaimAndDisable(context.Background(), payload); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Fatalf("expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+
+	if out := buf.String(); strings.Contains(out, "OR") {
+		t.Fatalf("log leaks the rejected key: %s", out)
+	}
+	records := logRecords(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("records: got %v, want 2", records)
+	}
+	for i, op := range []string{"FindIdentity", "ClaimAndDisable"} {
+		r := records[i]
+		if r["op"] != op || r["level"] != "WARN" || r["reason"] != ErrInvalidIdentityKeyFormat.Error() ||
+			r["idk_hash"] != IdkHash(payload) || r["idk_len"] != float64(len(payload)) {
+			t.Errorf("record %d: got %v", i, r)
+		}
+	}
+}
+
+// TestWithLogger_CorrelationID verifies records carry the correlation ID of
+// the operation's context, and omit the field when there is none.
+func TestWithLogger_CorrelationID(t *testing.T) {
+	var buf strings.Builder
+	_, store := newTestStoreWithOptions(t, WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	ctx := ContextWithCorrelationID(context.Background(), "req-42")
+
+	if err := store.SaveIdentityWithContext(ctx, newTestIdentity().withIdk("corr-log").build()); err != nil {
+		t.Fatalf("SaveIdentityWithContext failed: %v", err)
+	}
+	if _, err := store.FindIdentityWithContext(ctx, "bad key"); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Fatalf("expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+	if err := store.DeleteIdentity("corr-log"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+
+	records := logRecords(t, &buf)
+	if len(records) != 3 {
+		t.Fatalf("records: got %v, want 3", records)
+	}
+	for i, want := range []any{"req-42", "req-42", nil} {
+		if got := records[i]["correlation_id"]; got != want {
+			t.Errorf("record %d correlation_id: got %v, want %v", i, got, want)
+		}
+	}
+}
@@ -5,27 +5,58 @@ package gormauthstore
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	ssp "github.com/dxcSithLord/server-go-ssp"
+	"golang.org/x/text/unicode/norm"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // identityRecord is a GORM v2 compatible model mirroring ssp.SqrlIdentity.
 // The upstream SqrlIdentity struct uses legacy GORM v1 sql:"" tags (e.g.
 // sql:"primary_key", sql:"-") that GORM v2 does not recognise. This model
 // provides the correct GORM v2 tags while keeping the same database schema.
+//
+// Idk must remain the primary key (or at least carry a unique index): every
+// lookup filters on it, and TC-028 asserts the index exists after migration.
 type identityRecord struct {
-	Idk      string `gorm:"column:idk;primaryKey"`
-	Suk      string `gorm:"column:suk"`
-	Vuk      string `gorm:"column:vuk"`
-	Pidk     string `gorm:"column:pidk"`
-	SQRLOnly bool   `gorm:"column:sqrl_only"`
-	Hardlock bool   `gorm:"column:hardlock"`
-	Disabled bool   `gorm:"column:disabled"`
-	Rekeyed  string `gorm:"column:rekeyed"`
-	Btn      int    `gorm:"column:btn"`
+	Idk      string  `gorm:"column:idk;primaryKey"`
+	Suk      keyText `gorm:"column:suk;serializer:sqrlkey"`
+	Vuk      keyText `gorm:"column:vuk;serializer:sqrlkey"`
+	Pidk     string  `gorm:"column:pidk"`
+	SQRLOnly bool    `gorm:"column:sqrl_only"`
+	Hardlock bool    `gorm:"column:hardlock"`
+	Disabled bool    `gorm:"column:disabled"`
+	Rekeyed  string  `gorm:"column:rekeyed;serializer:sqrlsealed"`
+	Btn      int     `gorm:"column:btn"`
+	// Mac is the WithIntegrityKey tag of the other fields; empty without it.
+	Mac string `gorm:"column:mac"`
+	// Version counts writes to the row, for WithOptimisticLocking.
+	Version int64 `gorm:"column:version;not null;default:0"`
+	// CreatedAt and UpdatedAt are stamped by the store in UTC rather than by
+	// GORM, whose NowFunc defaults to local time and whose auto-update
+	// would fire on the store's internal rewrites. They are zero for rows
+	// written before schema version 4.
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime:false"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime:false"`
+	// DeletedAt is set when WithSoftDelete deletes the row.
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index"`
 }
 
+// identityColumns lists the non-key columns written by SaveIdentity. Every
+// save inserts, or on conflict updates, exactly this set so the stored row
+// mirrors the identity passed in and no column is touched implicitly.
+var identityColumns = []string{"suk", "vuk", "pidk", "sqrl_only", "hardlock", "disabled", "rekeyed", "btn", "mac"}
+
+// timestampColumns are written alongside identityColumns by SaveIdentity:
+// created_at only when the row is inserted, updated_at on every save.
+var timestampColumns = []string{"created_at", "updated_at"}
+
 // TableName returns the table name matching the GORM v1 convention for SqrlIdentity.
 func (identityRecord) TableName() string {
 	return "sqrl_identities"
@@ -35,8 +66,8 @@ func (identityRecord) TableName() string {
 func toRecord(identity *ssp.SqrlIdentity) *identityRecord {
 	return &identityRecord{
 		Idk:      identity.Idk,
-		Suk:      identity.Suk,
-		Vuk:      identity.Vuk,
+		Suk:      keyText(identity.Suk),
+		Vuk:      keyText(identity.Vuk),
 		Pidk:     identity.Pidk,
 		SQRLOnly: identity.SQRLOnly,
 		Hardlock: identity.Hardlock,
@@ -50,8 +81,8 @@ func toRecord(identity *ssp.SqrlIdentity) *identityRecord {
 func toIdentity(record *identityRecord) *ssp.SqrlIdentity {
 	return &ssp.SqrlIdentity{
 		Idk:      record.Idk,
-		Suk:      record.Suk,
-		Vuk:      record.Vuk,
+		Suk:      string(record.Suk),
+		Vuk:      string(record.Vuk),
 		Pidk:     record.Pidk,
 		SQRLOnly: record.SQRLOnly,
 		Hardlock: record.Hardlock,
@@ -61,80 +92,741 @@ func toIdentity(record *identityRecord) *ssp.SqrlIdentity {
 	}
 }
 
-// clearRecord wipes sensitive cryptographic fields from an identityRecord.
-// Called after conversion to reduce the window where Suk/Vuk remain in memory.
+// clearRecord wipes the sensitive fields of an identityRecord: the key
+// material Suk and Vuk, and Pidk and Rekeyed, which link the identity to its
+// predecessor and successor. Idk is kept, as the record's lookup key. Called
+// after conversion to reduce the window where these remain in memory.
 func clearRecord(record *identityRecord) {
-	WipeString(&record.Suk)
-	WipeString(&record.Vuk)
+	WipeString((*string)(&record.Suk))
+	WipeString((*string)(&record.Vuk))
+	WipeString(&record.Pidk)
+	WipeString(&record.Rekeyed)
 }
 
 // AuthStore is an ssp.AuthStore implementation using the gorm ORM.
 type AuthStore struct {
-	db *gorm.DB
+	db       *gorm.DB
+	cfg      config
+	caps     *capabilities
+	versions *versionTracker
+	// closed is set by Close and shared with every copy of the store.
+	closed *atomic.Bool
+	// borrowedPool marks a store whose *sql.DB the caller owns, so Close
+	// leaves it open (see NewAuthStoreFromSQL).
+	borrowedPool bool
 }
 
 // NewAuthStore creates an AuthStore using the passed in gorm instance.
-func NewAuthStore(db *gorm.DB) *AuthStore {
-	return &AuthStore{db}
+// Options are applied in order; with no options the store behaves exactly
+// as it always has. A nil db does not panic: every operation on the store
+// returns ErrNilDatabase instead.
+func NewAuthStore(db *gorm.DB, opts ...Option) *AuthStore {
+	as := &AuthStore{db: db, caps: &capabilities{}, versions: &versionTracker{}, closed: &atomic.Bool{}}
+	for _, opt := range opts {
+		opt(&as.cfg)
+	}
+	as.cfg.buildKeys()
+	switch {
+	case as.cfg.validationDisabled:
+		as.logger().Warn("gormauthstore: identity key validation is DISABLED; use only for trusted migrations")
+	case as.cfg.validationUnconfirmed:
+		as.logger().Warn("gormauthstore: WithValidationDisabled ignored: confirmation does not match ConfirmValidationDisabled")
+	}
+	return as
+}
+
+// TableName returns the table holding this store's identities:
+// sqrl_identities unless set with WithTableName.
+func (as *AuthStore) TableName() string {
+	if as.cfg.tableName != "" {
+		return as.cfg.tableName
+	}
+	return identityRecord{}.TableName()
+}
+
+// identities scopes db to the live rows of the store's identity table.
+// Every statement on those rows starts here; the scope does not survive
+// db.Transaction, so transaction bodies apply it to tx again. Under
+// WithSoftDelete, soft-deleted rows are excluded.
+func (as *AuthStore) identities(db *gorm.DB) *gorm.DB {
+	db = as.allIdentities(db)
+	if as.cfg.softDelete {
+		db = db.Where("deleted_at IS NULL")
+	}
+	return db
+}
+
+// allIdentities scopes db to every row of the store's identity table,
+// soft-deleted or not, for maintenance and compliance reads. It is
+// Unscoped: the store filters and stamps deleted_at itself (see
+// identities and deleteRows) instead of relying on GORM's implicit
+// soft-delete clauses, which apply only to statements carrying the model.
+func (as *AuthStore) allIdentities(db *gorm.DB) *gorm.DB {
+	return db.Table(as.TableName()).Unscoped()
+}
+
+// deleteRows deletes the rows db selects, which must be scoped with
+// identities: under WithSoftDelete it stamps their deleted_at, otherwise it
+// removes them.
+func (as *AuthStore) deleteRows(db *gorm.DB) *gorm.DB {
+	if as.cfg.softDelete {
+		return db.Updates(map[string]interface{}{"deleted_at": as.now()})
+	}
+	return db.Delete(&identityRecord{})
+}
+
+// bulkDelete runs a bulk removal: rows scopes db to the rows to remove and
+// remove removes them, or under dryRun they are only counted, in a read.
+// It returns how many rows were, or would be, removed. Every bulk
+// destructive operation goes through here, so its dry run previews exactly
+// the rows it would remove.
+func (as *AuthStore) bulkDelete(ctx context.Context, dryRun bool, rows func(*gorm.DB) (*gorm.DB, error), remove func(*gorm.DB) *gorm.DB) (int64, error) {
+	kind := opWrite
+	if dryRun {
+		kind = opRead
+	}
+	var n int64
+	err := as.run(ctx, kind, func(db *gorm.DB) error {
+		db, err := rows(db)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return db.Count(&n).Error
+		}
+		result := remove(db)
+		n = result.RowsAffected
+		noteRows(ctx, n)
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// logger returns the logger set with WithLogger, or slog.Default().
+func (as *AuthStore) logger() *slog.Logger {
+	if as.cfg.logger != nil {
+		return as.cfg.logger
+	}
+	return slog.Default()
+}
+
+// WithSession returns a shallow copy of the store whose operations run on
+// as.db.Session(session), leaving the original store untouched. It scopes
+// GORM session settings to the calls made through the copy:
+//
+//	fast := store.WithSession(&gorm.Session{SkipDefaultTransaction: true})
+//	for _, id := range imported {
+//		if err := fast.SaveIdentity(id); err != nil { ... }
+//	}
+//
+// Supported knobs are SkipDefaultTransaction, PrepareStmt, Logger,
+// CreateBatchSize, QueryFields and NowFunc. DryRun, NewDB, Initialized,
+// AllowGlobalUpdate and SkipHooks change query semantics and must not be
+// used. A nil session returns the store itself.
+func (as *AuthStore) WithSession(session *gorm.Session) *AuthStore {
+	if session == nil || as.db == nil {
+		return as
+	}
+	clone := *as
+	clone.db = as.db.Session(session)
+	return &clone
+}
+
+// WithTx returns a shallow copy of the store whose operations run on tx, a
+// transaction the caller opened, so identity writes commit or roll back
+// together with the caller's own tables:
+//
+//	err := db.Transaction(func(tx *gorm.DB) error {
+//		if err := store.WithTx(tx).SaveIdentity(identity); err != nil {
+//			return err
+//		}
+//		return tx.Create(&account).Error
+//	})
+//
+// Every method works unchanged on the copy and still validates its input
+// before issuing SQL. Methods that use a transaction themselves nest in tx
+// as a savepoint. The copy must not be used after tx ends. A nil tx yields
+// a store whose operations return ErrNilDatabase, never one that silently
+// runs outside the transaction.
+func (as *AuthStore) WithTx(tx *gorm.DB) *AuthStore {
+	clone := *as
+	clone.db = tx
+	return &clone
+}
+
+// Transaction runs fn in a new database transaction, passing it a store
+// bound to that transaction (see WithTx). The transaction commits if fn
+// returns nil and rolls back if it returns an error, which Transaction
+// returns, or panics, after which the panic continues. fn must use the
+// store it is given, not the receiver, for its writes to be atomic.
+func (as *AuthStore) Transaction(fn func(tx *AuthStore) error) error {
+	return as.TransactionWithContext(as.baseContext(), fn)
+}
+
+// TransactionWithContext is Transaction with the transaction bound to ctx:
+// cancelling ctx rolls it back. The read and write timeouts still apply to
+// each operation fn makes, not to the transaction as a whole.
+func (as *AuthStore) TransactionWithContext(ctx context.Context, fn func(tx *AuthStore) error) error {
+	if err := as.usable(); err != nil {
+		return err
+	}
+	return as.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(as.WithTx(tx))
+	})
+}
+
+// defaultTimeoutKey marks the context of a method without a context
+// parameter, so operationContext applies the WithDefaultTimeout.
+type defaultTimeoutKey struct{}
+
+// baseContext returns the context used by the methods without a context
+// parameter: the one set with WithBaseContext, or context.Background(),
+// marked for the WithDefaultTimeout if one is set.
+func (as *AuthStore) baseContext() context.Context {
+	ctx := context.Background()
+	if as.cfg.baseCtx != nil {
+		ctx = as.cfg.baseCtx
+	}
+	if as.cfg.defaultTimeout > 0 {
+		ctx = context.WithValue(ctx, defaultTimeoutKey{}, true)
+	}
+	return ctx
 }
 
-// AutoMigrate uses gorm AutoMigrate to create/update the table holding the ssp.SqrlIdentity.
+// opKind classifies a store operation for timeout selection.
+type opKind int
+
+const (
+	opRead opKind = iota
+	opWrite
+	// opWriteOnce is a write that is not idempotent, such as an increment
+	// or a claim: it is never retried, since a transient failure may come
+	// after the database applied it. The write timeout applies.
+	opWriteOnce
+	// opStream is a long-running operation such as a full-table iteration
+	// or key rotation. It is bounded only by the caller's context, never by
+	// the read or write timeout.
+	opStream
+)
+
+// operationContext derives the context for a single operation. The read or
+// write timeout, when configured, can only shrink the caller's deadline: the
+// effective deadline is the sooner of the two, so a store default never
+// extends a deadline set further up the call chain. Without one, a method
+// without a context parameter gets the WithDefaultTimeout.
+func (as *AuthStore) operationContext(ctx context.Context, kind opKind) (context.Context, context.CancelFunc) {
+	var timeout time.Duration
+	switch kind {
+	case opRead:
+		timeout = as.cfg.readTimeout
+	case opWrite, opWriteOnce:
+		timeout = as.cfg.writeTimeout
+	}
+	if timeout <= 0 && kind != opStream && ctx.Value(defaultTimeoutKey{}) != nil {
+		timeout = as.cfg.defaultTimeout
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// run executes fn against a context-bound database handle for one operation,
+// retrying transient failures under WithRetry. Every database access goes
+// through here, so this is where a nil db becomes ErrNilDatabase, a closed
+// store ErrStoreClosed, a unique violation ErrDuplicateIdentity and any
+// other database failure ErrTransient or ErrStore.
+func (as *AuthStore) run(ctx context.Context, kind opKind, fn func(db *gorm.DB) error) error {
+	if err := as.usable(); err != nil {
+		return err
+	}
+	if as.cfg.optionErr != nil {
+		return as.cfg.optionErr
+	}
+	retry := kind != opStream && kind != opWriteOnce && !inTransaction(as.db)
+	for attempt := 1; ; attempt++ {
+		err := as.attempt(ctx, kind, fn)
+		if !retry || attempt >= as.cfg.retryMax || !IsRetryable(err) {
+			return err
+		}
+		if !waitRetry(ctx, retryDelay(as.cfg.retryDelay, attempt)) {
+			return err
+		}
+	}
+}
+
+// attempt is one attempt of run. If fn fails on a stale prepared statement,
+// the statement cache is dropped and fn is retried at once against freshly
+// prepared statements.
+func (as *AuthStore) attempt(ctx context.Context, kind opKind, fn func(db *gorm.DB) error) error {
+	ctx, cancel := as.operationContext(ctx, kind)
+	defer cancel()
+	if as.cfg.binaryKeys {
+		ctx = context.WithValue(ctx, binaryKeysKey{}, true)
+	}
+	if as.cfg.cipher != nil {
+		ctx = context.WithValue(ctx, fieldCipherKey{}, as.cfg.cipher)
+	}
+	err := fn(as.db.WithContext(ctx))
+	if err != nil && as.resetPreparedStmts(err) {
+		err = fn(as.db.WithContext(ctx))
+	}
+	if err == nil {
+		return nil
+	}
+	var callback callbackError
+	if errors.As(err, &callback) {
+		return callback.err
+	}
+	if !errors.Is(err, ErrDuplicateIdentity) && isUniqueViolation(err) {
+		return &duplicateError{err: err}
+	}
+	return classifyError(err)
+}
+
+// uniqueViolationMessages are driver error fragments reporting a unique
+// constraint violation. The only unique key is idk, so every such error is
+// an identity key already in use.
+var uniqueViolationMessages = []string{
+	"unique constraint failed",    // SQLite, SQLITE_CONSTRAINT_PRIMARYKEY
+	"violates unique constraint",  // PostgreSQL, SQLSTATE 23505 (pq, pgx)
+	"duplicate entry",             // MySQL and MariaDB, error 1062
+	"cannot insert duplicate key", // SQL Server, errors 2601 and 2627
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation:
+// gorm.ErrDuplicatedKey when the dialector translates errors, a driver
+// error reporting SQLSTATE 23505, or a known driver message.
+func isUniqueViolation(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && state.SQLState() == "23505" {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range uniqueViolationMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// stalePreparedStmtMessages are driver error fragments reporting that a
+// cached prepared statement no longer matches the schema, typically after a
+// migration ran while PrepareStmt was enabled.
+var stalePreparedStmtMessages = []string{
+	"cached plan must not change result type",    // PostgreSQL, SQLSTATE 0A000
+	"prepared statement needs to be re-prepared", // MySQL, error 1615
+	"database schema has changed",                // SQLite, SQLITE_SCHEMA
+}
+
+// isStalePreparedStmt reports whether err is a stale prepared-statement error.
+func isStalePreparedStmt(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range stalePreparedStmtMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// resetPreparedStmts closes every cached prepared statement when err reports
+// a stale one, and reports whether it did so. It is a no-op unless the store
+// runs with GORM's PrepareStmt enabled.
+func (as *AuthStore) resetPreparedStmts(err error) bool {
+	pool, ok := as.db.Statement.ConnPool.(*gorm.PreparedStmtDB)
+	if !ok || !isStalePreparedStmt(err) {
+		return false
+	}
+	pool.Close()
+	as.logger().Warn("gormauthstore: stale prepared statement; statement cache reset")
+	return true
+}
+
+// AutoMigrate creates/updates the table holding the ssp.SqrlIdentity by
+// applying any pending versioned migrations; see Migrate.
 func (as *AuthStore) AutoMigrate() error {
-	return as.AutoMigrateWithContext(context.Background())
+	return as.AutoMigrateWithContext(as.baseContext())
 }
 
-// AutoMigrateWithContext uses gorm AutoMigrate with context support for
-// timeout and cancellation control.
+// AutoMigrateWithContext is AutoMigrate with context support for timeout and
+// cancellation control.
 func (as *AuthStore) AutoMigrateWithContext(ctx context.Context) error {
-	return as.db.WithContext(ctx).AutoMigrate(&identityRecord{})
+	return as.Migrate(ctx)
 }
 
 // FindIdentity implements ssp.AuthStore.
-// Validates the idk before querying the database.
+// Validates the idk before querying the database. The result is a fresh
+// copy, as for FindIdentityWithContext.
 func (as *AuthStore) FindIdentity(idk string) (*ssp.SqrlIdentity, error) {
-	return as.FindIdentityWithContext(context.Background(), idk)
+	return as.FindIdentityWithContext(as.baseContext(), idk)
 }
 
 // FindIdentityWithContext retrieves a SQRL identity by its Identity Key with
 // context support for timeout and cancellation control.
 // Validates the idk before querying the database.
-func (as *AuthStore) FindIdentityWithContext(ctx context.Context, idk string) (*ssp.SqrlIdentity, error) {
-	if err := ValidateIdk(idk); err != nil {
-		return nil, err
+// Every call returns a freshly allocated identity that shares no memory with
+// the store or other callers; the caller owns it and may modify or clear it.
+func (as *AuthStore) FindIdentityWithContext(ctx context.Context, idk string) (_ *ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "FindIdentity", idk, &err)
+	defer done()
+	return as.findIdentity(ctx, idk)
+}
+
+// findIdentity is FindIdentityWithContext without error observation, for
+// methods that build on it and report under their own name.
+func (as *AuthStore) findIdentity(ctx context.Context, idk string) (*ssp.SqrlIdentity, error) {
+	identity, _, err := as.loadIdentity(ctx, idk, as.identities)
+	return identity, err
+}
+
+// loadIdentity reads the identity idk and its metadata from the rows scope
+// selects: identities, or a variant of it.
+func (as *AuthStore) loadIdentity(ctx context.Context, idk string, scope func(*gorm.DB) *gorm.DB) (*ssp.SqrlIdentity, IdentityMetadata, error) {
+	if err := as.validateIdk(idk); err != nil {
+		return nil, IdentityMetadata{}, err
 	}
 	record := &identityRecord{}
-	err := as.db.WithContext(ctx).Where("idk = ?", idk).First(record).Error
+	err := as.run(ctx, opRead, func(db *gorm.DB) error {
+		return scope(db).Where("idk = ?", as.lookupKey(idk)).First(record).Error
+	})
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ssp.ErrNotFound
+			return nil, IdentityMetadata{}, ssp.ErrNotFound
 		}
+		return nil, IdentityMetadata{}, err
+	}
+	defer clearRecord(record)
+	if err := as.verifyRecord(record); err != nil {
+		return nil, IdentityMetadata{}, err
+	}
+	record.Idk = idk
+	identity := toIdentity(record)
+	as.trackVersion(identity, record.Version)
+	return identity, toMetadata(record), nil
+}
+
+// FindActiveIdentity retrieves a SQRL identity only if it is not disabled.
+// Returns ErrIdentityDisabled for a disabled identity and ssp.ErrNotFound for
+// a missing one, so callers cannot forget the Disabled check.
+// The disabled identity is wiped before the error is returned.
+func (as *AuthStore) FindActiveIdentity(ctx context.Context, idk string) (_ *ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "FindActiveIdentity", idk, &err)
+	defer done()
+	identity, err := as.findIdentity(ctx, idk)
+	if err != nil {
 		return nil, err
 	}
-	result := toIdentity(record)
-	clearRecord(record)
-	return result, nil
+	if identity.Disabled {
+		ClearIdentity(identity)
+		return nil, ErrIdentityDisabled
+	}
+	return identity, nil
+}
+
+// FindIdentityByPidk retrieves the identity whose Pidk (previous identity
+// key) is pidk, to resolve a rekey predecessor to its successor. pidk is
+// validated like an Idk. Returns ssp.ErrNotFound if no identity names it and
+// ErrAmbiguousPidk, rather than an arbitrary match, if several do.
+func (as *AuthStore) FindIdentityByPidk(pidk string) (*ssp.SqrlIdentity, error) {
+	return as.FindIdentityByPidkWithContext(as.baseContext(), pidk)
+}
+
+// FindIdentityByPidkWithContext is FindIdentityByPidk with context support
+// for timeout and cancellation control.
+func (as *AuthStore) FindIdentityByPidkWithContext(ctx context.Context, pidk string) (_ *ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "FindIdentityByPidk", pidk, &err)
+	defer done()
+	if err := as.validateIdk(pidk); err != nil {
+		return nil, err
+	}
+	// Two rows are enough to tell a unique match from an ambiguous one.
+	var records []identityRecord
+	err = as.run(ctx, opRead, func(db *gorm.DB) error {
+		return as.identities(db).Where("pidk = ?", pidk).Order("idk").Limit(2).Find(&records).Error
+	})
+	defer func() {
+		for i := range records {
+			clearRecord(&records[i])
+		}
+	}()
+	switch {
+	case err != nil:
+		return nil, err
+	case len(records) == 0:
+		return nil, ssp.ErrNotFound
+	case len(records) > 1:
+		return nil, ErrAmbiguousPidk
+	}
+	if err := as.verifyRecord(&records[0]); err != nil {
+		return nil, err
+	}
+	return toIdentity(&records[0]), nil
+}
+
+// ExistsIdentity reports whether an identity with the given key is stored.
+// Only the key column is queried, so Suk and Vuk are never read into memory;
+// prefer it to FindIdentity for presence checks. A missing key yields
+// false, nil.
+func (as *AuthStore) ExistsIdentity(idk string) (bool, error) {
+	return as.ExistsIdentityWithContext(as.baseContext(), idk)
+}
+
+// ExistsIdentityWithContext is ExistsIdentity with context support for
+// timeout and cancellation control.
+func (as *AuthStore) ExistsIdentityWithContext(ctx context.Context, idk string) (_ bool, err error) {
+	ctx, done := as.observe(ctx, "ExistsIdentity", idk, &err)
+	defer done()
+	if err := as.validateIdk(idk); err != nil {
+		return false, err
+	}
+	var count int64
+	err = as.run(ctx, opRead, func(db *gorm.DB) error {
+		return as.identities(db).Where("idk = ?", as.lookupKey(idk)).Count(&count).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
 
 // SaveIdentity implements ssp.AuthStore.
 // Validates the identity and its Idk before persisting.
 func (as *AuthStore) SaveIdentity(identity *ssp.SqrlIdentity) error {
-	return as.SaveIdentityWithContext(context.Background(), identity)
+	return as.SaveIdentityWithContext(as.baseContext(), identity)
 }
 
 // SaveIdentityWithContext persists a SQRL identity with context support for
 // timeout and cancellation control.
 // Validates the identity and its Idk before persisting.
-func (as *AuthStore) SaveIdentityWithContext(ctx context.Context, identity *ssp.SqrlIdentity) error {
+func (as *AuthStore) SaveIdentityWithContext(ctx context.Context, identity *ssp.SqrlIdentity) (err error) {
+	ctx, done := as.observe(ctx, "SaveIdentity", identityIdk(identity), &err)
+	defer done()
+	if err := as.validateIdentity(identity); err != nil {
+		return err
+	}
+	record := as.newRecord(identity)
+	defer clearRecord(record)
+	if as.cfg.optimisticLocking {
+		return as.saveVersioned(ctx, identity, record)
+	}
+	return as.run(ctx, opWrite, func(db *gorm.DB) error {
+		return upsertRecord(as.identities(db), record)
+	})
+}
+
+// SaveIdentityInsertOnly persists a new SQRL identity, returning
+// ErrDuplicateIdentity if its key is already in use, by a soft-deleted row
+// included. SaveIdentity is an upsert and overwrites an existing row; this
+// is for callers that must not, such as account creation, where of two
+// requests racing to create the same key exactly one succeeds.
+func (as *AuthStore) SaveIdentityInsertOnly(ctx context.Context, identity *ssp.SqrlIdentity) (err error) {
+	ctx, done := as.observe(ctx, "SaveIdentityInsertOnly", identityIdk(identity), &err)
+	defer done()
+	if err := as.validateIdentity(identity); err != nil {
+		return err
+	}
+	record := as.newRecord(identity)
+	defer clearRecord(record)
+	err = as.run(ctx, opWriteOnce, func(db *gorm.DB) error {
+		return as.allIdentities(db).Select(slices.Concat([]string{"idk"}, identityColumns, timestampColumns)).
+			Create(record).Error
+	})
+	if err != nil {
+		return err
+	}
+	as.trackVersion(identity, 0)
+	return nil
+}
+
+// FindOrCreateIdentity returns the stored identity with identity's key and
+// false if there is one, and otherwise inserts identity and returns it and
+// true, replacing the find-then-save of a registration flow. The lookup and
+// insert are FirstOrCreate's, guarded by the key's unique index: when a
+// concurrent caller inserts the key in between, the insert fails and its
+// identity is returned as found, so exactly one caller creates it. Either
+// way the result is a copy, never identity itself. The key is validated
+// first. A key held by a soft-deleted row can be neither found
+// nor created and returns ErrDuplicateIdentity.
+func (as *AuthStore) FindOrCreateIdentity(identity *ssp.SqrlIdentity) (*ssp.SqrlIdentity, bool, error) {
+	return as.FindOrCreateIdentityWithContext(as.baseContext(), identity)
+}
+
+// FindOrCreateIdentityWithContext is FindOrCreateIdentity with context
+// support for timeout and cancellation control. The write timeout applies.
+func (as *AuthStore) FindOrCreateIdentityWithContext(ctx context.Context, identity *ssp.SqrlIdentity) (_ *ssp.SqrlIdentity, _ bool, err error) {
+	ctx, done := as.observe(ctx, "FindOrCreateIdentity", identityIdk(identity), &err)
+	defer done()
+	if err := as.validateIdentity(identity); err != nil {
+		return nil, false, err
+	}
+	record := as.newRecord(identity)
+	defer clearRecord(record)
+	stored := &identityRecord{}
+	defer clearRecord(stored)
+	created := false
+	err = as.run(ctx, opWriteOnce, func(db *gorm.DB) error {
+		err := as.identities(db).Where("idk = ?", record.Idk).Take(stored).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		err = as.allIdentities(db).Select(slices.Concat([]string{"idk"}, identityColumns, timestampColumns)).
+			Create(record).Error
+		created = err == nil
+		return err
+	})
+	if errors.Is(err, ErrDuplicateIdentity) {
+		// Lost the race to a concurrent insert: return the winner's row.
+		existing, findErr := as.findIdentity(ctx, identity.Idk)
+		if findErr == nil {
+			noteRows(ctx, 0)
+			return existing, false, nil
+		}
+		if !errors.Is(findErr, ssp.ErrNotFound) {
+			return nil, false, findErr
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if created {
+		noteRows(ctx, 1)
+		as.trackVersion(identity, 0)
+		stored := CloneIdentity(identity)
+		as.trackVersion(stored, 0)
+		return stored, true, nil
+	}
+	noteRows(ctx, 0)
+	if err := as.verifyRecord(stored); err != nil {
+		return nil, false, err
+	}
+	stored.Idk = identity.Idk
+	existing := toIdentity(stored)
+	as.trackVersion(existing, stored.Version)
+	return existing, false, nil
+}
+
+// SaveAndReload persists a SQRL identity and returns the row as stored, so any
+// server-populated columns are reflected without a separate FindIdentity.
+// Where the database supports RETURNING (PostgreSQL, SQLite 3.35+, MariaDB
+// 10.5+) the row comes back from the upsert itself; elsewhere it is re-read
+// in the same transaction. Both paths return the same identity.
+// The caller's identity is left unchanged.
+func (as *AuthStore) SaveAndReload(ctx context.Context, identity *ssp.SqrlIdentity) (_ *ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "SaveAndReload", identityIdk(identity), &err)
+	defer done()
+	if err := as.validateIdentity(identity); err != nil {
+		return nil, err
+	}
+	record := as.newRecord(identity)
+	defer clearRecord(record)
+	err = as.run(ctx, opWrite, func(db *gorm.DB) error {
+		if as.canReturn(db) {
+			return upsertRecord(as.identities(db).Clauses(clause.Returning{}), record)
+		}
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := upsertRecord(as.identities(tx), record); err != nil {
+				return err
+			}
+			return as.identities(tx).Where("idk = ?", record.Idk).Take(record).Error
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := as.verifyRecord(record); err != nil {
+		return nil, err
+	}
+	record.Idk = identity.Idk
+	reloaded := toIdentity(record)
+	as.trackVersion(reloaded, record.Version)
+	return reloaded, nil
+}
+
+// validateIdentity applies ValidateIdentity with the store's key and field
+// length limits and validator.
+func (as *AuthStore) validateIdentity(identity *ssp.SqrlIdentity) error {
 	if identity == nil {
 		return ErrNilIdentity
 	}
-	if err := ValidateIdk(identity.Idk); err != nil {
+	if err := as.validateIdk(identity.Idk); err != nil {
 		return err
 	}
-	record := toRecord(identity)
-	err := as.db.WithContext(ctx).Save(record).Error
-	clearRecord(record)
-	return err
+	maxFieldLength := MaxFieldLength
+	if as.cfg.maxFieldLength > 0 {
+		maxFieldLength = as.cfg.maxFieldLength
+	}
+	return validateFieldLengths(identity, maxFieldLength)
+}
+
+// validateIdk applies the WithValidator check, after rejecting keys not in
+// Unicode NFC, or else ValidateIdk with the store's key length limit. An
+// empty key is always rejected; under WithValidationDisabled nothing else is.
+func (as *AuthStore) validateIdk(idk string) error {
+	if as.cfg.validationDisabled {
+		if idk == "" {
+			return ErrEmptyIdentityKey
+		}
+		return nil
+	}
+	if as.cfg.validator != nil {
+		if idk == "" {
+			return ErrEmptyIdentityKey
+		}
+		// The built-in rules admit only ASCII, which is always NFC. A custom
+		// validator may admit more, so a key must already be in NFC: two
+		// visually identical keys must not be stored as different bytes.
+		if !norm.NFC.IsNormalString(idk) {
+			return ErrInvalidIdentityKeyFormat
+		}
+		return as.cfg.validator(idk)
+	}
+	maxIdkLength := MaxIdkLength
+	if as.cfg.maxIdkLength > 0 {
+		maxIdkLength = as.cfg.maxIdkLength
+	}
+	return validateIdk(idk, maxIdkLength)
+}
+
+// upsertRecord inserts record or, if its idk already exists, overwrites the
+// identityColumns and updated_at of the existing row, bumps its version and
+// undeletes it if it was soft-deleted. Unlike gorm's
+// Save, the column set is explicit: no hooks, associations or implicit
+// columns are involved.
+func upsertRecord(db *gorm.DB, record *identityRecord) error {
+	return upsert(db).Create(record).Error
+}
+
+// conflictUpdates is what an upsert conflict writes to the existing row:
+// the identityColumns and updated_at, the version bumped, and deleted_at
+// cleared. The version is qualified because PostgreSQL's DO UPDATE can
+// also see the excluded row.
+var conflictUpdates = append(clause.AssignmentColumns(slices.Concat(identityColumns, []string{"updated_at"})),
+	clause.Assignment{
+		Column: clause.Column{Name: "version"},
+		Value:  gorm.Expr("? + 1", clause.Column{Table: clause.CurrentTable, Name: "version"}),
+	},
+	clause.Assignment{Column: clause.Column{Name: "deleted_at"}, Value: nil},
+)
+
+// upsert scopes db to the column set and conflict clause of upsertRecord, for
+// Create or CreateInBatches.
+func upsert(db *gorm.DB) *gorm.DB {
+	return db.Select(slices.Concat([]string{"idk"}, identityColumns, timestampColumns)).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "idk"}},
+			DoUpdates: conflictUpdates,
+		})
 }
 
 // FindIdentitySecure retrieves a SQRL identity wrapped in a SecureIdentityWrapper.
@@ -148,7 +840,7 @@ func (as *AuthStore) SaveIdentityWithContext(ctx context.Context, identity *ssp.
 //	defer wrapper.Destroy()
 //	identity := wrapper.GetIdentity()
 func (as *AuthStore) FindIdentitySecure(idk string) (*SecureIdentityWrapper, error) {
-	return as.FindIdentitySecureWithContext(context.Background(), idk)
+	return as.FindIdentitySecureWithContext(as.baseContext(), idk)
 }
 
 // FindIdentitySecureWithContext retrieves a SQRL identity wrapped in a
@@ -162,8 +854,10 @@ func (as *AuthStore) FindIdentitySecure(idk string) (*SecureIdentityWrapper, err
 //	if err != nil { return err }
 //	defer wrapper.Destroy()
 //	identity := wrapper.GetIdentity()
-func (as *AuthStore) FindIdentitySecureWithContext(ctx context.Context, idk string) (*SecureIdentityWrapper, error) {
-	identity, err := as.FindIdentityWithContext(ctx, idk)
+func (as *AuthStore) FindIdentitySecureWithContext(ctx context.Context, idk string) (_ *SecureIdentityWrapper, err error) {
+	ctx, done := as.observe(ctx, "FindIdentitySecure", idk, &err)
+	defer done()
+	identity, err := as.findIdentity(ctx, idk)
 	if err != nil {
 		return nil, err
 	}
@@ -174,16 +868,59 @@ func (as *AuthStore) FindIdentitySecureWithContext(ctx context.Context, idk stri
 // Validates the idk before executing the delete.
 // Returns nil (no error) if the key does not exist.
 func (as *AuthStore) DeleteIdentity(idk string) error {
-	return as.DeleteIdentityWithContext(context.Background(), idk)
+	return as.DeleteIdentityWithContext(as.baseContext(), idk)
 }
 
 // DeleteIdentityWithContext removes a SQRL identity with context support for
 // timeout and cancellation control.
 // Validates the idk before executing the delete.
-// Returns nil (no error) if the key does not exist.
-func (as *AuthStore) DeleteIdentityWithContext(ctx context.Context, idk string) error {
-	if err := ValidateIdk(idk); err != nil {
+// Returns nil (no error) if the key does not exist. With WithProtectHardlocked,
+// a hardlocked identity is kept and ErrIdentityHardlocked is returned.
+func (as *AuthStore) DeleteIdentityWithContext(ctx context.Context, idk string) (err error) {
+	ctx, done := as.observe(ctx, "DeleteIdentity", idk, &err)
+	defer done()
+	return as.deleteIdentity(ctx, idk, !as.cfg.protectHardlocked)
+}
+
+// ForceDeleteIdentity removes a SQRL identity even if it is hardlocked and
+// WithProtectHardlocked is set.
+func (as *AuthStore) ForceDeleteIdentity(idk string) error {
+	return as.ForceDeleteIdentityWithContext(as.baseContext(), idk)
+}
+
+// ForceDeleteIdentityWithContext is ForceDeleteIdentity with context support
+// for timeout and cancellation control.
+func (as *AuthStore) ForceDeleteIdentityWithContext(ctx context.Context, idk string) (err error) {
+	ctx, done := as.observe(ctx, "ForceDeleteIdentity", idk, &err)
+	defer done()
+	return as.deleteIdentity(ctx, idk, true)
+}
+
+// deleteIdentity removes the identity idk. Unless force is set, a hardlocked
+// row is left in place and ErrIdentityHardlocked is returned.
+func (as *AuthStore) deleteIdentity(ctx context.Context, idk string, force bool) error {
+	if err := as.validateIdk(idk); err != nil {
 		return err
 	}
-	return as.db.WithContext(ctx).Where("idk = ?", idk).Delete(&identityRecord{}).Error
+	idk = as.lookupKey(idk)
+	return as.run(ctx, opWrite, func(db *gorm.DB) error {
+		if force {
+			result := as.deleteRows(as.identities(db).Where("idk = ?", idk))
+			noteRows(ctx, result.RowsAffected)
+			return result.Error
+		}
+		result := as.deleteRows(as.identities(db).Where("idk = ? AND hardlock = ?", idk, false))
+		noteRows(ctx, result.RowsAffected)
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		var locked int64
+		if err := as.identities(db).Where("idk = ? AND hardlock = ?", idk, true).Count(&locked).Error; err != nil {
+			return err
+		}
+		if locked > 0 {
+			return ErrIdentityHardlocked
+		}
+		return nil
+	})
 }
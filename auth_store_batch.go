@@ -0,0 +1,195 @@
+package gormauthstore
+
+import (
+	"context"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// DefaultBatchSize is the number of rows SaveIdentities writes per INSERT
+// statement. PERF-007 shows larger batches gain little beyond it on SQLite.
+const DefaultBatchSize = 100
+
+// MaxFindIdentities is the most keys FindIdentities and DeleteIdentities
+// accept in one call. It bounds the size of the IN list, which some
+// databases cap at around a thousand parameters.
+const MaxFindIdentities = 1000
+
+// FindIdentities retrieves the identities of idks with a single
+// SELECT ... WHERE idk IN (...), for resolving a block of keys at once. The
+// result maps each Idk found to its identity; keys with no identity are
+// absent from the map rather than an error. Every key is validated first;
+// the first invalid one is reported as a BatchError carrying its index, and
+// nothing is read. More than MaxFindIdentities keys return
+// ErrBatchTooLarge. Duplicate keys are collapsed, and an empty slice returns
+// an empty map.
+func (as *AuthStore) FindIdentities(idks []string) (map[string]*ssp.SqrlIdentity, error) {
+	return as.FindIdentitiesWithContext(as.baseContext(), idks)
+}
+
+// FindIdentitiesWithContext is FindIdentities with context support for
+// timeout and cancellation control.
+func (as *AuthStore) FindIdentitiesWithContext(ctx context.Context, idks []string) (_ map[string]*ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "FindIdentities", "", &err)
+	defer done()
+	if len(idks) > MaxFindIdentities {
+		return nil, ErrBatchTooLarge
+	}
+	// byKey maps the stored key back to the caller's, which differ under
+	// WithIdkPepper.
+	byKey := make(map[string]string, len(idks))
+	keys := make([]string, 0, len(idks))
+	for i, idk := range idks {
+		if err := as.validateIdk(idk); err != nil {
+			return nil, BatchError{Index: i, Err: err}
+		}
+		key := as.lookupKey(idk)
+		if _, ok := byKey[key]; !ok {
+			byKey[key] = idk
+			keys = append(keys, key)
+		}
+	}
+	found := make(map[string]*ssp.SqrlIdentity, len(keys))
+	if len(keys) == 0 {
+		return found, nil
+	}
+
+	var records []*identityRecord
+	err = as.run(ctx, opRead, func(db *gorm.DB) error {
+		return as.identities(db).Where("idk IN ?", keys).Find(&records).Error
+	})
+	defer func() {
+		for _, record := range records {
+			clearRecord(record)
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if err := as.verifyRecord(record); err != nil {
+			return nil, err
+		}
+	}
+	for _, record := range records {
+		idk, ok := byKey[record.Idk]
+		if !ok {
+			continue
+		}
+		record.Idk = idk
+		identity := toIdentity(record)
+		as.trackVersion(identity, record.Version)
+		found[idk] = identity
+	}
+	return found, nil
+}
+
+// SaveIdentities persists identities with the same upsert semantics as
+// SaveIdentity, for bulk imports. Every identity is validated first; the
+// first invalid one is reported as a BatchError carrying its index and
+// wrapping the validation error (ErrNilIdentity, ErrEmptyIdentityKey, ...),
+// and nothing is written. The rows are then written in one transaction, in
+// multi-row statements of DefaultBatchSize, so a failure rolls back the
+// whole batch. If an Idk appears more than once, the last occurrence wins,
+// as it would for successive SaveIdentity calls. An empty slice is a no-op.
+func (as *AuthStore) SaveIdentities(identities []*ssp.SqrlIdentity) error {
+	return as.SaveIdentitiesWithContext(as.baseContext(), identities)
+}
+
+// SaveIdentitiesWithContext is SaveIdentities with context support for
+// timeout and cancellation control. The write timeout covers the whole batch.
+func (as *AuthStore) SaveIdentitiesWithContext(ctx context.Context, identities []*ssp.SqrlIdentity) (err error) {
+	ctx, done := as.observe(ctx, "SaveIdentities", "", &err)
+	defer done()
+	for i, identity := range identities {
+		if err := as.validateIdentity(identity); err != nil {
+			return BatchError{Index: i, Err: err}
+		}
+	}
+	if len(identities) == 0 {
+		return nil
+	}
+
+	// A multi-row upsert may not touch the same row twice (PostgreSQL
+	// rejects it), so keep only the last occurrence of each idk.
+	last := make(map[string]int, len(identities))
+	for i, identity := range identities {
+		last[identity.Idk] = i
+	}
+	records := make([]*identityRecord, 0, len(last))
+	for i, identity := range identities {
+		if last[identity.Idk] == i {
+			records = append(records, as.newRecord(identity))
+		}
+	}
+	defer func() {
+		for _, record := range records {
+			clearRecord(record)
+		}
+	}()
+
+	return as.run(ctx, opWrite, func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			return upsert(as.identities(tx)).CreateInBatches(records, DefaultBatchSize).Error
+		})
+	})
+}
+
+// DeleteIdentities removes every identity in idks with a single
+// DELETE ... WHERE idk IN (...), for revoking a block of keys at once. Every
+// key is validated first; the first invalid one is reported as a BatchError
+// carrying its index, and nothing is deleted. More than MaxFindIdentities
+// keys return ErrBatchTooLarge. Duplicate keys are collapsed and, as with
+// DeleteIdentity, missing keys are not an error. An empty slice is a no-op.
+//
+// With WithProtectHardlocked, if any of the keys is hardlocked nothing is
+// deleted and ErrIdentityHardlocked is returned; ForceDeleteIdentity remains
+// the way to remove those.
+func (as *AuthStore) DeleteIdentities(idks []string) error {
+	return as.DeleteIdentitiesWithContext(as.baseContext(), idks)
+}
+
+// DeleteIdentitiesWithContext is DeleteIdentities with context support for
+// timeout and cancellation control.
+func (as *AuthStore) DeleteIdentitiesWithContext(ctx context.Context, idks []string) (err error) {
+	ctx, done := as.observe(ctx, "DeleteIdentities", "", &err)
+	defer done()
+	if len(idks) > MaxFindIdentities {
+		return ErrBatchTooLarge
+	}
+	seen := make(map[string]bool, len(idks))
+	keys := make([]string, 0, len(idks))
+	for i, idk := range idks {
+		if err := as.validateIdk(idk); err != nil {
+			return BatchError{Index: i, Err: err}
+		}
+		if !seen[idk] {
+			seen[idk] = true
+			keys = append(keys, as.lookupKey(idk))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return as.run(ctx, opWrite, func(db *gorm.DB) error {
+		if !as.cfg.protectHardlocked {
+			result := as.deleteRows(as.identities(db).Where("idk IN ?", keys))
+			noteRows(ctx, result.RowsAffected)
+			return result.Error
+		}
+		return db.Transaction(func(tx *gorm.DB) error {
+			var locked int64
+			if err := as.identities(tx).Where("idk IN ? AND hardlock = ?", keys, true).Count(&locked).Error; err != nil {
+				return err
+			}
+			if locked > 0 {
+				return ErrIdentityHardlocked
+			}
+			result := as.deleteRows(as.identities(tx).Where("idk IN ?", keys))
+			noteRows(ctx, result.RowsAffected)
+			return result.Error
+		})
+	})
+}
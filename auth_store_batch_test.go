@@ -0,0 +1,344 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// countRows returns the number of rows in sqrl_identities, soft-deleted
+// ones included.
+func countRows(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Model(&identityRecord{}).Unscoped().Count(&n).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	return n
+}
+
+// batchOf returns n identities with keys prefix-0 .. prefix-(n-1).
+func batchOf(prefix string, n int) []*ssp.SqrlIdentity {
+	batch := make([]*ssp.SqrlIdentity, n)
+	for i := range batch {
+		batch[i] = newTestIdentity().withIdk(fmt.Sprintf("%s-%d", prefix, i)).withBtn(i % 4).build()
+	}
+	return batch
+}
+
+// TestSaveIdentities verifies a batch spanning several statements is stored
+// and that existing rows are updated in place.
+func TestSaveIdentities(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("batch-3").withSuk("old-suk").build())
+
+	batch := batchOf("batch", 2*DefaultBatchSize+5)
+	if err := store.SaveIdentities(batch); err != nil {
+		t.Fatalf("SaveIdentities: %v", err)
+	}
+	if got := countRows(t, db); got != int64(len(batch)) {
+		t.Errorf("stored %d rows, want %d", got, len(batch))
+	}
+	for _, i := range []int{0, 3, len(batch) - 1} {
+		found, err := store.FindIdentity(batch[i].Idk)
+		if err != nil {
+			t.Fatalf("FindIdentity(%s): %v", batch[i].Idk, err)
+		}
+		if *found != *batch[i] {
+			t.Errorf("row %d: got %+v, want %+v", i, *found, *batch[i])
+		}
+	}
+}
+
+// TestSaveIdentities_ValidationIndex verifies the first invalid identity is
+// reported with its index and nothing is written.
+func TestSaveIdentities_ValidationIndex(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+
+	tests := []struct {
+		name  string
+		bad   *ssp.SqrlIdentity
+		want  error
+		index int
+	}{
+		{"nil", nil, ErrNilIdentity, 2},
+		{"empty", newTestIdentity().withIdk("").build(), ErrEmptyIdentityKey, 2},
+		{"format", newTestIdentity().withIdk("bad idk").build(), ErrInvalidIdentityKeyFormat, 2},
+	}
+	for _, tt := range tests {
+		batch := batchOf("batch-invalid", 4)
+		batch[tt.index] = tt.bad
+		batch[3] = nil
+
+		err := store.SaveIdentities(batch)
+		var batchErr BatchError
+		if !errors.As(err, &batchErr) || batchErr.Index != tt.index || !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want BatchError at %d wrapping %v", tt.name, err, tt.index, tt.want)
+		}
+	}
+	if got := countRows(t, db); got != 0 {
+		t.Errorf("invalid batches wrote %d rows", got)
+	}
+}
+
+// TestSaveIdentities_DuplicateLastWins verifies a repeated idk keeps the last
+// occurrence, as successive SaveIdentity calls would.
+func TestSaveIdentities_DuplicateLastWins(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+
+	batch := []*ssp.SqrlIdentity{
+		newTestIdentity().withIdk("batch-dup").withSuk("first").build(),
+		newTestIdentity().withIdk("batch-other").build(),
+		newTestIdentity().withIdk("batch-dup").withSuk("last").build(),
+	}
+	if err := store.SaveIdentities(batch); err != nil {
+		t.Fatalf("SaveIdentities: %v", err)
+	}
+	found, err := store.FindIdentity("batch-dup")
+	if err != nil {
+		t.Fatalf("FindIdentity: %v", err)
+	}
+	if found.Suk != "last" {
+		t.Errorf("Suk = %q, want last", found.Suk)
+	}
+	if got := countRows(t, db); got != 2 {
+		t.Errorf("stored %d rows, want 2", got)
+	}
+}
+
+// TestSaveIdentities_RollsBackOnFailure verifies a failure in a later
+// statement leaves no row from earlier statements behind.
+func TestSaveIdentities_RollsBackOnFailure(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+
+	var creates int
+	err := db.Callback().Create().Before("gorm:create").Register("test:fail_second_batch", func(tx *gorm.DB) {
+		if creates++; creates == 2 {
+			_ = tx.AddError(errors.New("injected failure"))
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if err := store.SaveIdentities(batchOf("batch-rollback", DefaultBatchSize+1)); err == nil {
+		t.Fatal("expected the injected failure")
+	}
+	if got := countRows(t, db); got != 0 {
+		t.Errorf("failed batch left %d rows", got)
+	}
+}
+
+// TestSaveIdentitiesWithContext_Cancelled verifies a cancelled context
+// writes nothing, and an empty batch is a no-op.
+func TestSaveIdentitiesWithContext_Cancelled(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+
+	if err := store.SaveIdentitiesWithContext(context.Background(), nil); err != nil {
+		t.Errorf("empty batch: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.SaveIdentitiesWithContext(ctx, batchOf("batch-cancel", 3)); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+	if got := countRows(t, db); got != 0 {
+		t.Errorf("cancelled batch wrote %d rows", got)
+	}
+}
+
+// TestDeleteIdentities verifies one statement removes the listed keys,
+// tolerating duplicates and missing keys, and leaves the rest.
+func TestDeleteIdentities(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	if err := store.SaveIdentities(batchOf("del", 5)); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	var deletes int
+	err := db.Callback().Delete().Before("gorm:delete").Register("test:count_deletes", func(*gorm.DB) {
+		deletes++
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if err := store.DeleteIdentities([]string{"del-0", "del-2", "del-0", "del-missing"}); err != nil {
+		t.Fatalf("DeleteIdentities: %v", err)
+	}
+	if deletes != 1 {
+		t.Errorf("issued %d DELETE statements, want 1", deletes)
+	}
+	for _, idk := range []string{"del-0", "del-2"} {
+		if _, err := store.FindIdentity(idk); !errors.Is(err, ssp.ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got %v", idk, err)
+		}
+	}
+	if got := countRows(t, db); got != 3 {
+		t.Errorf("%d rows remain, want 3", got)
+	}
+	if err := store.DeleteIdentities(nil); err != nil {
+		t.Errorf("empty list: %v", err)
+	}
+}
+
+// TestDeleteIdentities_ValidationIndex verifies the first invalid key is
+// reported with its index and nothing is deleted.
+func TestDeleteIdentities_ValidationIndex(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("del-keep").build())
+
+	err := store.DeleteIdentities([]string{"del-keep", "bad idk", ""})
+	var batchErr BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("got %v, want BatchError at 1 wrapping ErrInvalidIdentityKeyFormat", err)
+	}
+	if got := countRows(t, db); got != 1 {
+		t.Errorf("invalid list deleted rows: %d remain", got)
+	}
+}
+
+// TestDeleteIdentities_TooLarge verifies a list longer than
+// MaxFindIdentities is refused whole.
+func TestDeleteIdentities_TooLarge(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("del-0").build())
+	idks := make([]string, MaxFindIdentities+1)
+	for i := range idks {
+		idks[i] = fmt.Sprintf("del-%d", i)
+	}
+
+	if err := store.DeleteIdentities(idks); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("expected ErrBatchTooLarge, got %v", err)
+	}
+	if got := countRows(t, db); got != 1 {
+		t.Errorf("oversized list deleted rows: %d remain", got)
+	}
+	if err := store.DeleteIdentities(idks[:MaxFindIdentities]); err != nil {
+		t.Errorf("MaxFindIdentities keys: %v", err)
+	}
+}
+
+// TestDeleteIdentities_ProtectHardlocked verifies a hardlocked key aborts
+// the whole delete.
+func TestDeleteIdentities_ProtectHardlocked(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithProtectHardlocked())
+	seedIdentity(t, store, newTestIdentity().withIdk("del-open").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("del-locked").withHardlock().build())
+
+	if err := store.DeleteIdentities([]string{"del-open", "del-locked"}); !errors.Is(err, ErrIdentityHardlocked) {
+		t.Errorf("expected ErrIdentityHardlocked, got %v", err)
+	}
+	if got := countRows(t, db); got != 2 {
+		t.Errorf("%d rows remain, want 2", got)
+	}
+	if err := store.DeleteIdentities([]string{"del-open"}); err != nil {
+		t.Errorf("unlocked key: %v", err)
+	}
+}
+
+// TestDeleteIdentitiesWithContext_Cancelled verifies a cancelled context
+// deletes nothing.
+func TestDeleteIdentitiesWithContext_Cancelled(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("del-cancel").build())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.DeleteIdentitiesWithContext(ctx, []string{"del-cancel"}); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+	if got := countRows(t, db); got != 1 {
+		t.Errorf("cancelled delete removed rows: %d remain", got)
+	}
+}
+
+// TestFindIdentities verifies one statement resolves the listed keys,
+// collapsing duplicates and leaving missing keys out of the result.
+func TestFindIdentities(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	if err := store.SaveIdentities(batchOf("find", 5)); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	var queries int
+	err := db.Callback().Query().Before("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries++
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	found, err := store.FindIdentities([]string{"find-1", "find-3", "find-1", "find-missing"})
+	if err != nil {
+		t.Fatalf("FindIdentities: %v", err)
+	}
+	if queries != 1 {
+		t.Errorf("issued %d queries, want 1", queries)
+	}
+	if len(found) != 2 {
+		t.Fatalf("found %d identities, want 2", len(found))
+	}
+	for _, idk := range []string{"find-1", "find-3"} {
+		if identity := found[idk]; identity == nil || identity.Idk != idk {
+			t.Errorf("%s: got %+v", idk, identity)
+		}
+	}
+	if found, err := store.FindIdentities(nil); err != nil || len(found) != 0 {
+		t.Errorf("empty list: got %v, %v", found, err)
+	}
+}
+
+// TestFindIdentities_Validation verifies the first invalid key is reported
+// with its index and an oversized list is refused.
+func TestFindIdentities_Validation(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+
+	_, err := store.FindIdentities([]string{"find-ok", "bad idk", ""})
+	var batchErr BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("got %v, want BatchError at 1 wrapping ErrInvalidIdentityKeyFormat", err)
+	}
+	idks := make([]string, MaxFindIdentities+1)
+	for i := range idks {
+		idks[i] = fmt.Sprintf("find-%d", i)
+	}
+	if _, err := store.FindIdentities(idks); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("expected ErrBatchTooLarge, got %v", err)
+	}
+	if _, err := store.FindIdentities(idks[:MaxFindIdentities]); err != nil {
+		t.Errorf("MaxFindIdentities keys: %v", err)
+	}
+}
+
+// TestFindIdentities_IdkPepper verifies results are keyed by the caller's
+// key rather than the peppered one stored.
+func TestFindIdentities_IdkPepper(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithIdkPepper(testKey(IdkPepperMinSize, 1)))
+	seedIdentity(t, store, newTestIdentity().withIdk("find-pep").build())
+
+	found, err := store.FindIdentities([]string{"find-pep"})
+	if err != nil {
+		t.Fatalf("FindIdentities: %v", err)
+	}
+	if identity := found["find-pep"]; identity == nil || identity.Idk != "find-pep" {
+		t.Errorf("got %v", found)
+	}
+}
+
+// TestFindIdentitiesWithContext_Cancelled verifies a cancelled context
+// returns an error.
+func TestFindIdentitiesWithContext_Cancelled(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("find-cancel").build())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.FindIdentitiesWithContext(ctx, []string{"find-cancel"}); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
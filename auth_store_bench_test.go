@@ -144,3 +144,38 @@ func BenchmarkFindIdentity_Concurrent(b *testing.B) {
 		}
 	})
 }
+
+// PERF-007: Benchmark bulk insert of benchBulkSize identities at varying
+// batch sizes, to find where larger batches stop paying off. Each batch is
+// one multi-row upsert using the same column set and conflict clause as
+// SaveIdentity, which is the statement SaveIdentities issues.
+func BenchmarkSaveIdentities(b *testing.B) {
+	const benchBulkSize = 1000
+
+	for _, batchSize := range []int{1, 100, 1000} {
+		b.Run(fmt.Sprintf("batch=%d", batchSize), func(b *testing.B) {
+			store := benchStore(b)
+			db := upsert(store.db)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				records := make([]*identityRecord, benchBulkSize)
+				for j := range records {
+					records[j] = toRecord(&ssp.SqrlIdentity{
+						Idk: fmt.Sprintf("bench-bulk-%d-%d", i, j),
+						Suk: "suk",
+						Vuk: "vuk",
+					})
+				}
+				b.StartTimer()
+
+				if err := db.CreateInBatches(records, batchSize).Error; err != nil {
+					b.Fatalf("bulk insert failed: %v", err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*benchBulkSize), "ns/identity")
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IncrementBtn adds delta to the Btn count of the identity idk and returns
+// the new value. The increment is a single UPDATE ... SET btn = btn + delta,
+// so concurrent callers never lose one another's increments as a
+// FindIdentity and SaveIdentity would. The new value comes back with
+// RETURNING where the database supports it on UPDATE (PostgreSQL, SQLite
+// 3.35+); elsewhere, and under WithIntegrityKey, which must re-sign the row,
+// it is re-read in the same transaction.
+//
+// Returns ssp.ErrNotFound if the identity does not exist. The identity's
+// version is bumped, so under WithOptimisticLocking a copy read before the
+// increment is stale.
+func (as *AuthStore) IncrementBtn(idk string, delta int) (int, error) {
+	return as.IncrementBtnWithContext(as.baseContext(), idk, delta)
+}
+
+// IncrementBtnWithContext is IncrementBtn with context support for timeout
+// and cancellation control.
+func (as *AuthStore) IncrementBtnWithContext(ctx context.Context, idk string, delta int) (_ int, err error) {
+	ctx, done := as.observe(ctx, "IncrementBtn", idk, &err)
+	defer done()
+	if err := as.validateIdk(idk); err != nil {
+		return 0, err
+	}
+	key := as.lookupKey(idk)
+	record := &identityRecord{}
+	defer clearRecord(record)
+	err = as.run(ctx, opWriteOnce, func(db *gorm.DB) error {
+		increment := map[string]interface{}{
+			"btn": gorm.Expr("btn + ?", delta), "version": gorm.Expr("version + 1"), "updated_at": as.now(),
+		}
+		if as.cfg.integrityKey == nil && as.canUpdateReturning(db) {
+			record.Idk = key
+			result := as.identities(db).Model(record).
+				Clauses(clause.Returning{Columns: []clause.Column{{Name: "btn"}}}).Updates(increment)
+			if result.Error == nil && result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return result.Error
+		}
+		return db.Transaction(func(tx *gorm.DB) error {
+			result := as.identities(tx).Where("idk = ?", key).Updates(increment)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			if err := as.identities(tx).Where("idk = ?", key).Take(record).Error; err != nil {
+				return err
+			}
+			if as.cfg.integrityKey == nil {
+				return nil
+			}
+			// The row is still signed with its count before the increment.
+			record.Btn -= delta
+			if err := as.verifyRecord(record); err != nil {
+				return err
+			}
+			record.Btn += delta
+			as.signRecord(record)
+			return as.identities(tx).Where("idk = ?", key).Update("mac", record.Mac).Error
+		})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ssp.ErrNotFound
+		}
+		return 0, err
+	}
+	return record.Btn, nil
+}
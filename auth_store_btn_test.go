@@ -0,0 +1,83 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// TestIncrementBtn verifies the new count is returned and stored, with and
+// without an integrity key re-signing the row.
+func TestIncrementBtn(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":     nil,
+		"integrity": {WithIntegrityKey(testKey(IntegrityKeyMinSize, 1))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, store := newTestStoreWithOptions(t, opts...)
+			seedIdentity(t, store, newTestIdentity().withIdk("btn-idk").withBtn(2).build())
+
+			if btn, err := store.IncrementBtn("btn-idk", 3); err != nil || btn != 5 {
+				t.Fatalf("IncrementBtn: got %d, %v, want 5", btn, err)
+			}
+			if btn, err := store.IncrementBtnWithContext(context.Background(), "btn-idk", -1); err != nil || btn != 4 {
+				t.Fatalf("negative delta: got %d, %v, want 4", btn, err)
+			}
+			if found, err := store.FindIdentity("btn-idk"); err != nil || found.Btn != 4 {
+				t.Errorf("FindIdentity: got %+v, %v, want Btn 4", found, err)
+			}
+		})
+	}
+}
+
+// TestIncrementBtn_Errors verifies a missing identity and an invalid key.
+func TestIncrementBtn_Errors(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	if _, err := store.IncrementBtn("btn-missing", 1); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("missing identity: expected ssp.ErrNotFound, got %v", err)
+	}
+	if _, err := store.IncrementBtn("bad idk", 1); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("invalid key: expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+}
+
+// TestIncrementBtn_Concurrent verifies no increment is lost when many
+// goroutines increment the same identity.
+func TestIncrementBtn_Concurrent(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":     nil,
+		"integrity": {WithIntegrityKey(testKey(IntegrityKeyMinSize, 1))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, store := newTestStoreWithOptions(t, opts...)
+			seedIdentity(t, store, newTestIdentity().withIdk("btn-race").build())
+
+			const workers, increments = 10, 20
+			var wg sync.WaitGroup
+			errs := make(chan error, workers*increments)
+			wg.Add(workers)
+			for i := 0; i < workers; i++ {
+				go func() {
+					defer wg.Done()
+					for j := 0; j < increments; j++ {
+						if _, err := store.IncrementBtn("btn-race", 1); err != nil {
+							errs <- err
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Errorf("unexpected increment error: %v", err)
+			}
+			if found, err := store.FindIdentity("btn-race"); err != nil || found.Btn != workers*increments {
+				t.Errorf("final count: got %+v, %v, want Btn %d", found, err, workers*increments)
+			}
+		})
+	}
+}
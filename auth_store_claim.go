@@ -0,0 +1,71 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ClaimAndDisable atomically claims a single-use identity: it reads the
+// identity under a row lock, disables it and returns it, so of any number of
+// concurrent callers exactly one succeeds. The returned identity reflects the
+// stored state after the claim, with Disabled set.
+//
+// Returns ErrIdentityDisabled if the identity was already disabled (claimed)
+// and ssp.ErrNotFound if it does not exist.
+func (as *AuthStore) ClaimAndDisable(ctx context.Context, idk string) (_ *ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "ClaimAndDisable", idk, &err)
+	defer done()
+	if err := as.validateIdk(idk); err != nil {
+		return nil, err
+	}
+	key := as.lookupKey(idk)
+	record := &identityRecord{}
+	defer clearRecord(record)
+	err = as.run(ctx, opWriteOnce, func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			err := as.identities(tx).Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+				Where("idk = ?", key).First(record).Error
+			if err != nil {
+				return err
+			}
+			if err := as.verifyRecord(record); err != nil {
+				return err
+			}
+			if record.Disabled {
+				return ErrIdentityDisabled
+			}
+			record.Disabled = true
+			record.UpdatedAt = as.now()
+			as.signRecord(record)
+			// The disabled = false guard keeps the claim exclusive on
+			// databases that ignore FOR UPDATE, such as SQLite.
+			result := as.identities(tx).
+				Where("idk = ? AND disabled = ?", key, false).
+				Updates(map[string]interface{}{
+					"disabled": true, "mac": record.Mac, "version": gorm.Expr("version + 1"), "updated_at": record.UpdatedAt,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrIdentityDisabled
+			}
+			record.Version++
+			return nil
+		})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ssp.ErrNotFound
+		}
+		return nil, err
+	}
+	record.Idk = idk
+	claimed := toIdentity(record)
+	as.trackVersion(claimed, record.Version)
+	return claimed, nil
+}
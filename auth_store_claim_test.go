@@ -0,0 +1,90 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// TestClaimAndDisable verifies a claim disables the identity and a second
+// claim is refused.
+func TestClaimAndDisable(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("claim-once").withBtn(2).build())
+
+	claimed, err := store.ClaimAndDisable(context.Background(), "claim-once")
+	if err != nil {
+		t.Fatalf("ClaimAndDisable failed: %v", err)
+	}
+	if !claimed.Disabled || claimed.Btn != 2 {
+		t.Errorf("claimed identity: got %+v, want Disabled and Btn 2", *claimed)
+	}
+
+	found, err := store.FindIdentity("claim-once")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if !found.Disabled {
+		t.Error("identity not disabled in the database")
+	}
+
+	if _, err := store.ClaimAndDisable(context.Background(), "claim-once"); !errors.Is(err, ErrIdentityDisabled) {
+		t.Errorf("second claim: expected ErrIdentityDisabled, got %v", err)
+	}
+}
+
+// TestClaimAndDisable_NotFoundAndInvalid verifies missing and invalid keys.
+func TestClaimAndDisable_NotFoundAndInvalid(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+
+	if _, err := store.ClaimAndDisable(context.Background(), "claim-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("missing: expected ssp.ErrNotFound, got %v", err)
+	}
+	if _, err := store.ClaimAndDisable(context.Background(), ""); !errors.Is(err, ErrEmptyIdentityKey) {
+		t.Errorf("empty: expected ErrEmptyIdentityKey, got %v", err)
+	}
+}
+
+// TestClaimAndDisable_Concurrent verifies exactly one of many concurrent
+// claims succeeds.
+func TestClaimAndDisable_Concurrent(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("claim-race").build())
+
+	const claimers = 20
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		successes int
+	)
+	errs := make(chan error, claimers)
+
+	wg.Add(claimers)
+	for i := 0; i < claimers; i++ {
+		go func() {
+			defer wg.Done()
+			_, err := store.ClaimAndDisable(context.Background(), "claim-race")
+			switch {
+			case err == nil:
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			case !errors.Is(err, ErrIdentityDisabled):
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected claim error: %v", err)
+	}
+	if successes != 1 {
+		t.Errorf("successful claims: got %d, want 1", successes)
+	}
+}
@@ -1,8 +1,10 @@
 package gormauthstore
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -486,3 +488,791 @@ func TestToRecord_ToIdentity_RoundTrip(t *testing.T) {
 		t.Errorf("Btn: got %d, want %d", result.Btn, original.Btn)
 	}
 }
+
+// idkIndexCount returns the number of indexes covering the idk column of
+// sqrl_identities, using the catalogue query appropriate to the dialect.
+func idkIndexCount(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+	var query string
+	switch db.Dialector.Name() {
+	case "sqlite":
+		query = `SELECT COUNT(*) FROM pragma_index_list('sqrl_identities') AS il
+			JOIN pragma_index_info(il.name) AS ii WHERE ii.name = 'idk'`
+	case "postgres":
+		query = `SELECT COUNT(*) FROM pg_indexes
+			WHERE tablename = 'sqrl_identities' AND indexdef LIKE '%(idk)%'`
+	case "mysql":
+		query = `SELECT COUNT(*) FROM information_schema.statistics
+			WHERE table_schema = DATABASE() AND table_name = 'sqrl_identities' AND column_name = 'idk'`
+	default:
+		t.Skipf("index catalogue query not implemented for dialect %q", db.Dialector.Name())
+	}
+	var count int64
+	if err := db.Raw(query).Scan(&count).Error; err != nil {
+		t.Fatalf("index catalogue query failed: %v", err)
+	}
+	return count
+}
+
+// TC-028: AutoMigrate leaves an index on the idk column used by every lookup.
+func TestAutoMigrate_IdkIndexed(t *testing.T) {
+	db, _ := newTestStoreWithDB(t)
+
+	if count := idkIndexCount(t, db); count < 1 {
+		t.Errorf("no index covers sqrl_identities.idk; lookups would degrade to scans")
+	}
+}
+
+// TC-029: identityRecord declares idk as its primary key.
+func TestIdentityRecord_IdkIsPrimaryKey(t *testing.T) {
+	db := openTestDB(t)
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&identityRecord{}); err != nil {
+		t.Fatalf("failed to parse identityRecord schema: %v", err)
+	}
+
+	field := stmt.Schema.LookUpField("idk")
+	if field == nil {
+		t.Fatal("identityRecord has no idk column")
+	}
+	if !field.PrimaryKey && !field.Unique {
+		t.Error("idk must be declared primaryKey or uniqueIndex")
+	}
+	if len(stmt.Schema.PrimaryFields) != 1 || stmt.Schema.PrimaryFields[0].DBName != "idk" {
+		t.Errorf("expected idk as the sole primary key, got %d primary fields", len(stmt.Schema.PrimaryFields))
+	}
+}
+
+// TC-030: FindActiveIdentity returns an enabled identity.
+func TestFindActiveIdentity_Enabled(t *testing.T) {
+	store := newTestStore(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("tc030-active").build())
+
+	found, err := store.FindActiveIdentity(context.Background(), "tc030-active")
+	if err != nil {
+		t.Fatalf("FindActiveIdentity failed: %v", err)
+	}
+	if found.Idk != "tc030-active" {
+		t.Errorf("Idk mismatch: got %q", found.Idk)
+	}
+}
+
+// TC-031: FindActiveIdentity rejects a disabled identity with ErrIdentityDisabled.
+func TestFindActiveIdentity_Disabled(t *testing.T) {
+	store := newTestStore(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("tc031-disabled").withDisabled().build())
+
+	found, err := store.FindActiveIdentity(context.Background(), "tc031-disabled")
+	if !errors.Is(err, ErrIdentityDisabled) {
+		t.Fatalf("expected ErrIdentityDisabled, got %v", err)
+	}
+	if found != nil {
+		t.Error("expected nil identity for disabled account")
+	}
+}
+
+// TC-032: FindActiveIdentity returns ssp.ErrNotFound and validates input.
+func TestFindActiveIdentity_NotFoundAndInvalid(t *testing.T) {
+	store := newTestStore(t)
+
+	if _, err := store.FindActiveIdentity(context.Background(), "tc032-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("expected ssp.ErrNotFound, got %v", err)
+	}
+	if _, err := store.FindActiveIdentity(context.Background(), "bad key!"); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+}
+
+// TC-033: Updating one field through SaveIdentity leaves every other field intact.
+func TestSaveIdentity_UpdateDoesNotClobberOtherFields(t *testing.T) {
+	store := newTestStore(t)
+
+	identity := newTestIdentity().
+		withIdk("tc033-partial").
+		withSuk("suk-v1").
+		withVuk("vuk-v1").
+		withPidk("tc033-prev").
+		withSQRLOnly().
+		withHardlock().
+		withRekeyed("tc033-next").
+		withBtn(3).
+		build()
+	seedIdentity(t, store, identity)
+
+	found, err := store.FindIdentity("tc033-partial")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	found.Suk = "suk-v2"
+	if err := store.SaveIdentity(found); err != nil {
+		t.Fatalf("SaveIdentity (update) failed: %v", err)
+	}
+
+	updated, err := store.FindIdentity("tc033-partial")
+	if err != nil {
+		t.Fatalf("FindIdentity after update failed: %v", err)
+	}
+	want := *identity
+	want.Suk = "suk-v2"
+	if *updated != want {
+		t.Errorf("fields clobbered by update:\n got %+v\nwant %+v", *updated, want)
+	}
+}
+
+// TC-034: SaveIdentity writes exactly the identity columns via an upsert.
+func TestSaveIdentity_ExplicitColumnSet(t *testing.T) {
+	db, store := newTestStoreWithDB(t)
+
+	var sql string
+	err := db.Callback().Create().After("gorm:create").Register("test:capture_sql", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	seedIdentity(t, store, newTestIdentity().withIdk("tc034-columns").build())
+
+	for _, column := range append([]string{"idk"}, identityColumns...) {
+		if !strings.Contains(sql, "`"+column+"`") {
+			t.Errorf("INSERT does not write column %q: %s", column, sql)
+		}
+	}
+	if !strings.Contains(sql, "ON CONFLICT") {
+		t.Errorf("expected an upsert, got: %s", sql)
+	}
+}
+
+// TC-035: SaveAndReload returns the stored row and persists it.
+func TestSaveAndReload_ReturnsStoredRow(t *testing.T) {
+	store := newTestStore(t)
+
+	identity := newTestIdentity().withIdk("tc035-reload").withPidk("tc035-prev").withBtn(2).build()
+	stored, err := store.SaveAndReload(context.Background(), identity)
+	if err != nil {
+		t.Fatalf("SaveAndReload failed: %v", err)
+	}
+	if stored == identity {
+		t.Error("SaveAndReload returned the caller's identity, want a fresh copy")
+	}
+	if *stored != *identity {
+		t.Errorf("stored row mismatch:\n got %+v\nwant %+v", *stored, *identity)
+	}
+
+	found, err := store.FindIdentity("tc035-reload")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("persisted row mismatch:\n got %+v\nwant %+v", *found, *identity)
+	}
+}
+
+// TC-036: SaveAndReload uses RETURNING instead of a second query on SQLite.
+func TestSaveAndReload_UsesReturning(t *testing.T) {
+	db, store := newTestStoreWithDB(t)
+
+	var queries int
+	err := db.Callback().Query().Before("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries++
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	var sql string
+	err = db.Callback().Create().After("gorm:create").Register("test:capture_returning", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if _, err := store.SaveAndReload(context.Background(), newTestIdentity().withIdk("tc036-returning").build()); err != nil {
+		t.Fatalf("SaveAndReload failed: %v", err)
+	}
+	if !strings.Contains(sql, "RETURNING") {
+		t.Errorf("expected RETURNING clause, got: %s", sql)
+	}
+	if queries != 0 {
+		t.Errorf("expected no follow-up query, got %d", queries)
+	}
+}
+
+// TC-037: SaveAndReload validates the identity before touching the database.
+func TestSaveAndReload_InvalidIdentity(t *testing.T) {
+	store := newTestStore(t)
+
+	if _, err := store.SaveAndReload(context.Background(), nil); !errors.Is(err, ErrNilIdentity) {
+		t.Errorf("nil identity: expected ErrNilIdentity, got %v", err)
+	}
+	if _, err := store.SaveAndReload(context.Background(), newTestIdentity().withIdk("").build()); !errors.Is(err, ErrEmptyIdentityKey) {
+		t.Errorf("empty idk: expected ErrEmptyIdentityKey, got %v", err)
+	}
+}
+
+// TC-038: WithSession scopes GORM session settings to the returned copy.
+func TestWithSession_ScopedToCopy(t *testing.T) {
+	db, store := newTestStoreWithDB(t)
+
+	fast := store.WithSession(&gorm.Session{SkipDefaultTransaction: true})
+	if fast == store {
+		t.Fatal("WithSession returned the original store")
+	}
+	if !fast.db.SkipDefaultTransaction {
+		t.Error("session setting not applied to the copy")
+	}
+	if store.db != db || store.db.SkipDefaultTransaction {
+		t.Error("WithSession modified the original store")
+	}
+
+	identity := newTestIdentity().withIdk("tc038-session").build()
+	if err := fast.SaveIdentity(identity); err != nil {
+		t.Fatalf("SaveIdentity via session copy failed: %v", err)
+	}
+	if _, err := store.FindIdentity("tc038-session"); err != nil {
+		t.Errorf("identity saved via session copy not visible to original: %v", err)
+	}
+}
+
+// TC-039: WithSession with a nil session returns the store unchanged.
+func TestWithSession_Nil(t *testing.T) {
+	store := newTestStore(t)
+	if got := store.WithSession(nil); got != store {
+		t.Error("WithSession(nil) should return the store itself")
+	}
+}
+
+// newPreparedStmtStore creates a private AuthStore with GORM's PrepareStmt enabled.
+func newPreparedStmtStore(t *testing.T) (*gorm.DB, *AuthStore) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:testdb-%d?mode=memory&cache=shared", testDBSeq.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{PrepareStmt: true})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get underlying sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	store := NewAuthStore(db)
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+	return db, store
+}
+
+// TC-040: Operations keep working after a migration with a warm statement cache.
+func TestPreparedStmt_MigrationAfterCacheWarm(t *testing.T) {
+	db, store := newPreparedStmtStore(t)
+
+	seedIdentity(t, store, newTestIdentity().withIdk("tc040-warm").build())
+	if _, err := store.FindIdentity("tc040-warm"); err != nil {
+		t.Fatalf("FindIdentity (warm) failed: %v", err)
+	}
+
+	if err := db.Exec("ALTER TABLE sqrl_identities ADD COLUMN tc040_extra TEXT").Error; err != nil {
+		t.Fatalf("add column: %v", err)
+	}
+
+	if _, err := store.FindIdentity("tc040-warm"); err != nil {
+		t.Errorf("FindIdentity after migration failed: %v", err)
+	}
+	seedIdentity(t, store, newTestIdentity().withIdk("tc040-warm").withBtn(1).build())
+}
+
+// TC-041: A stale prepared-statement error resets the cache and retries once.
+func TestPreparedStmt_StaleStatementRetried(t *testing.T) {
+	db, store := newPreparedStmtStore(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("tc041-stale").build())
+
+	attempts := 0
+	err := db.Callback().Query().Before("gorm:query").Register("test:stale_stmt", func(tx *gorm.DB) {
+		attempts++
+		if attempts == 1 {
+			_ = tx.AddError(errors.New("ERROR: cached plan must not change result type (SQLSTATE 0A000)"))
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if _, err := store.FindIdentity("tc041-stale"); err != nil {
+		t.Fatalf("FindIdentity should succeed after retry, got %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts: got %d, want 2", attempts)
+	}
+}
+
+// TC-042: Without PrepareStmt, a stale-statement error is returned unretried.
+func TestPreparedStmt_NoRetryWithoutCache(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("tc042-plain").build())
+
+	stale := errors.New("prepared statement needs to be re-prepared")
+	attempts := 0
+	err := store.run(context.Background(), opRead, func(*gorm.DB) error {
+		attempts++
+		return stale
+	})
+	if !errors.Is(err, stale) || attempts != 1 {
+		t.Errorf("got err=%v attempts=%d, want stale error after 1 attempt", err, attempts)
+	}
+}
+
+// TC-043: FindIdentity results are independent copies owned by the caller.
+func TestFindIdentity_ReturnsIndependentCopy(t *testing.T) {
+	store := newTestStore(t)
+
+	identity := newTestIdentity().withIdk("tc043-copy").withSuk("tc043-suk").build()
+	seedIdentity(t, store, identity)
+
+	first, err := store.FindIdentity("tc043-copy")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	second, err := store.FindIdentity("tc043-copy")
+	if err != nil {
+		t.Fatalf("second FindIdentity failed: %v", err)
+	}
+	if second == first {
+		t.Fatal("FindIdentity returned the same pointer twice")
+	}
+	first.Disabled = true
+	first.Btn = 9
+	ClearIdentity(first)
+
+	if *second != *identity {
+		t.Errorf("mutating one result affected another:\n got %+v\nwant %+v", *second, *identity)
+	}
+	third, err := store.FindIdentity("tc043-copy")
+	if err != nil || *third != *identity {
+		t.Errorf("mutating a result affected the store: got %+v, %v", third, err)
+	}
+}
+
+// TC-054: Every read path returns identities independent of one another
+// and of the caller's input: wiping one result leaves the next read of the
+// same identity intact.
+func TestReadPaths_ReturnIndependentCopies(t *testing.T) {
+	ctx := context.Background()
+	_, store := newTestStoreWithOptions(t)
+	identity := newTestIdentity().withIdk("tc054-idk").withSuk("tc054-suk").build()
+	seedIdentity(t, store, identity)
+
+	reads := map[string]func() (*ssp.SqrlIdentity, error){
+		"FindIdentity": func() (*ssp.SqrlIdentity, error) { return store.FindIdentity("tc054-idk") },
+		"FindIdentitySecure": func() (*ssp.SqrlIdentity, error) {
+			wrapper, err := store.FindIdentitySecure("tc054-idk")
+			if err != nil {
+				return nil, err
+			}
+			return wrapper.GetIdentity(), nil
+		},
+		"FindActiveIdentity": func() (*ssp.SqrlIdentity, error) { return store.FindActiveIdentity(ctx, "tc054-idk") },
+		"FindIdentities": func() (*ssp.SqrlIdentity, error) {
+			found, err := store.FindIdentities([]string{"tc054-idk"})
+			return found["tc054-idk"], err
+		},
+		"ListIdentities": func() (*ssp.SqrlIdentity, error) {
+			page, err := store.ListIdentities(0, 1)
+			if err != nil || len(page) != 1 {
+				return nil, err
+			}
+			return page[0], nil
+		},
+		"GetRekeyChain": func() (*ssp.SqrlIdentity, error) {
+			chain, err := store.GetRekeyChain("tc054-idk")
+			if err != nil || len(chain) != 1 {
+				return nil, err
+			}
+			return chain[0], nil
+		},
+		"FindOrCreateIdentity": func() (*ssp.SqrlIdentity, error) {
+			found, _, err := store.FindOrCreateIdentity(identity)
+			return found, err
+		},
+	}
+	for name, read := range reads {
+		t.Run(name, func(t *testing.T) {
+			first, err := read()
+			if err != nil || first == nil {
+				t.Fatalf("first read: got %v, %v", first, err)
+			}
+			second, err := read()
+			if err != nil || second == nil {
+				t.Fatalf("second read: got %v, %v", second, err)
+			}
+			if first == second || first == identity {
+				t.Fatal("read returned a shared pointer")
+			}
+			ClearIdentity(first)
+			if *second != *identity {
+				t.Errorf("wiping one result affected another:\n got %+v\nwant %+v", *second, *identity)
+			}
+		})
+	}
+}
+
+// TC-044: toRecord/toIdentity round-trip every exported ssp.SqrlIdentity
+// field, so a field added upstream cannot be silently dropped on save.
+func TestRecordMapping_CoversAllIdentityFields(t *testing.T) {
+	identity := &ssp.SqrlIdentity{}
+	v := reflect.ValueOf(identity).Elem()
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString("tc044-" + strings.ToLower(field.Name))
+		case reflect.Bool:
+			fv.SetBool(true)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			fv.SetInt(int64(i + 1))
+		default:
+			t.Fatalf("field %s has kind %s; extend this test and the record mapping", field.Name, fv.Kind())
+		}
+	}
+
+	got := reflect.ValueOf(toIdentity(toRecord(identity))).Elem()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(got.Field(i).Interface(), v.Field(i).Interface()) {
+			t.Errorf("field %s not mapped by toRecord/toIdentity: got %v, want %v",
+				field.Name, got.Field(i).Interface(), v.Field(i).Interface())
+		}
+	}
+}
+
+// TC-045: ExistsIdentity reports presence without selecting key material.
+func TestExistsIdentity(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("tc045-present").build())
+
+	var sql string
+	err := db.Callback().Query().After("gorm:query").Register("test:capture_exists", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if ok, err := store.ExistsIdentity("tc045-present"); err != nil || !ok {
+		t.Errorf("present: got %v, %v; want true, nil", ok, err)
+	}
+	if strings.Contains(sql, "suk") || strings.Contains(sql, "vuk") {
+		t.Errorf("query selected key material: %s", sql)
+	}
+	if ok, err := store.ExistsIdentityWithContext(context.Background(), "tc045-absent"); err != nil || ok {
+		t.Errorf("absent: got %v, %v; want false, nil", ok, err)
+	}
+	if _, err := store.ExistsIdentity("bad idk"); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("invalid: expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+}
+
+// TC-046: FindIdentityByPidk resolves a unique successor and refuses to
+// guess between several.
+func TestFindIdentityByPidk(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	successor := newTestIdentity().withIdk("tc046-new").withPidk("tc046-old").withBtn(1).build()
+	seedIdentity(t, store, successor)
+
+	found, err := store.FindIdentityByPidk("tc046-old")
+	if err != nil {
+		t.Fatalf("FindIdentityByPidk: %v", err)
+	}
+	if *found != *successor {
+		t.Errorf("got %+v, want %+v", *found, *successor)
+	}
+	if _, err := store.FindIdentityByPidkWithContext(context.Background(), "tc046-none"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("no match: expected ssp.ErrNotFound, got %v", err)
+	}
+	if _, err := store.FindIdentityByPidk(""); !errors.Is(err, ErrEmptyIdentityKey) {
+		t.Errorf("empty: expected ErrEmptyIdentityKey, got %v", err)
+	}
+
+	seedIdentity(t, store, newTestIdentity().withIdk("tc046-dup").withPidk("tc046-old").build())
+	if _, err := store.FindIdentityByPidk("tc046-old"); !errors.Is(err, ErrAmbiguousPidk) {
+		t.Errorf("two matches: expected ErrAmbiguousPidk, got %v", err)
+	}
+}
+
+// TC-047: A store built on a nil *gorm.DB returns ErrNilDatabase from every
+// operation instead of panicking.
+func TestNilDatabase_ReturnsErrNilDatabase(t *testing.T) {
+	store := NewAuthStore(nil)
+	ctx := context.Background()
+	identity := newTestIdentity().withIdk("tc047-nil").build()
+
+	ops := map[string]func() error{
+		"FindIdentity": func() error {
+			_, err := store.FindIdentity("tc047-nil")
+			return err
+		},
+		"FindIdentitySecure": func() error {
+			_, err := store.FindIdentitySecure("tc047-nil")
+			return err
+		},
+		"SaveIdentity":   func() error { return store.SaveIdentity(identity) },
+		"DeleteIdentity": func() error { return store.DeleteIdentity("tc047-nil") },
+		"AutoMigrate":    func() error { return store.AutoMigrate() },
+		"SaveIdentities": func() error { return store.SaveIdentities([]*ssp.SqrlIdentity{identity}) },
+		"ListIdentities": func() error {
+			_, err := store.ListIdentities(0, 10)
+			return err
+		},
+		"CountIdentities": func() error {
+			_, err := store.CountIdentities()
+			return err
+		},
+		"EachIdentity": func() error {
+			return store.EachIdentity(ctx, func(*ssp.SqrlIdentity) error { return nil })
+		},
+		"SelfTest": func() error { return store.SelfTest(ctx) },
+		"WithSession": func() error {
+			return store.WithSession(&gorm.Session{}).SaveIdentity(identity)
+		},
+	}
+	for name, op := range ops {
+		t.Run(name, func(t *testing.T) {
+			if err := op(); !errors.Is(err, ErrNilDatabase) {
+				t.Errorf("expected ErrNilDatabase, got %v", err)
+			}
+		})
+	}
+}
+
+// TC-048: WithTx runs store operations in the caller's transaction, so an
+// outer rollback discards them and a commit keeps them.
+func TestWithTx_JoinsOuterTransaction(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	errAbort := errors.New("abort")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		txStore := store.WithTx(tx)
+		if err := txStore.SaveIdentity(newTestIdentity().withIdk("tc048-rolled-back").build()); err != nil {
+			return err
+		}
+		if _, err := txStore.FindIdentity("tc048-rolled-back"); err != nil {
+			t.Errorf("save not visible inside the transaction: %v", err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected the outer error, got %v", err)
+	}
+	if _, err := store.FindIdentity("tc048-rolled-back"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("rolled-back save survived: %v", err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		txStore := store.WithTx(tx)
+		if err := txStore.SaveIdentity(&ssp.SqrlIdentity{Idk: "bad idk"}); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+			t.Errorf("validation must run before SQL, got %v", err)
+		}
+		return txStore.SaveIdentities(batchOf("tc048-committed", 3))
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if n := countRows(t, db); n != 3 {
+		t.Errorf("rows after commit: got %d, want 3", n)
+	}
+	if got := store.WithTx(nil); got.db != nil || got.SaveIdentity(newTestIdentity().build()) != ErrNilDatabase {
+		t.Error("WithTx(nil) must yield a store returning ErrNilDatabase")
+	}
+}
+
+// TC-049: Transaction rolls back every write when fn fails or panics
+// partway, releasing its connection, and commits them when it returns nil.
+func TestTransaction_AllOrNothing(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	errSecond := errors.New("second save failed")
+
+	err := store.Transaction(func(tx *AuthStore) error {
+		if err := tx.SaveIdentity(newTestIdentity().withIdk("tc049-first").build()); err != nil {
+			return err
+		}
+		if err := tx.SaveIdentity(newTestIdentity().withIdk("tc049-second").build()); err != nil {
+			return err
+		}
+		return errSecond
+	})
+	if !errors.Is(err, errSecond) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("rows after failed transaction: got %d, want 0", n)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic in fn was swallowed")
+			}
+		}()
+		_ = store.Transaction(func(tx *AuthStore) error {
+			if err := tx.SaveIdentity(newTestIdentity().withIdk("tc049-panic").build()); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+	if inUse := store.Stats().InUse; inUse != 0 {
+		t.Errorf("connections in use after panicking transaction: got %d, want 0", inUse)
+	}
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("rows after panicking transaction: got %d, want 0", n)
+	}
+
+	err = store.TransactionWithContext(context.Background(), func(tx *AuthStore) error {
+		return tx.SaveIdentities(batchOf("tc049-commit", 2))
+	})
+	if err != nil {
+		t.Fatalf("TransactionWithContext failed: %v", err)
+	}
+	if n := countRows(t, db); n != 2 {
+		t.Errorf("rows after commit: got %d, want 2", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err = store.TransactionWithContext(ctx, func(*AuthStore) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || called {
+		t.Errorf("cancelled context: got err %v, fn called %v", err, called)
+	}
+	if err := NewAuthStore(nil).Transaction(func(*AuthStore) error { return nil }); !errors.Is(err, ErrNilDatabase) {
+		t.Errorf("nil db: expected ErrNilDatabase, got %v", err)
+	}
+}
+
+// TC-050: SaveIdentityInsertOnly creates a new identity and refuses a key in
+// use, by a live or soft-deleted row, with ErrDuplicateIdentity wrapping the
+// driver error.
+func TestSaveIdentityInsertOnly(t *testing.T) {
+	ctx := context.Background()
+	for name, opts := range map[string][]Option{
+		"plain":       nil,
+		"soft delete": {WithSoftDelete()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, store := newTestStoreWithOptions(t, opts...)
+			identity := newTestIdentity().withIdk("tc050-new").withBtn(1).build()
+			if err := store.SaveIdentityInsertOnly(ctx, identity); err != nil {
+				t.Fatalf("SaveIdentityInsertOnly failed: %v", err)
+			}
+			if found, err := store.FindIdentity("tc050-new"); err != nil || *found != *identity {
+				t.Fatalf("FindIdentity: got %+v, %v, want %+v", found, err, *identity)
+			}
+
+			err := store.SaveIdentityInsertOnly(ctx, newTestIdentity().withIdk("tc050-new").withBtn(2).build())
+			if !errors.Is(err, ErrDuplicateIdentity) || errors.Unwrap(err) == nil {
+				t.Fatalf("existing key: expected ErrDuplicateIdentity wrapping the driver error, got %v", err)
+			}
+			if found, err := store.FindIdentity("tc050-new"); err != nil || found.Btn != 1 {
+				t.Errorf("existing row was changed: got %+v, %v", found, err)
+			}
+
+			if err := store.DeleteIdentity("tc050-new"); err != nil {
+				t.Fatalf("DeleteIdentity failed: %v", err)
+			}
+			err = store.SaveIdentityInsertOnly(ctx, identity)
+			if soft := len(opts) > 0; soft != errors.Is(err, ErrDuplicateIdentity) || (!soft && err != nil) {
+				t.Errorf("after delete: got %v", err)
+			}
+		})
+	}
+}
+
+// TC-051: Unique violations from each supported driver map to
+// ErrDuplicateIdentity; other errors do not.
+func TestIsUniqueViolation(t *testing.T) {
+	for msg, want := range map[string]bool{
+		"UNIQUE constraint failed: sqrl_identities.idk":                             true,
+		`pq: duplicate key value violates unique constraint "sqrl_identities_pkey"`: true,
+		"Error 1062 (23000): Duplicate entry 'x' for key 'sqrl_identities.PRIMARY'": true,
+		"mssql: Cannot insert duplicate key in object 'dbo.sqrl_identities'":        true,
+		"NOT NULL constraint failed: sqrl_identities.version":                       false,
+		"pq: relation \"sqrl_identities\" does not exist":                           false,
+	} {
+		if got := isUniqueViolation(errors.New(msg)); got != want {
+			t.Errorf("%q: got %v, want %v", msg, got, want)
+		}
+	}
+	if !isUniqueViolation(fmt.Errorf("insert: %w", gorm.ErrDuplicatedKey)) {
+		t.Error("gorm.ErrDuplicatedKey not detected")
+	}
+	if !isUniqueViolation(sqlStateError("23505")) || isUniqueViolation(sqlStateError("23503")) {
+		t.Error("SQLSTATE not checked")
+	}
+}
+
+// sqlStateError is a driver error exposing its SQLSTATE, as pgconn.PgError
+// does.
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "ERROR (SQLSTATE " + string(e) + ")" }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+// TC-052: FindOrCreateIdentity inserts a missing identity, returns an
+// existing one unchanged, and validates the key first.
+func TestFindOrCreateIdentity(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	identity := newTestIdentity().withIdk("tc052-idk").withBtn(1).build()
+
+	got, created, err := store.FindOrCreateIdentity(identity)
+	if err != nil || !created || got == identity || *got != *identity {
+		t.Fatalf("missing key: got %+v, %v, %v; want a copy of the supplied identity created", got, created, err)
+	}
+	got, created, err = store.FindOrCreateIdentityWithContext(context.Background(),
+		newTestIdentity().withIdk("tc052-idk").withBtn(2).build())
+	if err != nil || created || *got != *identity {
+		t.Fatalf("existing key: got %+v, %v, %v; want %+v found", got, created, err, *identity)
+	}
+	if _, _, err := store.FindOrCreateIdentity(newTestIdentity().withIdk("bad idk").build()); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("invalid key: expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+	if _, _, err := store.FindOrCreateIdentity(nil); !errors.Is(err, ErrNilIdentity) {
+		t.Errorf("nil identity: expected ErrNilIdentity, got %v", err)
+	}
+}
+
+// TC-053: When another caller inserts the key between FindOrCreateIdentity's
+// lookup and its insert, the unique violation is reported as the other
+// caller's identity found rather than as an error.
+func TestFindOrCreateIdentity_LosesRace(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	winner := newTestIdentity().withIdk("tc053-idk").withBtn(1).build()
+	raced := false
+	err := db.Callback().Query().After("gorm:query").Register("test:race_insert", func(tx *gorm.DB) {
+		if raced {
+			return
+		}
+		raced = true
+		if err := store.SaveIdentity(winner); err != nil {
+			t.Errorf("racing insert failed: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	got, created, err := store.FindOrCreateIdentity(newTestIdentity().withIdk("tc053-idk").withBtn(2).build())
+	if err != nil || created || got == nil || *got != *winner {
+		t.Fatalf("got %+v, %v, %v; want %+v found", got, created, err, *winner)
+	}
+}
@@ -0,0 +1,56 @@
+package gormauthstore
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExpireDisabledIdentities deletes the disabled identities last written more
+// than olderThan ago and returns how many were removed, so identities users
+// disabled do not accumulate forever. Age is taken from the updated_at
+// column, which disabling an identity stamps; a table migrated before
+// schema v4 has no such column and ErrTimestampsUnavailable is returned.
+// Rows not saved since that migration have no updated_at and are kept. A
+// negative olderThan is treated as zero.
+//
+// The delete honours WithSoftDelete, and with WithProtectHardlocked
+// hardlocked identities are never expired. It runs as a single statement,
+// under the write timeout.
+func (as *AuthStore) ExpireDisabledIdentities(olderThan time.Duration) (int64, error) {
+	return as.ExpireDisabledIdentitiesWithContext(as.baseContext(), olderThan)
+}
+
+// ExpireDisabledIdentitiesWithContext is ExpireDisabledIdentities with
+// context support for timeout and cancellation control.
+func (as *AuthStore) ExpireDisabledIdentitiesWithContext(ctx context.Context, olderThan time.Duration) (_ int64, err error) {
+	ctx, done := as.observe(ctx, "ExpireDisabledIdentities", "", &err)
+	defer done()
+	return as.expireDisabled(ctx, olderThan, false)
+}
+
+// ExpireDisabledIdentitiesDryRun returns how many identities
+// ExpireDisabledIdentities would remove for olderThan, without modifying
+// anything. It counts the same rows, under the read timeout.
+func (as *AuthStore) ExpireDisabledIdentitiesDryRun(ctx context.Context, olderThan time.Duration) (_ int64, err error) {
+	ctx, done := as.observe(ctx, "ExpireDisabledIdentitiesDryRun", "", &err)
+	defer done()
+	return as.expireDisabled(ctx, olderThan, true)
+}
+
+// expireDisabled implements ExpireDisabledIdentities and, under dryRun, its
+// dry run.
+func (as *AuthStore) expireDisabled(ctx context.Context, olderThan time.Duration, dryRun bool) (int64, error) {
+	cutoff := as.now().Add(-max(olderThan, 0))
+	return as.bulkDelete(ctx, dryRun, func(db *gorm.DB) (*gorm.DB, error) {
+		if !as.allIdentities(db).Migrator().HasColumn(&identityRecord{}, "updated_at") {
+			return nil, ErrTimestampsUnavailable
+		}
+		db = as.identities(db).Where("disabled = ? AND updated_at < ?", true, cutoff)
+		if as.cfg.protectHardlocked {
+			db = db.Where("hardlock = ?", false)
+		}
+		return db, nil
+	}, as.deleteRows)
+}
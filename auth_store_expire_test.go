@@ -0,0 +1,90 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// TestExpireDisabledIdentities verifies only identities disabled before the
+// cutoff are removed, and enabled ones never are however old, and that the
+// dry run counts them without removing them.
+func TestExpireDisabledIdentities(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	retention := 30 * 24 * time.Hour
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := atClock(store, start)
+	seedIdentity(t, old, newTestIdentity().withIdk("expire-stale-1").withDisabled().build())
+	seedIdentity(t, old, newTestIdentity().withIdk("expire-stale-2").withDisabled().build())
+	seedIdentity(t, old, newTestIdentity().withIdk("expire-enabled").build())
+	seedIdentity(t, atClock(store, start.Add(retention)), newTestIdentity().withIdk("expire-recent").withDisabled().build())
+
+	now := atClock(store, start.Add(retention+time.Hour))
+	if wouldExpire, err := now.ExpireDisabledIdentitiesDryRun(context.Background(), retention); err != nil || wouldExpire != 2 {
+		t.Errorf("ExpireDisabledIdentitiesDryRun: got %d, %v, want 2", wouldExpire, err)
+	}
+	if n := countRows(t, db); n != 4 {
+		t.Fatalf("rows after dry run: got %d, want 4", n)
+	}
+	expired, err := now.ExpireDisabledIdentities(retention)
+	if err != nil || expired != 2 {
+		t.Fatalf("got %d, %v, want 2", expired, err)
+	}
+	for _, idk := range []string{"expire-stale-1", "expire-stale-2"} {
+		if _, err := store.FindIdentity(idk); !errors.Is(err, ssp.ErrNotFound) {
+			t.Errorf("%s: expected ssp.ErrNotFound, got %v", idk, err)
+		}
+	}
+	if n := countRows(t, db); n != 2 {
+		t.Errorf("rows: got %d, want expire-enabled and expire-recent", n)
+	}
+
+	expired, err = now.ExpireDisabledIdentitiesWithContext(context.Background(), -time.Hour)
+	if err != nil || expired != 1 {
+		t.Errorf("negative olderThan: got %d, %v, want 1", expired, err)
+	}
+}
+
+// TestExpireDisabledIdentities_ProtectHardlocked verifies a hardlocked
+// identity is kept.
+func TestExpireDisabledIdentities_ProtectHardlocked(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithProtectHardlocked())
+	seedIdentity(t, store, newTestIdentity().withIdk("expire-locked").withDisabled().withHardlock().build())
+
+	if expired, err := store.ExpireDisabledIdentities(0); err != nil || expired != 0 {
+		t.Errorf("got %d, %v, want 0", expired, err)
+	}
+	if n := countRows(t, db); n != 1 {
+		t.Errorf("rows: got %d, want 1", n)
+	}
+}
+
+// TestExpireDisabledIdentities_NoTimestamps verifies a table without the
+// updated_at column is reported rather than treated as empty.
+func TestExpireDisabledIdentities_NoTimestamps(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	if err := db.Migrator().DropColumn(&identityRecord{}, "updated_at"); err != nil {
+		t.Fatalf("drop updated_at: %v", err)
+	}
+
+	if _, err := store.ExpireDisabledIdentities(time.Hour); !errors.Is(err, ErrTimestampsUnavailable) {
+		t.Errorf("expected ErrTimestampsUnavailable, got %v", err)
+	}
+	if _, err := store.ExpireDisabledIdentitiesDryRun(context.Background(), time.Hour); !errors.Is(err, ErrTimestampsUnavailable) {
+		t.Errorf("dry run: expected ErrTimestampsUnavailable, got %v", err)
+	}
+}
+
+// TestExpireDisabledIdentities_TableName verifies the updated_at check
+// looks at the store's WithTableName table.
+func TestExpireDisabledIdentities_TableName(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithTableName("custom_identities"))
+	seedIdentity(t, store, newTestIdentity().withIdk("expire-custom").withDisabled().build())
+
+	if expired, err := store.ExpireDisabledIdentities(-time.Hour); err != nil || expired != 1 {
+		t.Errorf("got %d, %v, want 1", expired, err)
+	}
+}
@@ -0,0 +1,85 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// TestSetFlags verifies each setter changes only its flag, including to the
+// value it already has, with and without an integrity key re-signing the row.
+func TestSetFlags(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":     nil,
+		"integrity": {WithIntegrityKey(testKey(IntegrityKeyMinSize, 1))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, store := newTestStoreWithOptions(t, opts...)
+			identity := newTestIdentity().withIdk("flag-idk").withBtn(3).build()
+			seedIdentity(t, store, identity)
+
+			if err := store.SetDisabled("flag-idk", true); err != nil {
+				t.Fatalf("SetDisabled: %v", err)
+			}
+			if err := store.SetHardlock("flag-idk", true); err != nil {
+				t.Fatalf("SetHardlock: %v", err)
+			}
+			if err := store.SetSQRLOnlyWithContext(context.Background(), "flag-idk", true); err != nil {
+				t.Fatalf("SetSQRLOnly: %v", err)
+			}
+			if err := store.SetHardlockWithContext(context.Background(), "flag-idk", true); err != nil {
+				t.Fatalf("SetHardlock to its value: %v", err)
+			}
+			if err := store.SetDisabledWithContext(context.Background(), "flag-idk", false); err != nil {
+				t.Fatalf("SetDisabled false: %v", err)
+			}
+
+			want := *identity
+			want.Hardlock, want.SQRLOnly = true, true
+			if found, err := store.FindIdentity("flag-idk"); err != nil || *found != want {
+				t.Errorf("FindIdentity: got %+v, %v, want %+v", found, err, want)
+			}
+		})
+	}
+}
+
+// TestSetFlags_Errors verifies a missing identity and an invalid key.
+func TestSetFlags_Errors(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	for name, set := range map[string]func(string, bool) error{
+		"SetDisabled": store.SetDisabled,
+		"SetHardlock": store.SetHardlock,
+		"SetSQRLOnly": store.SetSQRLOnly,
+	} {
+		if err := set("flag-missing", true); !errors.Is(err, ssp.ErrNotFound) {
+			t.Errorf("%s missing identity: expected ssp.ErrNotFound, got %v", name, err)
+		}
+		if err := set("bad idk", true); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+			t.Errorf("%s invalid key: expected ErrInvalidIdentityKeyFormat, got %v", name, err)
+		}
+	}
+}
+
+// TestSetFlags_NoKeyRead verifies that without an integrity key a setter
+// issues one UPDATE and never reads the row.
+func TestSetFlags_NoKeyRead(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("flag-noread").build())
+
+	var queries int
+	err := db.Callback().Query().Before("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries++
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	if err := store.SetDisabled("flag-noread", true); err != nil {
+		t.Fatalf("SetDisabled: %v", err)
+	}
+	if queries != 0 {
+		t.Errorf("issued %d queries, want none", queries)
+	}
+}
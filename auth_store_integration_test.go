@@ -3,6 +3,7 @@
 package gormauthstore
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -418,3 +419,54 @@ func TestIntegration_BooleanCombinations(t *testing.T) {
 		}
 	}
 }
+
+// IT-011: Concurrent read-modify-write through FindIdentityForUpdate loses
+// no update. SQLite serialises the transactions instead of locking the
+// row; PostgreSQL and MySQL hold the row lock until each commit.
+func TestIntegration_FindIdentityForUpdate_NoLostUpdates(t *testing.T) {
+	store := setupTestStore(t)
+	sqlDB, err := store.db.DB()
+	if err != nil {
+		t.Fatalf("failed to get underlying sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := store.SaveIdentity(&ssp.SqrlIdentity{Idk: "it011-counter", Suk: "suk", Vuk: "vuk"}); err != nil {
+		t.Fatalf("SaveIdentity failed: %v", err)
+	}
+
+	const workers, increments = 8, 10
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*increments)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				errs <- store.TransactionWithContext(ctx, func(tx *AuthStore) error {
+					identity, err := tx.FindIdentityForUpdate(ctx, "it011-counter")
+					if err != nil {
+						return err
+					}
+					identity.Btn++
+					return tx.SaveIdentityWithContext(ctx, identity)
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("transaction failed: %v", err)
+		}
+	}
+
+	found, err := store.FindIdentity("it011-counter")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if found.Btn != workers*increments {
+		t.Errorf("Btn: got %d, want %d", found.Btn, workers*increments)
+	}
+}
@@ -0,0 +1,255 @@
+package gormauthstore
+
+import (
+	"context"
+	"strings"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// MaxListLimit is the largest page a list method returns in one call.
+const MaxListLimit = 1000
+
+// validatePagination checks the offset and limit of a list call.
+func validatePagination(offset, limit int) error {
+	if offset < 0 || limit < 1 || limit > MaxListLimit {
+		return ErrInvalidPagination
+	}
+	return nil
+}
+
+// listIdentities returns one page of identities matching scope. Every list
+// method goes through here, so all of them share one ordering guarantee:
+// rows are sorted by idk ascending, the primary key. Without an explicit
+// ORDER BY the database may return rows in any order, and consecutive pages
+// could repeat or skip rows.
+func (as *AuthStore) listIdentities(ctx context.Context, offset, limit int, scope func(*gorm.DB) *gorm.DB) ([]*ssp.SqrlIdentity, error) {
+	if err := validatePagination(offset, limit); err != nil {
+		return nil, err
+	}
+	var records []identityRecord
+	err := as.run(ctx, opRead, func(db *gorm.DB) error {
+		return scope(as.identities(db)).Order("idk").Offset(offset).Limit(limit).Find(&records).Error
+	})
+	defer func() {
+		for i := range records {
+			clearRecord(&records[i])
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+	// Every row is verified before any is converted, so a failure leaves no
+	// copies of key material behind.
+	for i := range records {
+		if err := as.verifyRecord(&records[i]); err != nil {
+			return nil, err
+		}
+	}
+	identities := make([]*ssp.SqrlIdentity, len(records))
+	for i := range records {
+		identities[i] = toIdentity(&records[i])
+	}
+	return identities, nil
+}
+
+// ListRekeyedAway returns one page of identities superseded by a rekey, i.e.
+// whose Rekeyed field is set, ordered by idk ascending. These should no
+// longer authenticate; the list supports auditing that retired keys stay
+// retired.
+//
+// The returned identities carry Suk and Vuk. Callers must ClearIdentity each
+// one when done.
+func (as *AuthStore) ListRekeyedAway(ctx context.Context, offset, limit int) (_ []*ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "ListRekeyedAway", "", &err)
+	defer done()
+	return as.listIdentities(ctx, offset, limit, func(db *gorm.DB) *gorm.DB {
+		return db.Where("rekeyed <> ''")
+	})
+}
+
+// ListIdentities returns one page of all stored identities, ordered by idk
+// ascending, for admin views. offset must be >= 0 and limit in
+// 1..MaxListLimit, otherwise ErrInvalidPagination is returned; the cap keeps
+// a careless caller from scanning the whole table. A page past the end is an
+// empty, non-nil slice. Use EachIdentity for a full export.
+//
+// The returned identities carry Suk and Vuk. Callers must ClearIdentity each
+// one when done.
+func (as *AuthStore) ListIdentities(offset, limit int) ([]*ssp.SqrlIdentity, error) {
+	return as.ListIdentitiesWithContext(as.baseContext(), offset, limit)
+}
+
+// ListIdentitiesWithContext is ListIdentities with context support for
+// timeout and cancellation control.
+func (as *AuthStore) ListIdentitiesWithContext(ctx context.Context, offset, limit int) (_ []*ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "ListIdentities", "", &err)
+	defer done()
+	return as.listIdentities(ctx, offset, limit, func(db *gorm.DB) *gorm.DB {
+		return db
+	})
+}
+
+// ListIdentitiesAfter returns up to limit identities whose idk sorts after
+// cursorIdk, ordered by idk ascending, and the cursor of the next page: the
+// Idk of the last identity returned, or "" once the table is exhausted. An
+// empty cursor starts from the beginning. Unlike ListIdentities, a page is
+// found by key rather than by offset, so its cost does not grow with the
+// page number and rows inserted or deleted meanwhile never make a later
+// page repeat or skip a row. A full page may be followed by an empty one.
+//
+// A non-empty cursor must pass identity key validation, otherwise its
+// validation error is returned; limit must be in 1..MaxListLimit, otherwise
+// ErrInvalidPagination. Under WithIdkPepper the Idk of a listed identity,
+// and so the cursor, is the stored hash.
+//
+// The returned identities carry Suk and Vuk. Callers must ClearIdentity each
+// one when done.
+func (as *AuthStore) ListIdentitiesAfter(cursorIdk string, limit int) ([]*ssp.SqrlIdentity, string, error) {
+	return as.ListIdentitiesAfterWithContext(as.baseContext(), cursorIdk, limit)
+}
+
+// ListIdentitiesAfterWithContext is ListIdentitiesAfter with context support
+// for timeout and cancellation control.
+func (as *AuthStore) ListIdentitiesAfterWithContext(ctx context.Context, cursorIdk string, limit int) (_ []*ssp.SqrlIdentity, _ string, err error) {
+	ctx, done := as.observe(ctx, "ListIdentitiesAfter", "", &err)
+	defer done()
+	if cursorIdk != "" {
+		if err := as.validateIdk(strings.TrimPrefix(cursorIdk, hashedIdkPrefix)); err != nil {
+			return nil, "", err
+		}
+	}
+	identities, err := as.listIdentities(ctx, 0, limit, func(db *gorm.DB) *gorm.DB {
+		if cursorIdk == "" {
+			return db
+		}
+		return db.Where("idk > ?", cursorIdk)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(identities) == limit {
+		next = identities[len(identities)-1].Idk
+	}
+	return identities, next, nil
+}
+
+// CountIdentities returns the number of stored identities, for monitoring
+// table growth. An empty table yields 0 and no error.
+func (as *AuthStore) CountIdentities() (int64, error) {
+	return as.CountIdentitiesWithContext(as.baseContext())
+}
+
+// CountIdentitiesWithContext is CountIdentities with context support for
+// timeout and cancellation control.
+func (as *AuthStore) CountIdentitiesWithContext(ctx context.Context) (_ int64, err error) {
+	ctx, done := as.observe(ctx, "CountIdentities", "", &err)
+	defer done()
+	var count int64
+	err = as.run(ctx, opRead, func(db *gorm.DB) error {
+		return as.identities(db).Count(&count).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// EachIdentity calls fn for every stored identity in idk order, streaming rows
+// from a single cursor instead of loading the whole table. Iteration stops at
+// the first error from fn, which is returned, or when ctx is cancelled: ctx is
+// checked before every call to fn and the cursor is closed on return, so the
+// connection goes back to the pool. The read timeout does not apply; bound a
+// long export with ctx.
+//
+// The identity passed to fn is wiped once fn returns; fn must copy anything
+// it keeps. The cursor holds a connection for the whole iteration, so fn must
+// not call back into the store when the pool has a single connection.
+func (as *AuthStore) EachIdentity(ctx context.Context, fn func(*ssp.SqrlIdentity) error) (err error) {
+	ctx, done := as.observe(ctx, "EachIdentity", "", &err)
+	defer done()
+	return as.eachIdentity(ctx, func(identity *ssp.SqrlIdentity) error {
+		defer ClearIdentity(identity)
+		return fn(identity)
+	})
+}
+
+// StreamIdentities sends every stored identity, in idk order, on the
+// returned identity channel, for exports too large to hold in memory. Rows
+// are read from a single cursor as the consumer receives them. The identity
+// channel is closed when iteration ends; the error channel then yields the
+// error that ended it, if any, and is closed too, so
+//
+//	ids, errs := store.StreamIdentities(ctx)
+//	for id := range ids {
+//		export(id)
+//		gormauthstore.ClearIdentity(id)
+//	}
+//	if err := <-errs; err != nil { ... }
+//
+// Cancelling ctx stops the stream promptly, with ctx's error, even if the
+// consumer has stopped receiving; the cursor is closed either way, so a
+// consumer that abandons the stream must cancel ctx to release the
+// connection. The read timeout does not apply; bound a long export with ctx.
+//
+// The received identities carry Suk and Vuk. Consumers must ClearIdentity
+// each one when done. The cursor holds a connection until the stream ends,
+// as for EachIdentity.
+func (as *AuthStore) StreamIdentities(ctx context.Context) (<-chan *ssp.SqrlIdentity, <-chan error) {
+	ids := make(chan *ssp.SqrlIdentity)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(ids)
+		var err error
+		ctx, done := as.observe(ctx, "StreamIdentities", "", &err)
+		defer done()
+		err = as.eachIdentity(ctx, func(identity *ssp.SqrlIdentity) error {
+			select {
+			case ids <- identity:
+				return nil
+			case <-ctx.Done():
+				ClearIdentity(identity)
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return ids, errs
+}
+
+// eachIdentity passes every stored identity, in idk order, to fn, which
+// takes ownership of it. It is the cursor loop shared by EachIdentity and
+// StreamIdentities.
+func (as *AuthStore) eachIdentity(ctx context.Context, fn func(*ssp.SqrlIdentity) error) error {
+	return as.run(ctx, opStream, func(db *gorm.DB) error {
+		rows, err := as.identities(db).Order("idk").Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var record identityRecord
+			if err := db.ScanRows(rows, &record); err != nil {
+				return err
+			}
+			if err := as.verifyRecord(&record); err != nil {
+				clearRecord(&record)
+				return err
+			}
+			identity := toIdentity(&record)
+			clearRecord(&record)
+			if err := fn(identity); err != nil {
+				return callbackError{err}
+			}
+		}
+		return rows.Err()
+	})
+}
@@ -0,0 +1,373 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// TestListRekeyedAway verifies only rekeyed identities are listed, in idk order.
+func TestListRekeyedAway(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+
+	seedIdentity(t, store, newTestIdentity().withIdk("list-c").withRekeyed("list-d").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("list-a").withRekeyed("list-b").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("list-b").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("list-d").build())
+
+	got, err := store.ListRekeyedAway(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatalf("ListRekeyedAway failed: %v", err)
+	}
+	if len(got) != 2 || got[0].Idk != "list-a" || got[1].Idk != "list-c" {
+		t.Fatalf("got %v, want [list-a list-c]", idks(got))
+	}
+	if got[0].Rekeyed != "list-b" {
+		t.Errorf("Rekeyed: got %q, want %q", got[0].Rekeyed, "list-b")
+	}
+}
+
+// TestListRekeyedAway_Pagination verifies offset and limit page through results.
+func TestListRekeyedAway_Pagination(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	for i := 0; i < 5; i++ {
+		seedIdentity(t, store, newTestIdentity().withIdk(fmt.Sprintf("page-%d", i)).withRekeyed("page-new").build())
+	}
+
+	first, err := store.ListRekeyedAway(context.Background(), 0, 2)
+	if err != nil {
+		t.Fatalf("first page: %v", err)
+	}
+	last, err := store.ListRekeyedAway(context.Background(), 4, 2)
+	if err != nil {
+		t.Fatalf("last page: %v", err)
+	}
+	if fmt.Sprint(idks(first)) != "[page-0 page-1]" || fmt.Sprint(idks(last)) != "[page-4]" {
+		t.Errorf("pages: got %v and %v", idks(first), idks(last))
+	}
+}
+
+// TestListRekeyedAway_InvalidPagination verifies the pagination guards.
+func TestListRekeyedAway_InvalidPagination(t *testing.T) {
+	store := newTestStore(t)
+
+	tests := []struct {
+		name          string
+		offset, limit int
+	}{
+		{"negative offset", -1, 10},
+		{"zero limit", 0, 0},
+		{"negative limit", 0, -1},
+		{"limit above max", 0, MaxListLimit + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.ListRekeyedAway(context.Background(), tt.offset, tt.limit)
+			if !errors.Is(err, ErrInvalidPagination) {
+				t.Errorf("expected ErrInvalidPagination, got %v", err)
+			}
+		})
+	}
+}
+
+// TestEachIdentity visits every identity in idk order.
+func TestEachIdentity(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	for _, idk := range []string{"each-b", "each-c", "each-a"} {
+		seedIdentity(t, store, newTestIdentity().withIdk(idk).build())
+	}
+
+	var seen []string
+	err := store.EachIdentity(context.Background(), func(id *ssp.SqrlIdentity) error {
+		seen = append(seen, id.Idk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachIdentity failed: %v", err)
+	}
+	if fmt.Sprint(seen) != "[each-a each-b each-c]" {
+		t.Errorf("visited %v, want [each-a each-b each-c]", seen)
+	}
+}
+
+// TestEachIdentity_StopsOnError verifies an error from fn ends iteration and
+// is returned unchanged.
+func TestEachIdentity_StopsOnError(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	for _, idk := range []string{"stop-a", "stop-b"} {
+		seedIdentity(t, store, newTestIdentity().withIdk(idk).build())
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := store.EachIdentity(context.Background(), func(*ssp.SqrlIdentity) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("got err=%v calls=%d, want stop after 1 call", err, calls)
+	}
+}
+
+// TestEachIdentity_Cancellation verifies cancelling mid-iteration stops
+// before the next row and returns the connection to the pool.
+func TestEachIdentity_Cancellation(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	for i := 0; i < 5; i++ {
+		seedIdentity(t, store, newTestIdentity().withIdk(fmt.Sprintf("cancel-%d", i)).build())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	err := store.EachIdentity(ctx, func(*ssp.SqrlIdentity) error {
+		calls++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("got err=%v calls=%d, want context.Canceled after 1 call", err, calls)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	if inUse := sqlDB.Stats().InUse; inUse != 0 {
+		t.Errorf("connections in use after cancellation: %d", inUse)
+	}
+}
+
+// TestStreamIdentities receives every identity in idk order, then a closed
+// error channel.
+func TestStreamIdentities(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	for _, idk := range []string{"stream-b", "stream-c", "stream-a"} {
+		seedIdentity(t, store, newTestIdentity().withIdk(idk).build())
+	}
+
+	ids, errs := store.StreamIdentities(context.Background())
+	var seen []string
+	for id := range ids {
+		if id.Suk == "" {
+			t.Errorf("%s: received without Suk", id.Idk)
+		}
+		seen = append(seen, id.Idk)
+		ClearIdentity(id)
+	}
+	if err, ok := <-errs; err != nil || ok {
+		t.Errorf("error channel: got %v, open %v; want closed", err, ok)
+	}
+	if fmt.Sprint(seen) != "[stream-a stream-b stream-c]" {
+		t.Errorf("received %v, want [stream-a stream-b stream-c]", seen)
+	}
+}
+
+// TestStreamIdentities_Cancellation verifies cancelling a stream the
+// consumer has stopped receiving from ends it with the context's error and
+// returns the connection to the pool.
+func TestStreamIdentities_Cancellation(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	for i := 0; i < 5; i++ {
+		seedIdentity(t, store, newTestIdentity().withIdk(fmt.Sprintf("stream-%d", i)).build())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ids, errs := store.StreamIdentities(ctx)
+	ClearIdentity(<-ids)
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, ok := <-ids; ok {
+		t.Error("identity channel still open after the stream ended")
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	if inUse := sqlDB.Stats().InUse; inUse != 0 {
+		t.Errorf("connections in use after cancellation: %d", inUse)
+	}
+}
+
+// TestListIdentities_PagesAreDeterministic pages through 100 rows in chunks of
+// 10 and verifies the concatenation equals one sorted fetch, with no
+// duplicates or gaps.
+func TestListIdentities_PagesAreDeterministic(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	// Insert in an order unrelated to idk so storage order cannot mask a
+	// missing ORDER BY.
+	for _, i := range rand.New(rand.NewPCG(1, 2)).Perm(100) {
+		seedIdentity(t, store, newTestIdentity().withIdk(fmt.Sprintf("det-%03d", i)).build())
+	}
+
+	all, err := store.ListIdentities(0, 100)
+	if err != nil {
+		t.Fatalf("full fetch: %v", err)
+	}
+	want := idks(all)
+	if !sort.StringsAreSorted(want) || len(want) != 100 {
+		t.Fatalf("full fetch not 100 sorted keys: %v", want)
+	}
+
+	var paged []string
+	for offset := 0; offset < 100; offset += 10 {
+		page, err := store.ListIdentities(offset, 10)
+		if err != nil {
+			t.Fatalf("page at %d: %v", offset, err)
+		}
+		paged = append(paged, idks(page)...)
+	}
+	if fmt.Sprint(paged) != fmt.Sprint(want) {
+		t.Errorf("paged result differs from full fetch:\n got %v\nwant %v", paged, want)
+	}
+}
+
+// TestListIdentities lists every identity, rekeyed or not, and returns an
+// empty non-nil page past the end and on an empty table.
+func TestListIdentities(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+
+	empty, err := store.ListIdentitiesWithContext(context.Background(), 0, 10)
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Fatalf("empty table: got %v, %v; want empty non-nil slice", empty, err)
+	}
+
+	seedIdentity(t, store, newTestIdentity().withIdk("all-b").withRekeyed("all-c").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("all-a").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("all-c").withDisabled().build())
+
+	got, err := store.ListIdentities(0, MaxListLimit)
+	if err != nil {
+		t.Fatalf("ListIdentities: %v", err)
+	}
+	if fmtKeys(idks(got)) != "[all-a all-b all-c]" {
+		t.Errorf("got %v, want [all-a all-b all-c]", idks(got))
+	}
+	past, err := store.ListIdentities(3, 10)
+	if err != nil || past == nil || len(past) != 0 {
+		t.Errorf("past the end: got %v, %v; want empty non-nil slice", past, err)
+	}
+	if _, err := store.ListIdentities(-1, 10); !errors.Is(err, ErrInvalidPagination) {
+		t.Errorf("negative offset: expected ErrInvalidPagination, got %v", err)
+	}
+	if _, err := store.ListIdentities(0, MaxListLimit+1); !errors.Is(err, ErrInvalidPagination) {
+		t.Errorf("limit above max: expected ErrInvalidPagination, got %v", err)
+	}
+}
+
+// TestListIdentitiesAfter pages through rows by cursor while rows are
+// inserted and deleted between pages, and verifies no surviving row is
+// repeated or skipped.
+func TestListIdentitiesAfter(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	for i := 0; i < 25; i++ {
+		seedIdentity(t, store, newTestIdentity().withIdk(fmt.Sprintf("cur-%02d", i*2)).build())
+	}
+
+	var paged []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("cursor did not reach the end")
+		}
+		page, next, err := store.ListIdentitiesAfter(cursor, 10)
+		if err != nil {
+			t.Fatalf("page after %q: %v", cursor, err)
+		}
+		paged = append(paged, idks(page)...)
+		if next == "" {
+			break
+		}
+		if next != page[len(page)-1].Idk {
+			t.Fatalf("next cursor %q, want the last Idk of the page", next)
+		}
+		cursor = next
+		if pages == 0 {
+			// Behind the cursor and ahead of it.
+			seedIdentity(t, store, newTestIdentity().withIdk("cur-01").build())
+			seedIdentity(t, store, newTestIdentity().withIdk("cur-31").build())
+			if err := store.DeleteIdentity("cur-02"); err != nil {
+				t.Fatalf("DeleteIdentity: %v", err)
+			}
+		}
+	}
+
+	var want []string
+	for i := 0; i < 25; i++ {
+		want = append(want, fmt.Sprintf("cur-%02d", i*2))
+		if i == 15 {
+			want = append(want, "cur-31")
+		}
+	}
+	if fmt.Sprint(paged) != fmt.Sprint(want) {
+		t.Errorf("paged:\n got %v\nwant %v", paged, want)
+	}
+}
+
+// TestListIdentitiesAfter_Validation rejects an invalid cursor or limit and
+// returns an empty page with no cursor past the end.
+func TestListIdentitiesAfter_Validation(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("cur-a").build())
+
+	if _, _, err := store.ListIdentitiesAfter("x' OR '1'='1", 10); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("invalid cursor: expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+	if _, _, err := store.ListIdentitiesAfter("", 0); !errors.Is(err, ErrInvalidPagination) {
+		t.Errorf("zero limit: expected ErrInvalidPagination, got %v", err)
+	}
+	page, next, err := store.ListIdentitiesAfterWithContext(context.Background(), "cur-a", 10)
+	if err != nil || page == nil || len(page) != 0 || next != "" {
+		t.Errorf("past the end: got %v, %q, %v; want empty page and no cursor", page, next, err)
+	}
+}
+
+// TestListIdentitiesAfter_IdkPepper verifies the stored hash returned as
+// the cursor is accepted for the next page.
+func TestListIdentitiesAfter_IdkPepper(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithIdkPepper(testKey(IdkPepperMinSize, 1)))
+	for i := 0; i < 3; i++ {
+		seedIdentity(t, store, newTestIdentity().withIdk(fmt.Sprintf("cur-pep-%d", i)).build())
+	}
+
+	first, next, err := store.ListIdentitiesAfter("", 2)
+	if err != nil || len(first) != 2 {
+		t.Fatalf("first page: got %d, %v", len(first), err)
+	}
+	rest, next, err := store.ListIdentitiesAfter(next, 2)
+	if err != nil || len(rest) != 1 || next != "" {
+		t.Fatalf("second page: got %d, %q, %v", len(rest), next, err)
+	}
+	if rest[0].Idk <= first[1].Idk {
+		t.Errorf("second page %q does not follow %q", rest[0].Idk, first[1].Idk)
+	}
+}
+
+// TestCountIdentities counts every row and reports 0 for an empty table.
+func TestCountIdentities(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+
+	if n, err := store.CountIdentities(); err != nil || n != 0 {
+		t.Fatalf("empty table: got %d, %v; want 0, nil", n, err)
+	}
+	seedIdentity(t, store, newTestIdentity().withIdk("count-a").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("count-b").withDisabled().build())
+	if n, err := store.CountIdentitiesWithContext(context.Background()); err != nil || n != 2 {
+		t.Errorf("got %d, %v; want 2, nil", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.CountIdentitiesWithContext(ctx); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
@@ -0,0 +1,108 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindIdentityForUpdate reads an identity with SELECT ... FOR UPDATE, so
+// the surrounding transaction holds its row lock until commit and a
+// concurrent read-modify-write, such as two rekeys of one identity, waits
+// instead of losing an update:
+//
+//	err := store.TransactionWithContext(ctx, func(tx *AuthStore) error {
+//		identity, err := tx.FindIdentityForUpdate(ctx, idk)
+//		if err != nil {
+//			return err
+//		}
+//		identity.Suk, identity.Vuk = newSuk, newVuk
+//		return tx.SaveIdentityWithContext(ctx, identity)
+//	})
+//
+// The store must be bound to a transaction (see Transaction and WithTx);
+// otherwise the lock would be released as soon as the read returned, so
+// ErrNotInTransaction is returned without querying. PostgreSQL and MySQL
+// lock the row; SQLite has no row locks and ignores FOR UPDATE, but
+// serialises writers on the whole database instead. WithLockTimeout bounds
+// the wait for a lock, failing with ErrLockTimeout. Otherwise it behaves
+// like FindIdentityWithContext.
+func (as *AuthStore) FindIdentityForUpdate(ctx context.Context, idk string) (_ *ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "FindIdentityForUpdate", idk, &err)
+	defer done()
+	if err := as.usable(); err != nil {
+		return nil, err
+	}
+	if !inTransaction(as.db) {
+		return nil, ErrNotInTransaction
+	}
+	if as.cfg.lockTimeout > 0 {
+		if err := as.validateIdk(idk); err != nil {
+			return nil, err
+		}
+		restore, err := as.setLockTimeout(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer restore()
+	}
+	identity, _, err := as.loadIdentity(ctx, idk, func(db *gorm.DB) *gorm.DB {
+		return as.identities(db).Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})
+	})
+	if err != nil && isLockTimeout(err) {
+		return nil, fmt.Errorf("%w: %w", ErrLockTimeout, err)
+	}
+	return identity, err
+}
+
+// setLockTimeout applies the WithLockTimeout timeout to the transaction the
+// store is bound to, and returns the function that undoes it where the
+// setting outlives the transaction.
+func (as *AuthStore) setLockTimeout(ctx context.Context) (func(), error) {
+	switch as.db.Dialector.Name() {
+	case "postgres":
+		ms := (as.cfg.lockTimeout + time.Millisecond - 1) / time.Millisecond
+		return func() {}, as.run(ctx, opRead, func(db *gorm.DB) error {
+			return db.Exec(fmt.Sprintf("SET LOCAL lock_timeout = %d", ms)).Error
+		})
+	case "mysql":
+		seconds := (as.cfg.lockTimeout + time.Second - 1) / time.Second
+		var previous int
+		err := as.run(ctx, opRead, func(db *gorm.DB) error {
+			if err := db.Raw("SELECT @@SESSION.innodb_lock_wait_timeout").Scan(&previous).Error; err != nil {
+				return err
+			}
+			return db.Exec("SET SESSION innodb_lock_wait_timeout = ?", int(seconds)).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			as.db.WithContext(context.WithoutCancel(ctx)).Exec("SET SESSION innodb_lock_wait_timeout = ?", previous)
+		}, nil
+	default:
+		return func() {}, nil
+	}
+}
+
+// isLockTimeout reports whether err is a lock wait that timed out:
+// PostgreSQL's lock_not_available (55P03) or MySQL's error 1205.
+func isLockTimeout(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && state.SQLState() == "55P03" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "lock wait timeout exceeded")
+}
+
+// inTransaction reports whether db is bound to an open transaction.
+func inTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
@@ -0,0 +1,134 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// TestFindIdentityForUpdate_RequiresTransaction verifies the lock is
+// refused outside a transaction rather than silently released.
+func TestFindIdentityForUpdate_RequiresTransaction(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("lock-outside").build())
+
+	if _, err := store.FindIdentityForUpdate(context.Background(), "lock-outside"); !errors.Is(err, ErrNotInTransaction) {
+		t.Errorf("expected ErrNotInTransaction, got %v", err)
+	}
+	if _, err := NewAuthStore(nil).FindIdentityForUpdate(context.Background(), "lock-outside"); !errors.Is(err, ErrNilDatabase) {
+		t.Errorf("nil db: expected ErrNilDatabase, got %v", err)
+	}
+}
+
+// TestFindIdentityForUpdate_InTransaction verifies the read carries a
+// FOR UPDATE clause and supports a read-modify-write.
+func TestFindIdentityForUpdate_InTransaction(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("lock-rmw").withBtn(1).build())
+
+	locked := false
+	err := db.Callback().Query().Before("gorm:query").Register("test:locking", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Clauses["FOR"]; ok {
+			locked = true
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	ctx := context.Background()
+	err = store.TransactionWithContext(ctx, func(tx *AuthStore) error {
+		identity, err := tx.FindIdentityForUpdate(ctx, "lock-rmw")
+		if err != nil {
+			return err
+		}
+		identity.Btn++
+		return tx.SaveIdentityWithContext(ctx, identity)
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if !locked {
+		t.Error("read was not issued with a locking clause")
+	}
+	found, err := store.FindIdentity("lock-rmw")
+	if err != nil || found.Btn != 2 {
+		t.Errorf("after update: got %+v, %v", found, err)
+	}
+
+	err = store.Transaction(func(tx *AuthStore) error {
+		if _, err := tx.FindIdentityForUpdate(ctx, "lock-missing"); !errors.Is(err, ssp.ErrNotFound) {
+			t.Errorf("missing: expected ssp.ErrNotFound, got %v", err)
+		}
+		if _, err := tx.FindIdentityForUpdate(ctx, "bad idk"); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+			t.Errorf("invalid: expected ErrInvalidIdentityKeyFormat, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+}
+
+// TestFindIdentityForUpdate_PreparedStatements verifies a transaction on a
+// PrepareStmt handle is recognised.
+func TestFindIdentityForUpdate_PreparedStatements(t *testing.T) {
+	_, store := newPreparedStmtStore(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("lock-prepared").build())
+	err := store.Transaction(func(tx *AuthStore) error {
+		_, err := tx.FindIdentityForUpdate(context.Background(), "lock-prepared")
+		return err
+	})
+	if err != nil {
+		t.Errorf("expected success on a prepared-statement transaction, got %v", err)
+	}
+}
+
+// TestFindIdentityForUpdate_LockTimeout verifies WithLockTimeout leaves the
+// SQLite read unchanged, as SQLite takes no row locks.
+func TestFindIdentityForUpdate_LockTimeout(t *testing.T) {
+	db, _ := newTestStoreWithOptions(t)
+	store := NewAuthStore(db, WithLockTimeout(time.Second))
+	seedIdentity(t, store, newTestIdentity().withIdk("lock-timeout").build())
+
+	statements := 0
+	err := db.Callback().Raw().Before("gorm:raw").Register("test:lock_timeout", func(*gorm.DB) { statements++ })
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Callback().Raw().Remove("test:lock_timeout") })
+
+	ctx := context.Background()
+	err = store.TransactionWithContext(ctx, func(tx *AuthStore) error {
+		_, err := tx.FindIdentityForUpdate(ctx, "lock-timeout")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if statements != 0 {
+		t.Errorf("raw statements: got %d, want none on SQLite", statements)
+	}
+}
+
+// TestIsLockTimeout verifies the PostgreSQL and MySQL lock wait timeouts
+// are recognised, and no other failure is.
+func TestIsLockTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{sqlStateError("55P03"), true},
+		{errors.New("Error 1205 (HY000): Lock wait timeout exceeded; try restarting transaction"), true},
+		{sqlStateError("40P01"), false},
+		{errors.New("database is locked (5) (SQLITE_BUSY)"), false},
+	} {
+		if got := isLockTimeout(tt.err); got != tt.want {
+			t.Errorf("isLockTimeout(%v): got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package gormauthstore
+
+import (
+	"context"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// IdentityMetadata is the bookkeeping the store keeps about an identity row
+// beyond the ssp.SqrlIdentity fields.
+type IdentityMetadata struct {
+	// CreatedAt is when the identity was first saved, in UTC.
+	CreatedAt time.Time
+	// UpdatedAt is when the identity was last written by the store, in UTC:
+	// a save, ClaimAndDisable or RenameIdentity. Key rotation and
+	// HashIdentityKeys change only the stored representation and leave it.
+	UpdatedAt time.Time
+	// DeletedAt is when WithSoftDelete deleted the identity, in UTC, or
+	// zero if it is live. Only FindIdentityIncludingDeleted returns
+	// deleted identities.
+	DeletedAt time.Time
+}
+
+// toMetadata extracts the metadata of record. Both times are zero for rows
+// written before the columns existed.
+func toMetadata(record *identityRecord) IdentityMetadata {
+	return IdentityMetadata{
+		CreatedAt: record.CreatedAt.UTC(),
+		UpdatedAt: record.UpdatedAt.UTC(),
+		DeletedAt: record.DeletedAt.Time.UTC(),
+	}
+}
+
+// now returns the current time in UTC for the timestamp columns, from the
+// database's NowFunc so a WithSession NowFunc applies.
+func (as *AuthStore) now() time.Time {
+	if as.db == nil || as.db.Config == nil || as.db.NowFunc == nil {
+		return time.Now().UTC()
+	}
+	return as.db.NowFunc().UTC()
+}
+
+// FindIdentityWithMetadata is FindIdentityWithContext that also returns the
+// identity's IdentityMetadata, such as when it was registered and last
+// modified, for auditing.
+func (as *AuthStore) FindIdentityWithMetadata(ctx context.Context, idk string) (_ *ssp.SqrlIdentity, _ IdentityMetadata, err error) {
+	ctx, done := as.observe(ctx, "FindIdentityWithMetadata", idk, &err)
+	defer done()
+	return as.loadIdentity(ctx, idk, as.identities)
+}
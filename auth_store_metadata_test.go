@@ -0,0 +1,100 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// atClock returns a store copy whose writes are stamped at t.
+func atClock(store *AuthStore, t time.Time) *AuthStore {
+	return store.WithSession(&gorm.Session{NowFunc: func() time.Time { return t }})
+}
+
+// TestFindIdentityWithMetadata verifies the timestamps are stored in UTC,
+// that CreatedAt survives later saves and that UpdatedAt follows them.
+func TestFindIdentityWithMetadata(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	ctx := context.Background()
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	created := time.Date(2026, 1, 2, 8, 4, 5, 0, zone)
+	updated := created.Add(time.Hour)
+
+	identity := newTestIdentity().withIdk("meta-1").build()
+	if err := atClock(store, created).SaveIdentity(identity); err != nil {
+		t.Fatalf("SaveIdentity failed: %v", err)
+	}
+	found, meta, err := store.FindIdentityWithMetadata(ctx, "meta-1")
+	if err != nil {
+		t.Fatalf("FindIdentityWithMetadata failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("identity: got %+v, want %+v", *found, *identity)
+	}
+	if !meta.CreatedAt.Equal(created) || !meta.UpdatedAt.Equal(created) {
+		t.Errorf("after insert: got %+v, want both %v", meta, created)
+	}
+	if meta.CreatedAt.Location() != time.UTC || meta.UpdatedAt.Location() != time.UTC {
+		t.Errorf("location: got %v and %v, want UTC", meta.CreatedAt.Location(), meta.UpdatedAt.Location())
+	}
+
+	identity.Btn = 2
+	if err := atClock(store, updated).SaveIdentity(identity); err != nil {
+		t.Fatalf("SaveIdentity failed: %v", err)
+	}
+	if _, meta, err = store.FindIdentityWithMetadata(ctx, "meta-1"); err != nil {
+		t.Fatalf("FindIdentityWithMetadata failed: %v", err)
+	}
+	if !meta.CreatedAt.Equal(created) || !meta.UpdatedAt.Equal(updated) {
+		t.Errorf("after update: got %+v, want created %v, updated %v", meta, created, updated)
+	}
+
+	if _, _, err := store.FindIdentityWithMetadata(ctx, "meta-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("missing: expected ssp.ErrNotFound, got %v", err)
+	}
+}
+
+// TestIdentityMetadata_OtherWrites verifies ClaimAndDisable, RenameIdentity,
+// batch saves and optimistic saves maintain the timestamps.
+func TestIdentityMetadata_OtherWrites(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":     nil,
+		"integrity": {WithIntegrityKey(testKey(IntegrityKeyMinSize, 1)), WithOptimisticLocking()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, store := newTestStoreWithOptions(t, opts...)
+			ctx := context.Background()
+			created := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+			later := created.Add(24 * time.Hour)
+			seed := atClock(store, created)
+			if err := seed.SaveIdentities([]*ssp.SqrlIdentity{
+				newTestIdentity().withIdk("meta-claim").build(),
+				newTestIdentity().withIdk("meta-old").build(),
+				newTestIdentity().withIdk("meta-next").withPidk("meta-old").build(),
+			}); err != nil {
+				t.Fatalf("SaveIdentities failed: %v", err)
+			}
+
+			next := atClock(store, later)
+			if _, err := next.ClaimAndDisable(ctx, "meta-claim"); err != nil {
+				t.Fatalf("ClaimAndDisable failed: %v", err)
+			}
+			if err := next.RenameIdentity(ctx, "meta-old", "meta-new"); err != nil {
+				t.Fatalf("RenameIdentity failed: %v", err)
+			}
+			for _, idk := range []string{"meta-claim", "meta-new", "meta-next"} {
+				_, meta, err := store.FindIdentityWithMetadata(ctx, idk)
+				if err != nil {
+					t.Fatalf("FindIdentityWithMetadata(%s) failed: %v", idk, err)
+				}
+				if !meta.CreatedAt.Equal(created) || !meta.UpdatedAt.Equal(later) {
+					t.Errorf("%s: got %+v, want created %v, updated %v", idk, meta, created, later)
+				}
+			}
+		})
+	}
+}
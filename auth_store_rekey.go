@@ -0,0 +1,334 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Rekey performs a SQRL rekey in a single transaction: it inserts
+// newIdentity with Pidk set to oldIdk and sets the Rekeyed field of the
+// identity oldIdk to newIdentity.Idk, so the two are never left half
+// linked. On success newIdentity.Pidk is set to oldIdk as stored.
+//
+// Returns ssp.ErrNotFound if oldIdk does not exist, ErrDuplicateIdentity if
+// newIdentity's key is already in use, by a soft-deleted row included, and
+// ErrRekeyCycle if the new key is oldIdk itself, one of its predecessors
+// along the Pidk chain, or an identity already rekeyed to oldIdk. Nothing is
+// written on any error. The key and identity are validated first.
+func (as *AuthStore) Rekey(oldIdk string, newIdentity *ssp.SqrlIdentity) error {
+	return as.RekeyWithContext(as.baseContext(), oldIdk, newIdentity)
+}
+
+// RekeyWithContext is Rekey with context support for timeout and
+// cancellation control.
+func (as *AuthStore) RekeyWithContext(ctx context.Context, oldIdk string, newIdentity *ssp.SqrlIdentity) (err error) {
+	ctx, done := as.observe(ctx, "Rekey", oldIdk, &err)
+	defer done()
+	if err := as.validateIdk(oldIdk); err != nil {
+		return err
+	}
+	if newIdentity == nil {
+		return ErrNilIdentity
+	}
+	linked := *newIdentity
+	linked.Pidk = oldIdk
+	if err := as.validateIdentity(&linked); err != nil {
+		return err
+	}
+	if linked.Idk == oldIdk {
+		return ErrRekeyCycle
+	}
+	record := as.newRecord(&linked)
+	defer clearRecord(record)
+	oldKey := as.lookupKey(oldIdk)
+	old := &identityRecord{}
+	defer clearRecord(old)
+	err = as.run(ctx, opWriteOnce, func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			err := as.identities(tx).Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+				Where("idk = ?", oldKey).First(old).Error
+			if err != nil {
+				return err
+			}
+			if err := as.verifyRecord(old); err != nil {
+				return err
+			}
+			if err := as.checkRekeyCycle(tx, oldIdk, old.Pidk, linked.Idk); err != nil {
+				return err
+			}
+			err = as.allIdentities(tx).Select(slices.Concat([]string{"idk"}, identityColumns, timestampColumns)).
+				Create(record).Error
+			if err != nil {
+				return err
+			}
+			version := old.Version
+			old.Rekeyed = linked.Idk
+			old.Version++
+			old.UpdatedAt = record.UpdatedAt
+			as.signRecord(old)
+			// The version guard stands in for the row lock on databases
+			// that ignore FOR UPDATE, such as SQLite.
+			result := as.allIdentities(tx).Model(&identityRecord{}).Where("idk = ? AND version = ?", oldKey, version).
+				Select("rekeyed", "mac", "version", "updated_at").Updates(old)
+			if result.Error == nil && result.RowsAffected == 0 {
+				return ErrStaleIdentity
+			}
+			return result.Error
+		})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ssp.ErrNotFound
+		}
+		return err
+	}
+	newIdentity.Pidk = oldIdk
+	as.trackVersion(newIdentity, 0)
+	return nil
+}
+
+// checkRekeyCycle returns ErrRekeyCycle if linking newIdk after oldIdk,
+// whose own Pidk is pidk, would close a loop in the rekey graph: newIdk is
+// a predecessor of oldIdk, or is stored as already rekeyed to oldIdk.
+func (as *AuthStore) checkRekeyCycle(tx *gorm.DB, oldIdk, pidk, newIdk string) error {
+	seen := map[string]bool{oldIdk: true}
+	for pidk != "" && !seen[pidk] {
+		if pidk == newIdk {
+			return ErrRekeyCycle
+		}
+		seen[pidk] = true
+		var predecessor identityRecord
+		err := as.allIdentities(tx).Select("pidk").Where("idk = ?", as.lookupKey(pidk)).Take(&predecessor).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		pidk = predecessor.Pidk
+	}
+	var existing identityRecord
+	defer clearRecord(&existing)
+	err := as.allIdentities(tx).Select("idk", "rekeyed").Where("idk = ?", as.lookupKey(newIdk)).Take(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Rekeyed == oldIdk {
+		return ErrRekeyCycle
+	}
+	return nil
+}
+
+// MaxRekeyChainLength is the most identities GetRekeyChain follows. No real
+// identity is rekeyed that often, so a longer chain is taken to be corrupt.
+const MaxRekeyChainLength = 100
+
+// GetRekeyChain returns the rekey history of the identity idk, oldest first:
+// its predecessors found by following Pidk back, the identity itself, and
+// its successors found by following Rekeyed forward. The chain ends at a
+// key with no stored identity. Returns ssp.ErrNotFound if idk itself does
+// not exist, and ErrRekeyCycle if the links loop back on themselves or the
+// chain is longer than MaxRekeyChainLength, which only corrupt data can
+// produce. idk is validated first.
+//
+// The returned identities carry Suk and Vuk. Callers must ClearIdentity each
+// one when done.
+func (as *AuthStore) GetRekeyChain(idk string) ([]*ssp.SqrlIdentity, error) {
+	return as.GetRekeyChainWithContext(as.baseContext(), idk)
+}
+
+// GetRekeyChainWithContext is GetRekeyChain with context support for
+// timeout and cancellation control. The read timeout covers the whole walk.
+func (as *AuthStore) GetRekeyChainWithContext(ctx context.Context, idk string) (_ []*ssp.SqrlIdentity, err error) {
+	ctx, done := as.observe(ctx, "GetRekeyChain", idk, &err)
+	defer done()
+	if err := as.validateIdk(idk); err != nil {
+		return nil, err
+	}
+	var loaded, chain []*identityRecord
+	defer func() {
+		for _, record := range loaded {
+			clearRecord(record)
+		}
+	}()
+	err = as.run(ctx, opRead, func(db *gorm.DB) error {
+		visited := make(map[string]bool)
+		// load reads the identity key, or returns nil if it is not stored.
+		load := func(key string) (*identityRecord, error) {
+			if visited[key] || len(visited) >= MaxRekeyChainLength {
+				return nil, ErrRekeyCycle
+			}
+			visited[key] = true
+			record := &identityRecord{}
+			loaded = append(loaded, record)
+			err := as.identities(db).Where("idk = ?", as.lookupKey(key)).Take(record).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := as.verifyRecord(record); err != nil {
+				return nil, err
+			}
+			record.Idk = key
+			return record, nil
+		}
+
+		start, err := load(idk)
+		if err != nil {
+			return err
+		}
+		if start == nil {
+			return gorm.ErrRecordNotFound
+		}
+		chain = []*identityRecord{start}
+		for pidk := start.Pidk; pidk != ""; pidk = chain[0].Pidk {
+			record, err := load(pidk)
+			if err != nil {
+				return err
+			}
+			if record == nil {
+				break
+			}
+			chain = slices.Insert(chain, 0, record)
+		}
+		for rekeyed := start.Rekeyed; rekeyed != ""; rekeyed = chain[len(chain)-1].Rekeyed {
+			record, err := load(rekeyed)
+			if err != nil {
+				return err
+			}
+			if record == nil {
+				break
+			}
+			chain = append(chain, record)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ssp.ErrNotFound
+		}
+		return nil, err
+	}
+	identities := make([]*ssp.SqrlIdentity, len(chain))
+	for i, record := range chain {
+		identities[i] = toIdentity(record)
+		as.trackVersion(identities[i], record.Version)
+	}
+	return identities, nil
+}
+
+// RenameIdentity changes an identity's key from oldIdk to newIdk in a single
+// transaction, rewriting every other row whose Pidk or Rekeyed pointed at
+// oldIdk, soft-deleted ones included, so the rekey graph stays consistent.
+//
+// This is for a change in key representation, not a SQRL rekey: the
+// identity's secrets and flags are carried over unchanged.
+// Returns ssp.ErrNotFound if oldIdk does not exist and ErrDuplicateIdentity
+// if newIdk is already in use. Both keys are validated first.
+func (as *AuthStore) RenameIdentity(ctx context.Context, oldIdk, newIdk string) (err error) {
+	ctx, done := as.observe(ctx, "RenameIdentity", oldIdk, &err)
+	defer done()
+	if err := as.validateIdk(oldIdk); err != nil {
+		return err
+	}
+	if err := as.validateIdk(newIdk); err != nil {
+		return err
+	}
+	oldKey, newKey := as.lookupKey(oldIdk), as.lookupKey(newIdk)
+	return as.run(ctx, opWriteOnce, func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			if err := as.identities(tx).Where("idk = ?", oldKey).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ssp.ErrNotFound
+			}
+			if oldIdk == newIdk {
+				return nil
+			}
+			// A soft-deleted row still holds its key.
+			if err := as.allIdentities(tx).Where("idk = ?", newKey).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrDuplicateIdentity
+			}
+
+			if as.cfg.cipher != nil || as.cfg.integrityKey != nil {
+				return as.renameRecords(tx, oldIdk, newIdk)
+			}
+			now := as.now()
+			for _, column := range []string{"idk", "pidk", "rekeyed"} {
+				from, to := oldIdk, newIdk
+				if column == "idk" {
+					from, to = oldKey, newKey
+				}
+				err := as.allIdentities(tx).Where(column+" = ?", from).
+					Updates(map[string]interface{}{column: to, "version": gorm.Expr("version + 1"), "updated_at": now}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// renameRecords is RenameIdentity's rewrite under WithEncryptionKey or
+// WithIntegrityKey. Sealed Rekeyed values use a random nonce, so the
+// database cannot match them, and every changed row needs a new integrity
+// tag; affected rows are therefore read, verified, changed here and
+// written back whole through the model, which seals them.
+func (as *AuthStore) renameRecords(tx *gorm.DB, oldIdk, newIdk string) error {
+	var records []identityRecord
+	oldKey, newKey := as.lookupKey(oldIdk), as.lookupKey(newIdk)
+	err := as.allIdentities(tx).Where("idk = ? OR pidk = ? OR rekeyed <> ''", oldKey, oldIdk).Find(&records).Error
+	defer func() {
+		for i := range records {
+			clearRecord(&records[i])
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	columns := append([]string{"idk", "version", "updated_at"}, identityColumns...)
+	now := as.now()
+	for i := range records {
+		r := &records[i]
+		if r.Idk != oldKey && r.Pidk != oldIdk && r.Rekeyed != oldIdk {
+			continue
+		}
+		if err := as.verifyRecord(r); err != nil {
+			return err
+		}
+		stored := r.Idk
+		if r.Idk == oldKey {
+			r.Idk = newKey
+		}
+		for _, field := range []*string{&r.Pidk, &r.Rekeyed} {
+			if *field == oldIdk {
+				*field = newIdk
+			}
+		}
+		r.Version++
+		r.UpdatedAt = now
+		as.signRecord(r)
+		err := as.allIdentities(tx).Model(&identityRecord{}).Where("idk = ?", stored).
+			Select(columns).Updates(r).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// TestRenameIdentity_MovesRowAndReferences verifies the row and every Pidk or
+// Rekeyed reference to the old key are rewritten.
+func TestRenameIdentity_MovesRowAndReferences(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	ctx := context.Background()
+
+	seedIdentity(t, store, newTestIdentity().withIdk("rename-prev").withRekeyed("rename-old").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("rename-old").withSuk("old-suk").withPidk("rename-prev").
+		withRekeyed("rename-next").withBtn(2).build())
+	seedIdentity(t, store, newTestIdentity().withIdk("rename-next").withPidk("rename-old").build())
+
+	if err := store.RenameIdentity(ctx, "rename-old", "rename-new"); err != nil {
+		t.Fatalf("RenameIdentity failed: %v", err)
+	}
+
+	if _, err := store.FindIdentity("rename-old"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("old key should be gone, got %v", err)
+	}
+	renamed, err := store.FindIdentity("rename-new")
+	if err != nil {
+		t.Fatalf("FindIdentity(new) failed: %v", err)
+	}
+	if renamed.Suk != "old-suk" || renamed.Pidk != "rename-prev" || renamed.Rekeyed != "rename-next" || renamed.Btn != 2 {
+		t.Errorf("renamed identity lost fields: %+v", renamed)
+	}
+
+	prev, err := store.FindIdentity("rename-prev")
+	if err != nil {
+		t.Fatalf("FindIdentity(prev) failed: %v", err)
+	}
+	if prev.Rekeyed != "rename-new" {
+		t.Errorf("predecessor Rekeyed: got %q, want %q", prev.Rekeyed, "rename-new")
+	}
+	next, err := store.FindIdentity("rename-next")
+	if err != nil {
+		t.Fatalf("FindIdentity(next) failed: %v", err)
+	}
+	if next.Pidk != "rename-new" {
+		t.Errorf("successor Pidk: got %q, want %q", next.Pidk, "rename-new")
+	}
+}
+
+// TestRenameIdentity_NotFound verifies a missing old key returns ssp.ErrNotFound.
+func TestRenameIdentity_NotFound(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+
+	err := store.RenameIdentity(context.Background(), "rename-missing", "rename-target")
+	if !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("expected ssp.ErrNotFound, got %v", err)
+	}
+}
+
+// TestRenameIdentity_Duplicate verifies an existing new key is rejected and
+// nothing is modified.
+func TestRenameIdentity_Duplicate(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("rename-a").withSuk("suk-a").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("rename-b").withSuk("suk-b").build())
+
+	err := store.RenameIdentity(context.Background(), "rename-a", "rename-b")
+	if !errors.Is(err, ErrDuplicateIdentity) {
+		t.Fatalf("expected ErrDuplicateIdentity, got %v", err)
+	}
+
+	for idk, suk := range map[string]string{"rename-a": "suk-a", "rename-b": "suk-b"} {
+		found, err := store.FindIdentity(idk)
+		if err != nil {
+			t.Fatalf("FindIdentity(%q) failed: %v", idk, err)
+		}
+		if found.Suk != suk {
+			t.Errorf("%q Suk: got %q, want %q", idk, found.Suk, suk)
+		}
+	}
+}
+
+// TestRenameIdentity_ValidatesKeys verifies both keys are validated before any SQL.
+func TestRenameIdentity_ValidatesKeys(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	ctx := context.Background()
+
+	if err := store.RenameIdentity(ctx, "", "rename-ok"); !errors.Is(err, ErrEmptyIdentityKey) {
+		t.Errorf("empty old key: expected ErrEmptyIdentityKey, got %v", err)
+	}
+	if err := store.RenameIdentity(ctx, "rename-ok", "bad key!"); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("invalid new key: expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+}
+
+// TestRenameIdentity_SameKey verifies renaming to the same key is a no-op.
+func TestRenameIdentity_SameKey(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("rename-same").build())
+
+	if err := store.RenameIdentity(context.Background(), "rename-same", "rename-same"); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
+
+// TestRekey mirrors IT-008 through Rekey: the new identity is stored linked
+// to the old one and the old one is marked rekeyed, under every option that
+// changes how rows are written.
+func TestRekey(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":      nil,
+		"encryption": {WithEncryptionKey(testKey(EncryptionKeySize, 1))},
+		"integrity":  {WithIntegrityKey(testKey(IntegrityKeyMinSize, 1))},
+		"pepper":     {WithIdkPepper(testKey(IdkPepperMinSize, 1))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, store := newTestStoreWithOptions(t, opts...)
+			seedIdentity(t, store, newTestIdentity().withIdk("rekey-old").build())
+			newIdentity := newTestIdentity().withIdk("rekey-new").withSuk("new-suk").build()
+
+			if err := store.Rekey("rekey-old", newIdentity); err != nil {
+				t.Fatalf("Rekey: %v", err)
+			}
+			if newIdentity.Pidk != "rekey-old" {
+				t.Errorf("caller's Pidk: got %q, want rekey-old", newIdentity.Pidk)
+			}
+			if found, err := store.FindIdentity("rekey-old"); err != nil || found.Rekeyed != "rekey-new" {
+				t.Errorf("old identity: got %+v, %v, want Rekeyed rekey-new", found, err)
+			}
+			if found, err := store.FindIdentity("rekey-new"); err != nil || *found != *newIdentity {
+				t.Errorf("new identity: got %+v, %v, want %+v", found, err, *newIdentity)
+			}
+		})
+	}
+}
+
+// TestRekey_RollsBackOnCollision verifies a new key already in use leaves
+// the old identity unlinked.
+func TestRekey_RollsBackOnCollision(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("rekey-old").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("rekey-taken").withBtn(7).build())
+
+	err := store.RekeyWithContext(context.Background(), "rekey-old", newTestIdentity().withIdk("rekey-taken").build())
+	if !errors.Is(err, ErrDuplicateIdentity) {
+		t.Fatalf("expected ErrDuplicateIdentity, got %v", err)
+	}
+	if found, err := store.FindIdentity("rekey-old"); err != nil || found.Rekeyed != "" {
+		t.Errorf("old identity was linked: got %+v, %v", found, err)
+	}
+	if found, err := store.FindIdentity("rekey-taken"); err != nil || found.Btn != 7 || found.Pidk != "" {
+		t.Errorf("existing identity was changed: got %+v, %v", found, err)
+	}
+}
+
+// TestRekey_Cycle verifies a new key that leads back to the old one is
+// rejected and nothing is written.
+func TestRekey_Cycle(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("cycle-a").build())
+	if err := store.Rekey("cycle-a", newTestIdentity().withIdk("cycle-b").build()); err != nil {
+		t.Fatalf("Rekey a to b: %v", err)
+	}
+	if err := store.Rekey("cycle-b", newTestIdentity().withIdk("cycle-c").build()); err != nil {
+		t.Fatalf("Rekey b to c: %v", err)
+	}
+	// An identity rekeyed to cycle-d without the Pidk back-link.
+	seedIdentity(t, store, newTestIdentity().withIdk("cycle-d").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("cycle-e").withRekeyed("cycle-d").build())
+
+	for _, tt := range []struct{ old, new string }{
+		{"cycle-c", "cycle-a"},
+		{"cycle-c", "cycle-c"},
+		{"cycle-d", "cycle-e"},
+	} {
+		if err := store.Rekey(tt.old, newTestIdentity().withIdk(tt.new).build()); !errors.Is(err, ErrRekeyCycle) {
+			t.Errorf("%s to %s: expected ErrRekeyCycle, got %v", tt.old, tt.new, err)
+		}
+	}
+	if n := countRows(t, db); n != 5 {
+		t.Errorf("rows: got %d, want 5", n)
+	}
+	if found, err := store.FindIdentity("cycle-c"); err != nil || found.Rekeyed != "" {
+		t.Errorf("cycle-c was linked: got %+v, %v", found, err)
+	}
+}
+
+// TestRekey_Errors verifies a missing old identity and invalid input.
+func TestRekey_Errors(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	if err := store.Rekey("rekey-missing", newTestIdentity().withIdk("rekey-new").build()); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("missing old identity: expected ssp.ErrNotFound, got %v", err)
+	}
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("new identity stored for a missing old one: %d rows", n)
+	}
+	if err := store.Rekey("bad idk", newTestIdentity().withIdk("rekey-new").build()); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("invalid old key: expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+	if err := store.Rekey("rekey-old", nil); !errors.Is(err, ErrNilIdentity) {
+		t.Errorf("nil identity: expected ErrNilIdentity, got %v", err)
+	}
+}
+
+// TestGetRekeyChain verifies the whole chain is returned oldest first from
+// any identity in it.
+func TestGetRekeyChain(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":  nil,
+		"pepper": {WithIdkPepper(testKey(IdkPepperMinSize, 1))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, store := newTestStoreWithOptions(t, opts...)
+			seedIdentity(t, store, newTestIdentity().withIdk("chain-a").build())
+			for _, link := range [][2]string{{"chain-a", "chain-b"}, {"chain-b", "chain-c"}} {
+				if err := store.Rekey(link[0], newTestIdentity().withIdk(link[1]).build()); err != nil {
+					t.Fatalf("Rekey %s to %s: %v", link[0], link[1], err)
+				}
+			}
+			seedIdentity(t, store, newTestIdentity().withIdk("chain-alone").build())
+
+			for _, idk := range []string{"chain-a", "chain-b", "chain-c"} {
+				chain, err := store.GetRekeyChain(idk)
+				if err != nil {
+					t.Fatalf("%s: %v", idk, err)
+				}
+				if got := fmt.Sprint(idks(chain)); got != "[chain-a chain-b chain-c]" {
+					t.Errorf("%s: got %s, want [chain-a chain-b chain-c]", idk, got)
+				}
+			}
+			chain, err := store.GetRekeyChainWithContext(context.Background(), "chain-alone")
+			if err != nil || fmt.Sprint(idks(chain)) != "[chain-alone]" {
+				t.Errorf("unlinked identity: got %v, %v", idks(chain), err)
+			}
+		})
+	}
+}
+
+// TestGetRekeyChain_Corrupt verifies looping or overlong links are reported
+// as ErrRekeyCycle and a link to a missing identity ends the chain.
+func TestGetRekeyChain_Corrupt(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("loop-a").withPidk("loop-b").withRekeyed("loop-b").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("loop-b").withPidk("loop-a").withRekeyed("loop-a").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("dangling").withPidk("gone-1").withRekeyed("gone-2").build())
+	for i := 0; i <= MaxRekeyChainLength; i++ {
+		identity := newTestIdentity().withIdk(fmt.Sprintf("long-%03d", i))
+		if i > 0 {
+			identity = identity.withPidk(fmt.Sprintf("long-%03d", i-1))
+		}
+		seedIdentity(t, store, identity.build())
+	}
+
+	for _, idk := range []string{"loop-a", fmt.Sprintf("long-%03d", MaxRekeyChainLength)} {
+		if _, err := store.GetRekeyChain(idk); !errors.Is(err, ErrRekeyCycle) {
+			t.Errorf("%s: expected ErrRekeyCycle, got %v", idk, err)
+		}
+	}
+	if chain, err := store.GetRekeyChain("long-050"); err != nil || len(chain) != 51 {
+		t.Errorf("long-050: got %d identities, %v, want 51", len(chain), err)
+	}
+	if chain, err := store.GetRekeyChain("dangling"); err != nil || fmt.Sprint(idks(chain)) != "[dangling]" {
+		t.Errorf("dangling links: got %v, %v", idks(chain), err)
+	}
+}
+
+// TestGetRekeyChain_Errors verifies a missing identity and an invalid key.
+func TestGetRekeyChain_Errors(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	if _, err := store.GetRekeyChain("chain-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("missing identity: expected ssp.ErrNotFound, got %v", err)
+	}
+	if _, err := store.GetRekeyChain("bad idk"); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("invalid key: expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+}
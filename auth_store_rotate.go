@@ -0,0 +1,190 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sealedRow is the raw, unopened form of the sealed columns, read and
+// written by RotateEncryptionKey without the model's serializers.
+type sealedRow struct {
+	Idk     string `gorm:"column:idk"`
+	Suk     []byte `gorm:"column:suk"`
+	Vuk     []byte `gorm:"column:vuk"`
+	Rekeyed []byte `gorm:"column:rekeyed"`
+}
+
+// RotateEncryptionKey re-seals Suk, Vuk and Rekeyed of every identity under
+// newKey, opening values sealed under oldKey or already under newKey.
+// Under WithPlaintextMigration, plaintext values left from before
+// encryption was enabled are sealed too; otherwise they stop the rotation
+// with ErrDecryptionFailed.
+//
+// The table is walked in idk order in transactions of DefaultBatchSize
+// rows, so a failure leaves earlier batches rotated and the rest untouched.
+// Values already sealed under newKey are skipped, which makes the rotation
+// idempotent: after a crash, run it again with the same keys.
+//
+// To rotate without downtime, first deploy every store with
+// WithEncryptionKey(newKey) and WithPreviousEncryptionKeys(oldKey), so new
+// writes use newKey and rows on either side are readable; then rotate;
+// then drop oldKey. A value sealed under neither key stops the rotation
+// with ErrDecryptionFailed. Each batch is read under a row lock and a row
+// is only rewritten while it holds the values read, so a SaveIdentity
+// racing the rotation is never overwritten with the old values.
+func (as *AuthStore) RotateEncryptionKey(oldKey, newKey []byte) error {
+	return as.RotateEncryptionKeyWithContext(as.baseContext(), oldKey, newKey)
+}
+
+// RotateEncryptionKeyWithContext is RotateEncryptionKey with context support
+// for cancellation. Like EachIdentity it is bounded only by ctx, not by the
+// write timeout.
+func (as *AuthStore) RotateEncryptionKeyWithContext(ctx context.Context, oldKey, newKey []byte) (err error) {
+	ctx, done := as.observe(ctx, "RotateEncryptionKey", "", &err)
+	defer done()
+	c, err := newFieldCipher(newKey, oldKey)
+	if err != nil {
+		return err
+	}
+	c.acceptPlaintext = as.cfg.plaintextMigration
+	binary := as.cfg.binaryKeys
+	return as.run(ctx, opStream, func(db *gorm.DB) error {
+		after := ""
+		for {
+			var rows []sealedRow
+			err := db.Transaction(func(tx *gorm.DB) error {
+				err := as.allIdentities(tx).Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+					Select("idk", "suk", "vuk", "rekeyed").
+					Where("idk > ?", after).Order("idk").Limit(DefaultBatchSize).
+					Find(&rows).Error
+				if err != nil {
+					return err
+				}
+				for _, row := range rows {
+					if err := as.rotateRow(tx, c, row, binary); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil || len(rows) < DefaultBatchSize {
+				return err
+			}
+			after = rows[len(rows)-1].Idk
+		}
+	})
+}
+
+// rotateRow re-seals row, as read, under c's primary key. The update only
+// applies while the row still holds the values read, which guards against a
+// write landing in between where FOR UPDATE is ignored, as on SQLite; a
+// row that changed is read again and the values it now holds re-sealed.
+func (as *AuthStore) rotateRow(tx *gorm.DB, c *fieldCipher, row sealedRow, binary bool) error {
+	for {
+		updates, err := c.resealRow(row, binary)
+		if err != nil || len(updates) == 0 {
+			return err
+		}
+		result := as.allIdentities(tx).Where("idk = ?", row.Idk).Scopes(row.unchanged(binary)).Updates(updates)
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		err = as.allIdentities(tx).Select("idk", "suk", "vuk", "rekeyed").Where("idk = ?", row.Idk).Take(&row).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unchanged returns a scope matching the row only while its sealed columns
+// still hold the values in r.
+func (r sealedRow) unchanged(binary bool) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, col := range []struct {
+			name   string
+			stored []byte
+			binary bool
+		}{
+			{"suk", r.Suk, binary},
+			{"vuk", r.Vuk, binary},
+			{"rekeyed", r.Rekeyed, false},
+		} {
+			switch {
+			case col.stored == nil:
+				db = db.Where(col.name + " IS NULL")
+			case col.binary:
+				db = db.Where(col.name+" = ?", col.stored)
+			default:
+				db = db.Where(col.name+" = ?", string(col.stored))
+			}
+		}
+		return db
+	}
+}
+
+// resealRow returns the column updates that bring row under c's primary
+// key, or none if it is already there.
+func (c *fieldCipher) resealRow(row sealedRow, binary bool) (map[string]interface{}, error) {
+	updates := make(map[string]interface{})
+	for _, col := range []struct {
+		name   string
+		stored []byte
+		binary bool
+	}{
+		{"suk", row.Suk, binary},
+		{"vuk", row.Vuk, binary},
+		{"rekeyed", row.Rekeyed, false},
+	} {
+		value, changed, err := c.reseal(col.name, row.Idk, string(col.stored), col.binary)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+		if col.binary {
+			updates[col.name] = []byte(value)
+		} else {
+			updates[col.name] = value
+		}
+	}
+	return updates, nil
+}
+
+// reseal returns stored, a value of column in the row keyed by idk, sealed
+// under c's primary key. changed is false when stored is empty or already
+// sealed under it. A plaintext stored fails with ErrDecryptionFailed unless
+// c accepts plaintext.
+func (c *fieldCipher) reseal(column, idk, stored string, binary bool) (value string, changed bool, err error) {
+	if stored == "" {
+		return "", false, nil
+	}
+	sealed, ok, err := decodeSealed(column, stored, binary)
+	if err != nil {
+		return "", false, err
+	}
+	if !ok && !c.acceptPlaintext {
+		return "", false, fmt.Errorf("%w: %s: value is not sealed", ErrDecryptionFailed, column)
+	}
+	plain := stored
+	if ok {
+		if c.sealedByPrimary(column, idk, sealed) {
+			return "", false, nil
+		}
+		if plain, err = c.open(column, idk, sealed); err != nil {
+			return "", false, err
+		}
+	}
+	resealed, err := c.seal(column, idk, plain)
+	if err != nil {
+		return "", false, err
+	}
+	return encodeSealed(resealed, binary), true, nil
+}
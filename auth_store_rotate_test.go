@@ -0,0 +1,204 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// storedSuks returns the raw suk column of every row keyed by idk.
+func storedSuks(t *testing.T, db *gorm.DB) map[string]string {
+	t.Helper()
+	var rows []sealedRow
+	if err := db.Table("sqrl_identities").Select("idk", "suk").Find(&rows).Error; err != nil {
+		t.Fatalf("raw select: %v", err)
+	}
+	suks := make(map[string]string, len(rows))
+	for _, row := range rows {
+		suks[row.Idk] = string(row.Suk)
+	}
+	return suks
+}
+
+// TestRotateEncryptionKey verifies every row, across several batches, is
+// re-sealed under the new key and readable with it alone.
+func TestRotateEncryptionKey(t *testing.T) {
+	oldKey, newKey := testKey(EncryptionKeySize, 1), testKey(EncryptionKeySize, 2)
+	db, store := newTestStoreWithOptions(t, WithEncryptionKey(oldKey))
+	batch := batchOf("rot", DefaultBatchSize+DefaultBatchSize/2)
+	for _, identity := range batch {
+		identity.Rekeyed = identity.Idk + "-next"
+	}
+	if err := store.SaveIdentities(batch); err != nil {
+		t.Fatalf("SaveIdentities failed: %v", err)
+	}
+
+	if err := store.RotateEncryptionKey(oldKey, newKey); err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+
+	rotated := NewAuthStore(db, WithEncryptionKey(newKey))
+	for _, identity := range batch {
+		found, err := rotated.FindIdentity(identity.Idk)
+		if err != nil {
+			t.Fatalf("FindIdentity(%s) with new key failed: %v", identity.Idk, err)
+		}
+		if *found != *identity {
+			t.Fatalf("FindIdentity(%s): got %+v, want %+v", identity.Idk, *found, *identity)
+		}
+	}
+	for idk, suk := range storedSuks(t, db) {
+		sealed, ok, err := decodeSealed("suk", suk, false)
+		if !ok || err != nil || sealed[0] != encryptionKeyID(newKey) {
+			t.Fatalf("%s: suk not sealed under new key id", idk)
+		}
+	}
+	if _, err := store.FindIdentity(batch[0].Idk); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("old key after rotation: expected ErrDecryptionFailed, got %v", err)
+	}
+}
+
+// TestRotateEncryptionKey_MixedAndResumable verifies a store holding both
+// keys reads a half-rotated table, and that rotation resumes from such a
+// state and is a no-op when repeated.
+func TestRotateEncryptionKey_MixedAndResumable(t *testing.T) {
+	oldKey, newKey := testKey(EncryptionKeySize, 1), testKey(EncryptionKeySize, 2)
+	db, store := newTestStoreWithOptions(t, WithEncryptionKey(oldKey))
+	seedIdentity(t, store, newTestIdentity().withIdk("rot-a").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("rot-b").build())
+
+	// A crash mid-rotation: rot-b is already under the new key.
+	both := NewAuthStore(db, WithEncryptionKey(newKey), WithPreviousEncryptionKeys(oldKey), WithPlaintextMigration())
+	seedIdentity(t, both, newTestIdentity().withIdk("rot-b").build())
+	seedIdentity(t, NewAuthStore(db), newTestIdentity().withIdk("rot-plain").build())
+	for _, idk := range []string{"rot-a", "rot-b", "rot-plain"} {
+		if _, err := both.FindIdentity(idk); err != nil {
+			t.Errorf("mixed state FindIdentity(%s) failed: %v", idk, err)
+		}
+	}
+	before := storedSuks(t, db)
+
+	if err := both.RotateEncryptionKey(oldKey, newKey); err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	after := storedSuks(t, db)
+	if after["rot-b"] != before["rot-b"] {
+		t.Error("row already under the new key was rewritten")
+	}
+	if after["rot-a"] == before["rot-a"] || after["rot-plain"] == before["rot-plain"] {
+		t.Error("old-key and plaintext rows were not re-sealed")
+	}
+
+	if err := both.RotateEncryptionKey(oldKey, newKey); err != nil {
+		t.Fatalf("repeated RotateEncryptionKey failed: %v", err)
+	}
+	again := storedSuks(t, db)
+	for idk := range after {
+		if again[idk] != after[idk] {
+			t.Errorf("%s rewritten by repeated rotation", idk)
+		}
+	}
+	rotated := NewAuthStore(db, WithEncryptionKey(newKey))
+	for _, idk := range []string{"rot-a", "rot-b", "rot-plain"} {
+		if _, err := rotated.FindIdentity(idk); err != nil {
+			t.Errorf("FindIdentity(%s) with new key failed: %v", idk, err)
+		}
+	}
+}
+
+// TestRotateEncryptionKey_BinaryKeyStorage verifies rotation of binary
+// key columns.
+func TestRotateEncryptionKey_BinaryKeyStorage(t *testing.T) {
+	oldKey, newKey := testKey(EncryptionKeySize, 1), testKey(EncryptionKeySize, 2)
+	db, store := newTestStoreWithOptions(t, WithBinaryKeyStorage(), WithEncryptionKey(oldKey))
+	identity := newTestIdentity().withIdk("rot-binary").withSuk("suk\x00\xff").withRekeyed("rot-binary-next").build()
+	seedIdentity(t, store, identity)
+
+	if err := store.RotateEncryptionKey(oldKey, newKey); err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	found, err := NewAuthStore(db, WithBinaryKeyStorage(), WithEncryptionKey(newKey)).FindIdentity("rot-binary")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("FindIdentity: got %+v, want %+v", *found, *identity)
+	}
+}
+
+// TestRotateEncryptionKey_Errors verifies bad keys and values sealed under
+// an unknown key stop the rotation.
+func TestRotateEncryptionKey_Errors(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithEncryptionKey(testKey(EncryptionKeySize, 1)))
+	seedIdentity(t, store, newTestIdentity().withIdk("rot-err").build())
+
+	if err := store.RotateEncryptionKey([]byte("short"), testKey(EncryptionKeySize, 2)); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Errorf("short old key: expected ErrInvalidEncryptionKey, got %v", err)
+	}
+	err := store.RotateEncryptionKeyWithContext(context.Background(), testKey(EncryptionKeySize, 3), testKey(EncryptionKeySize, 2))
+	if !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("unknown key: expected ErrDecryptionFailed, got %v", err)
+	}
+	if _, err := store.FindIdentity("rot-err"); err != nil {
+		t.Errorf("failed rotation changed the row: %v", err)
+	}
+
+	orphan := NewAuthStore(db, WithPreviousEncryptionKeys(testKey(EncryptionKeySize, 1)))
+	if _, err := orphan.FindIdentity("rot-err"); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Errorf("previous keys alone: expected ErrInvalidEncryptionKey, got %v", err)
+	}
+}
+
+// TestRotateEncryptionKey_ConcurrentWrite verifies a write landing between
+// the batch read and its update is kept rather than overwritten.
+func TestRotateEncryptionKey_ConcurrentWrite(t *testing.T) {
+	oldKey, newKey := testKey(EncryptionKeySize, 1), testKey(EncryptionKeySize, 2)
+	db, store := newTestStoreWithOptions(t, WithEncryptionKey(oldKey))
+	seedIdentity(t, store, newTestIdentity().withIdk("rot-race").withSuk("stale-suk").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("rot-quiet").build())
+
+	c, err := newFieldCipher(newKey)
+	if err != nil {
+		t.Fatalf("newFieldCipher failed: %v", err)
+	}
+	sealed, err := c.seal("suk", "rot-race", "fresh-suk")
+	if err != nil {
+		t.Fatalf("seal failed: %v", err)
+	}
+	written := false
+	err = db.Callback().Query().After("gorm:query").Register("test:concurrent_write", func(tx *gorm.DB) {
+		if written || tx.Statement.Table != store.TableName() {
+			return
+		}
+		written = true
+		err := tx.Session(&gorm.Session{NewDB: true}).Table(store.TableName()).
+			Where("idk = ?", "rot-race").Update("suk", encodeSealed(sealed, false)).Error
+		if err != nil {
+			t.Errorf("concurrent write failed: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Register callback failed: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Callback().Query().Remove("test:concurrent_write") })
+
+	if err := store.RotateEncryptionKey(oldKey, newKey); err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	if !written {
+		t.Fatal("concurrent write never ran")
+	}
+	rotated := NewAuthStore(db, WithEncryptionKey(newKey))
+	found, err := rotated.FindIdentity("rot-race")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if found.Suk != "fresh-suk" {
+		t.Errorf("Suk: got %q, want the concurrent write %q", found.Suk, "fresh-suk")
+	}
+	if _, err := rotated.FindIdentity("rot-quiet"); err != nil {
+		t.Errorf("FindIdentity(rot-quiet) with new key failed: %v", err)
+	}
+}
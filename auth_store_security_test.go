@@ -303,6 +303,48 @@ func TestUnicodeNormalizationAttacks(t *testing.T) {
 	}
 }
 
+// SEC-006b: Unicode normalisation forms
+// Verifies decomposed (NFD) sequences and combining marks are rejected, by
+// ValidateIdk and by a store whose custom validator admits non-ASCII keys,
+// so visually identical keys cannot be stored under two byte sequences.
+func TestUnicodeNormalizationForms(t *testing.T) {
+	decomposed := []struct {
+		name  string
+		value string
+	}{
+		{"nfd_e_acute", "cafe\u0301"},
+		{"nfd_a_umlaut", "a\u0308bc"},
+		{"combining_ring_and_acute", "A\u030A\u0301"},
+		{"hangul_jamo", "\u1100\u1161"},
+	}
+	db, _ := openSecurityTestDB(t)
+	store := NewAuthStore(db, WithValidator(func(string) error { return nil }))
+
+	for _, tc := range decomposed {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := ValidateIdk(tc.value); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+				t.Errorf("ValidateIdk: expected ErrInvalidIdentityKeyFormat, got %v", err)
+			}
+			if _, err := store.FindIdentity(tc.value); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+				t.Errorf("FindIdentity: expected ErrInvalidIdentityKeyFormat, got %v", err)
+			}
+			err := store.SaveIdentity(&ssp.SqrlIdentity{Idk: tc.value, Suk: "suk", Vuk: "vuk"})
+			if !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+				t.Errorf("SaveIdentity: expected ErrInvalidIdentityKeyFormat, got %v", err)
+			}
+		})
+	}
+
+	// The composed (NFC) form is accepted by the permissive validator.
+	composed := &ssp.SqrlIdentity{Idk: "caf\u00E9", Suk: "suk", Vuk: "vuk"}
+	if err := store.SaveIdentity(composed); err != nil {
+		t.Fatalf("SaveIdentity(NFC) failed: %v", err)
+	}
+	if _, err := store.FindIdentity("caf\u00E9"); err != nil {
+		t.Errorf("FindIdentity(NFC) failed: %v", err)
+	}
+}
+
 // SEC-007: FindIdentitySecure wrapper behaviour
 // Verifies that FindIdentitySecure returns a valid wrapper that provides
 // access to the identity and properly cleans up on Destroy().
@@ -425,9 +467,11 @@ func TestSecureIdentityWrapper_NilSafety(t *testing.T) {
 // SEC-012: clearRecord wipes sensitive fields from identityRecord.
 func TestClearRecord_WipesSensitiveFields(t *testing.T) {
 	record := &identityRecord{
-		Idk: "test-idk",
-		Suk: "secret-suk",
-		Vuk: "secret-vuk",
+		Idk:     "test-idk",
+		Suk:     "secret-suk",
+		Vuk:     "secret-vuk",
+		Pidk:    "previous-idk",
+		Rekeyed: "successor-idk",
 	}
 
 	clearRecord(record)
@@ -438,6 +482,12 @@ func TestClearRecord_WipesSensitiveFields(t *testing.T) {
 	if record.Vuk != "" {
 		t.Errorf("Vuk not wiped: %q", record.Vuk)
 	}
+	if record.Pidk != "" {
+		t.Errorf("Pidk not wiped: %q", record.Pidk)
+	}
+	if record.Rekeyed != "" {
+		t.Errorf("Rekeyed not wiped: %q", record.Rekeyed)
+	}
 	// Idk should be untouched (not sensitive in this context -- it's the lookup key)
 	if record.Idk != "test-idk" {
 		t.Errorf("Idk should be untouched: got %q", record.Idk)
@@ -0,0 +1,114 @@
+package gormauthstore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// keyText is the model type of the Suk and Vuk columns. It holds the key as
+// a string, like ssp.SqrlIdentity, while letting the column be stored as
+// text (the default) or as binary under WithBinaryKeyStorage.
+type keyText string
+
+// binaryKeysKey marks an operation context of a store using binary key storage.
+type binaryKeysKey struct{}
+
+// usesBinaryKeys reports whether ctx belongs to a store using binary key storage.
+func usesBinaryKeys(ctx context.Context) bool {
+	binary, _ := ctx.Value(binaryKeysKey{}).(bool)
+	return binary
+}
+
+// GormDBDataType selects a binary column type when migrating a store using
+// binary key storage, and the dialect's default string type otherwise.
+func (keyText) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	if !usesBinaryKeys(db.Statement.Context) {
+		return ""
+	}
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "bytea"
+	case "sqlserver":
+		return "varbinary(max)"
+	default:
+		return "blob"
+	}
+}
+
+// keySerializer converts keyText columns to and from the database. It writes
+// []byte for binary key storage and a string otherwise, and reads either.
+// The conversion is a plain byte copy, so it is lossless. Under
+// WithEncryptionKey non-empty values are sealed on write and opened on read,
+// bound to the record's Idk; a read must therefore select idk ahead of the
+// sealed columns, as SELECT * of the table does.
+//
+// textOnly marks a plain string column, such as rekeyed, that is never
+// binary but is still sealed.
+type keySerializer struct {
+	textOnly bool
+}
+
+func init() {
+	schema.RegisterSerializer("sqrlkey", keySerializer{})
+	schema.RegisterSerializer("sqrlsealed", keySerializer{textOnly: true})
+}
+
+// binary reports whether the serializer's column is stored as binary in ctx.
+func (ks keySerializer) binary(ctx context.Context) bool {
+	return !ks.textOnly && usesBinaryKeys(ctx)
+}
+
+// Scan implements schema.SerializerInterface.
+func (ks keySerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var s string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("unsupported key column value of type %T", dbValue)
+	}
+	s, err := openColumn(ctx, field.DBName, rowKey(ctx, field, dst), s, ks.binary(ctx))
+	if err != nil {
+		return err
+	}
+	field.ReflectValueOf(ctx, dst).SetString(s)
+	return nil
+}
+
+// Value implements schema.SerializerValuerInterface.
+func (ks keySerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var key string
+	switch v := fieldValue.(type) {
+	case keyText:
+		key = string(v)
+	case string:
+		key = v
+	}
+	key, err := sealColumn(ctx, field.DBName, rowKey(ctx, field, dst), key, ks.binary(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if ks.binary(ctx) {
+		return []byte(key), nil
+	}
+	return key, nil
+}
+
+// rowKey returns the stored idk of the record dst, which its sealed columns
+// are bound to, or "" if dst holds none.
+func rowKey(ctx context.Context, field *schema.Field, dst reflect.Value) string {
+	idk := field.Schema.LookUpField("idk")
+	if idk == nil || !dst.IsValid() {
+		return ""
+	}
+	v, _ := idk.ValueOf(ctx, dst)
+	s, _ := v.(string)
+	return s
+}
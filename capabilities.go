@@ -0,0 +1,113 @@
+package gormauthstore
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// capabilities caches what the connected database supports. It is probed
+// lazily on first use and shared by every copy of a store (WithSession,
+// transaction-scoped copies), since they all talk to the same server.
+type capabilities struct {
+	mu        sync.Mutex
+	probed    bool
+	returning bool
+}
+
+// canReturn reports whether db accepts INSERT ... RETURNING. The first call
+// asks the server for its version; a failed probe is not cached, so a
+// cancelled context cannot pin the store to the fallback path.
+func (as *AuthStore) canReturn(db *gorm.DB) bool {
+	if as.caps == nil {
+		version, _ := serverVersion(db)
+		return supportsReturning(db.Dialector.Name(), version)
+	}
+	as.caps.mu.Lock()
+	defer as.caps.mu.Unlock()
+	if !as.caps.probed {
+		version, err := serverVersion(db)
+		if err != nil {
+			return false
+		}
+		as.caps.returning = supportsReturning(db.Dialector.Name(), version)
+		as.caps.probed = true
+	}
+	return as.caps.returning
+}
+
+// canUpdateReturning reports whether db accepts UPDATE ... RETURNING:
+// where it accepts INSERT ... RETURNING, except MariaDB, which returns rows
+// only from INSERT and DELETE.
+func (as *AuthStore) canUpdateReturning(db *gorm.DB) bool {
+	return db.Dialector.Name() != "mysql" && as.canReturn(db)
+}
+
+// serverVersion returns the database version string for dialects whose
+// RETURNING support depends on it, and "" for the others.
+func serverVersion(db *gorm.DB) (string, error) {
+	var query string
+	switch db.Dialector.Name() {
+	case "sqlite":
+		query = "SELECT sqlite_version()"
+	case "mysql":
+		query = "SELECT VERSION()"
+	default:
+		return "", nil
+	}
+	var version string
+	if err := db.Raw(query).Scan(&version).Error; err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// supportsReturning reports whether the given dialect and server version
+// accept INSERT ... RETURNING: PostgreSQL always, SQLite from 3.35.0 and
+// MariaDB from 10.5.0. MySQL, SQL Server and unknown dialects use the
+// read-after-write fallback, as does an unparseable version.
+func supportsReturning(dialect, version string) bool {
+	switch dialect {
+	case "postgres":
+		return true
+	case "sqlite":
+		return versionAtLeast(version, 3, 35, 0)
+	case "mysql":
+		return strings.Contains(strings.ToLower(version), "mariadb") &&
+			versionAtLeast(version, 10, 5, 0)
+	default:
+		return false
+	}
+}
+
+// versionAtLeast reports whether the leading "major.minor.patch" of version
+// is at least the given one. Missing components count as zero; trailing
+// text such as "-MariaDB" or "-log" is ignored.
+func versionAtLeast(version string, want ...int) bool {
+	end := strings.IndexFunc(version, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if end >= 0 {
+		version = version[:end]
+	}
+	if version == "" {
+		return false
+	}
+	parts := strings.Split(version, ".")
+	for i, w := range want {
+		got := 0
+		if i < len(parts) {
+			n, err := strconv.Atoi(parts[i])
+			if err != nil {
+				return false
+			}
+			got = n
+		}
+		if got != w {
+			return got > w
+		}
+	}
+	return true
+}
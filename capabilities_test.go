@@ -0,0 +1,100 @@
+package gormauthstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// TestSupportsReturning verifies the dialect and version gate.
+func TestSupportsReturning(t *testing.T) {
+	tests := []struct {
+		dialect string
+		version string
+		want    bool
+	}{
+		{"postgres", "", true},
+		{"postgres", "9.6.24", true},
+		{"sqlite", "3.35.0", true},
+		{"sqlite", "3.45.1", true},
+		{"sqlite", "3.34.1", false},
+		{"sqlite", "3", false},
+		{"sqlite", "", false},
+		{"sqlite", "garbage", false},
+		{"mysql", "8.0.36", false},
+		{"mysql", "8.0.36-log", false},
+		{"mysql", "10.5.0-MariaDB", true},
+		{"mysql", "10.11.6-MariaDB-0+deb12u1", true},
+		{"mysql", "10.4.32-MariaDB", false},
+		{"sqlserver", "16.0.1000.6", false},
+		{"unknown", "99", false},
+	}
+	for _, tt := range tests {
+		if got := supportsReturning(tt.dialect, tt.version); got != tt.want {
+			t.Errorf("supportsReturning(%q, %q) = %v, want %v", tt.dialect, tt.version, got, tt.want)
+		}
+	}
+}
+
+// TestCanReturn_ProbesSQLiteVersion verifies the probe reads the live SQLite
+// version and caches the result.
+func TestCanReturn_ProbesSQLiteVersion(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+
+	version, err := serverVersion(db)
+	if err != nil {
+		t.Fatalf("serverVersion: %v", err)
+	}
+	want := supportsReturning("sqlite", version)
+	if got := store.canReturn(db); got != want {
+		t.Errorf("canReturn = %v for sqlite %s, want %v", got, version, want)
+	}
+	if !store.caps.probed {
+		t.Error("probe result was not cached")
+	}
+}
+
+// TestSaveAndReload_FallbackMatchesReturning verifies the read-after-write
+// fallback and the RETURNING path produce identical results for inserts and
+// updates.
+func TestSaveAndReload_FallbackMatchesReturning(t *testing.T) {
+	_, returning := newTestStoreWithOptions(t)
+	fallbackDB, fallback := newTestStoreWithOptions(t)
+	fallback.caps = &capabilities{probed: true, returning: false}
+
+	var sql string
+	err := fallbackDB.Callback().Create().After("gorm:create").Register("test:capture_insert", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	ctx := context.Background()
+	steps := []struct {
+		name     string
+		identity func() *ssp.SqrlIdentity
+	}{
+		{"insert", newTestIdentity().withIdk("cap-reload").withPidk("cap-prev").withBtn(3).build},
+		{"update", newTestIdentity().withIdk("cap-reload").withSuk("cap-suk-2").withDisabled().build},
+	}
+	for _, step := range steps {
+		want, err := returning.SaveAndReload(ctx, step.identity())
+		if err != nil {
+			t.Fatalf("%s: RETURNING path: %v", step.name, err)
+		}
+		got, err := fallback.SaveAndReload(ctx, step.identity())
+		if err != nil {
+			t.Fatalf("%s: fallback path: %v", step.name, err)
+		}
+		if *got != *want {
+			t.Errorf("%s: paths differ:\nfallback  %+v\nreturning %+v", step.name, *got, *want)
+		}
+		if strings.Contains(sql, "RETURNING") {
+			t.Errorf("%s: fallback used RETURNING: %s", step.name, sql)
+		}
+	}
+}
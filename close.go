@@ -0,0 +1,37 @@
+package gormauthstore
+
+import "io"
+
+var _ io.Closer = (*AuthStore)(nil)
+
+// usable returns ErrNilDatabase for a store without a database,
+// ErrStoreClosed after Close, and nil otherwise. Every operation checks it
+// before touching the database.
+func (as *AuthStore) usable() error {
+	if as.db == nil {
+		return ErrNilDatabase
+	}
+	if as.closed.Load() {
+		return ErrStoreClosed
+	}
+	return nil
+}
+
+// Close releases the store's connection pool by closing the underlying
+// *sql.DB, for services that create a store per tenant. Afterwards every
+// operation of the store, and of the copies made with WithSession or
+// WithTx, returns ErrStoreClosed. Closing again is a no-op.
+//
+// The pool is shared with the *gorm.DB the store was created from, which is
+// unusable afterwards too. A store from NewAuthStoreFromSQL does not own its
+// pool: Close only marks it closed and leaves the *sql.DB to the caller.
+func (as *AuthStore) Close() error {
+	if as.db == nil || as.closed.Swap(true) || as.borrowedPool {
+		return nil
+	}
+	sqlDB, err := as.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
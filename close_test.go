@@ -0,0 +1,69 @@
+package gormauthstore
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// TestClose verifies Close releases the pool and that the store and its
+// copies then fail cleanly with ErrStoreClosed.
+func TestClose(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("close-1").build())
+	session := store.WithSession(&gorm.Session{})
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := store.FindIdentity("close-1"); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("FindIdentity after Close: expected ErrStoreClosed, got %v", err)
+	}
+	if err := session.SaveIdentity(newTestIdentity().withIdk("close-2").build()); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("copy after Close: expected ErrStoreClosed, got %v", err)
+	}
+	if err := store.Transaction(func(*AuthStore) error { return nil }); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("Transaction after Close: expected ErrStoreClosed, got %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	if err := sqlDB.Ping(); err == nil {
+		t.Error("pool still open after Close")
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if err := NewAuthStore(nil).Close(); err != nil {
+		t.Errorf("Close on nil db: %v", err)
+	}
+}
+
+// TestClose_BorrowedPool verifies Close leaves a NewAuthStoreFromSQL pool
+// open for its owner.
+func TestClose_BorrowedPool(t *testing.T) {
+	registerSQLiteDialect(t)
+	sqlDB, err := sql.Open(sqlite.DriverName, "file:closeborrowed?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer sqlDB.Close()
+
+	store, err := NewAuthStoreFromSQL(sqlDB, "sqlite")
+	if err != nil {
+		t.Fatalf("NewAuthStoreFromSQL failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		t.Errorf("caller's pool closed: %v", err)
+	}
+	if _, err := store.CountIdentities(); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("CountIdentities after Close: expected ErrStoreClosed, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package gormauthstore
+
+import "context"
+
+// correlationIDKey is the context key for a request correlation ID. It is an
+// unexported type so no other package can collide with it.
+type correlationIDKey struct{}
+
+// ContextWithCorrelationID returns a copy of ctx carrying a request
+// correlation ID. Pass the result to the *WithContext methods and the
+// store attaches the ID to what it emits for that operation, without any
+// change to method signatures: the correlation_id attribute of WithLogger
+// records, and of spans started by the otel package. An empty id leaves
+// ctx unchanged.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID stored in ctx by
+// ContextWithCorrelationID, and false when none is present. Observability
+// hooks omit the field entirely in that case.
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(correlationIDKey{}).(string)
+	return id, ok && id != ""
+}
@@ -0,0 +1,63 @@
+package gormauthstore
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// TestCorrelationID_RoundTrip verifies an ID stored on a context can be read back.
+func TestCorrelationID_RoundTrip(t *testing.T) {
+	ctx := ContextWithCorrelationID(context.Background(), "req-1234")
+
+	id, ok := CorrelationIDFromContext(ctx)
+	if !ok || id != "req-1234" {
+		t.Errorf("got (%q, %v), want (%q, true)", id, ok, "req-1234")
+	}
+}
+
+// TestCorrelationID_Absent verifies a context without an ID reports none.
+func TestCorrelationID_Absent(t *testing.T) {
+	if id, ok := CorrelationIDFromContext(context.Background()); ok || id != "" {
+		t.Errorf("expected no correlation ID, got (%q, %v)", id, ok)
+	}
+
+	//nolint:staticcheck // SA1012: a nil context must be tolerated.
+	if _, ok := CorrelationIDFromContext(nil); ok {
+		t.Error("expected no correlation ID for nil context")
+	}
+}
+
+// TestCorrelationID_EmptyIgnored verifies an empty ID does not shadow an outer one.
+func TestCorrelationID_EmptyIgnored(t *testing.T) {
+	outer := ContextWithCorrelationID(context.Background(), "outer")
+	ctx := ContextWithCorrelationID(outer, "")
+
+	if id, _ := CorrelationIDFromContext(ctx); id != "outer" {
+		t.Errorf("got %q, want %q", id, "outer")
+	}
+}
+
+// TestCorrelationID_FlowsThroughStore verifies the ID is visible to the
+// database layer for the operation it was attached to.
+func TestCorrelationID_FlowsThroughStore(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("corr-idk").build())
+
+	var seen string
+	err := db.Callback().Query().Before("gorm:query").Register("test:correlation", func(tx *gorm.DB) {
+		seen, _ = CorrelationIDFromContext(tx.Statement.Context)
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	ctx := ContextWithCorrelationID(context.Background(), "req-flow")
+	if _, err := store.FindIdentityWithContext(ctx, "corr-idk"); err != nil {
+		t.Fatalf("FindIdentityWithContext failed: %v", err)
+	}
+	if seen != "req-flow" {
+		t.Errorf("correlation ID at query time: got %q, want %q", seen, "req-flow")
+	}
+}
@@ -0,0 +1,215 @@
+package gormauthstore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// EncryptionKeySize is the length in bytes of a WithEncryptionKey key,
+// selecting AES-256.
+const EncryptionKeySize = 32
+
+// sealedPrefix marks a column value sealed by a fieldCipher. Values without
+// it are plaintext, which a store with a cipher accepts only under
+// WithPlaintextMigration, to read rows written before encryption was
+// enabled; they are sealed the next time they are saved.
+const sealedPrefix = "enc:"
+
+// fieldCipher seals and opens Suk, Vuk and Rekeyed with AES-256-GCM. A
+// sealed value is keyID || nonce || ciphertext: the key-id byte names the
+// key that sealed it, so rows sealed under a previous key stay readable
+// while RotateEncryptionKey works through the table. Each value gets a
+// fresh random nonce and, as additional data, the column name and the
+// row's stored idk (see sealingAAD), so a sealed value cannot be moved to
+// another column or another row undetected.
+type fieldCipher struct {
+	primary sealingKey
+	// keys holds every key accepted by open, primary first.
+	keys []sealingKey
+	// acceptPlaintext lets unsealed values through as plaintext; see
+	// WithPlaintextMigration.
+	acceptPlaintext bool
+}
+
+// sealingKey is one AES-256-GCM key and its key-id byte.
+type sealingKey struct {
+	id   byte
+	aead cipher.AEAD
+}
+
+// newFieldCipher returns a fieldCipher sealing with key and opening values
+// sealed with key or any of previous. Every key must be EncryptionKeySize
+// bytes.
+func newFieldCipher(key []byte, previous ...[]byte) (*fieldCipher, error) {
+	c := &fieldCipher{}
+	for _, k := range append([][]byte{key}, previous...) {
+		sk, err := newSealingKey(k)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, sk)
+	}
+	c.primary = c.keys[0]
+	return c, nil
+}
+
+func newSealingKey(key []byte) (sealingKey, error) {
+	if len(key) != EncryptionKeySize {
+		return sealingKey{}, fmt.Errorf("%w: got %d bytes, want %d", ErrInvalidEncryptionKey, len(key), EncryptionKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return sealingKey{}, fmt.Errorf("%w: %v", ErrInvalidEncryptionKey, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return sealingKey{}, fmt.Errorf("%w: %v", ErrInvalidEncryptionKey, err)
+	}
+	return sealingKey{id: encryptionKeyID(key), aead: aead}, nil
+}
+
+// encryptionKeyID derives the key-id byte of key from its SHA-256 digest.
+// It identifies a key without revealing it; two keys may share an id, in
+// which case open tries both.
+func encryptionKeyID(key []byte) byte {
+	sum := sha256.Sum256(key)
+	return sum[0]
+}
+
+// sealingAAD returns the additional data a value of column in the row
+// keyed by idk is sealed with. idk is the stored key, the WithIdkPepper
+// hash where one is set, so a row whose key changes must be resealed. The
+// column names never contain the NUL separator.
+func sealingAAD(column, idk string) []byte {
+	return []byte(column + "\x00" + idk)
+}
+
+// seal returns keyID || nonce || ciphertext of plaintext under the primary
+// key, bound to column and the row's stored idk.
+func (c *fieldCipher) seal(column, idk, plaintext string) ([]byte, error) {
+	aead := c.primary.aead
+	out := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out[0] = c.primary.id
+	nonce := out[1:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, []byte(plaintext), sealingAAD(column, idk)), nil
+}
+
+// open reverses seal with whichever key carries the value's key id. Any
+// failure, including an unknown key, tampering or a value sealed for
+// another row, is reported as ErrDecryptionFailed.
+func (c *fieldCipher) open(column, idk string, sealed []byte) (string, error) {
+	if len(sealed) == 0 {
+		return "", fmt.Errorf("%w: %s: value too short", ErrDecryptionFailed, column)
+	}
+	for _, k := range c.keys {
+		if k.id != sealed[0] {
+			continue
+		}
+		n := k.aead.NonceSize()
+		body := sealed[1:]
+		if len(body) < n+k.aead.Overhead() {
+			return "", fmt.Errorf("%w: %s: value too short", ErrDecryptionFailed, column)
+		}
+		if plain, err := k.aead.Open(nil, body[:n], body[n:], sealingAAD(column, idk)); err == nil {
+			return string(plain), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrDecryptionFailed, column)
+}
+
+// sealedByPrimary reports whether sealed carries the primary key's id and
+// opens under it, i.e. needs no rotation.
+func (c *fieldCipher) sealedByPrimary(column, idk string, sealed []byte) bool {
+	if len(sealed) == 0 || sealed[0] != c.primary.id {
+		return false
+	}
+	n := c.primary.aead.NonceSize()
+	body := sealed[1:]
+	if len(body) < n+c.primary.aead.Overhead() {
+		return false
+	}
+	_, err := c.primary.aead.Open(nil, body[:n], body[n:], sealingAAD(column, idk))
+	return err == nil
+}
+
+// fieldCipherKey carries the store's fieldCipher in an operation context.
+type fieldCipherKey struct{}
+
+// cipherFrom returns the fieldCipher of the store owning ctx, or nil when
+// the store does not encrypt.
+func cipherFrom(ctx context.Context) *fieldCipher {
+	c, _ := ctx.Value(fieldCipherKey{}).(*fieldCipher)
+	return c
+}
+
+// sealColumn encodes a non-empty plaintext of the row keyed by idk for
+// storage when ctx carries a cipher: as sealedPrefix followed by the raw
+// sealed bytes in a binary column, or by their base64 encoding in a text
+// column. Empty values are stored as-is so filters on an empty rekeyed keep
+// working.
+func sealColumn(ctx context.Context, column, idk, plaintext string, binary bool) (string, error) {
+	c := cipherFrom(ctx)
+	if c == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	sealed, err := c.seal(column, idk, plaintext)
+	if err != nil {
+		return "", err
+	}
+	return encodeSealed(sealed, binary), nil
+}
+
+// encodeSealed formats sealed bytes as a stored column value.
+func encodeSealed(sealed []byte, binary bool) string {
+	if binary {
+		return sealedPrefix + string(sealed)
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// decodeSealed reverses encodeSealed. ok is false for a plaintext value.
+func decodeSealed(column, stored string, binary bool) (sealed []byte, ok bool, err error) {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return nil, false, nil
+	}
+	sealed = []byte(stored[len(sealedPrefix):])
+	if !binary {
+		if sealed, err = base64.StdEncoding.DecodeString(string(sealed)); err != nil {
+			return nil, true, fmt.Errorf("%w: %s: malformed value", ErrDecryptionFailed, column)
+		}
+	}
+	return sealed, true, nil
+}
+
+// openColumn decodes a stored value written by sealColumn. Empty values,
+// and plaintext ones without a cipher or under WithPlaintextMigration, are
+// returned unchanged. Any other plaintext value, which a writer to the row
+// could have put in place of a sealed one, fails with ErrDecryptionFailed,
+// as does a sealed value read without a cipher, or with the wrong key or
+// row.
+func openColumn(ctx context.Context, column, idk, stored string, binary bool) (string, error) {
+	sealed, ok, err := decodeSealed(column, stored, binary)
+	if err != nil {
+		return "", err
+	}
+	c := cipherFrom(ctx)
+	if !ok {
+		if c != nil && !c.acceptPlaintext && stored != "" {
+			return "", fmt.Errorf("%w: %s: value is not sealed", ErrDecryptionFailed, column)
+		}
+		return stored, nil
+	}
+	if c == nil {
+		return "", fmt.Errorf("%w: %s: no encryption key configured", ErrDecryptionFailed, column)
+	}
+	return c.open(column, idk, sealed)
+}
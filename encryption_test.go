@@ -0,0 +1,205 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// TestWithEncryptionKey_RoundTrip verifies Suk, Vuk and Rekeyed are stored
+// sealed while Idk and Pidk stay plaintext, and every read path returns the
+// original values.
+func TestWithEncryptionKey_RoundTrip(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithEncryptionKey(testKey(EncryptionKeySize, 1)))
+	identity := newTestIdentity().withIdk("enc-1").withSuk("enc-suk").withVuk("enc-vuk").
+		withPidk("enc-prev").withRekeyed("enc-next").build()
+	seedIdentity(t, store, identity)
+
+	var stored struct{ Idk, Suk, Vuk, Pidk, Rekeyed string }
+	if err := db.Raw("SELECT idk, suk, vuk, pidk, rekeyed FROM sqrl_identities WHERE idk = ?", "enc-1").Scan(&stored).Error; err != nil {
+		t.Fatalf("raw select: %v", err)
+	}
+	for name, pair := range map[string][2]string{
+		"suk":     {stored.Suk, identity.Suk},
+		"vuk":     {stored.Vuk, identity.Vuk},
+		"rekeyed": {stored.Rekeyed, identity.Rekeyed},
+	} {
+		if pair[0] == pair[1] || strings.Contains(pair[0], pair[1]) {
+			t.Errorf("%s stored in plaintext: %q", name, pair[0])
+		}
+		if !strings.HasPrefix(pair[0], sealedPrefix) {
+			t.Errorf("%s: got %q, want %q prefix", name, pair[0], sealedPrefix)
+		}
+	}
+	if stored.Idk != identity.Idk || stored.Pidk != identity.Pidk {
+		t.Errorf("idk/pidk: got %q/%q, want plaintext", stored.Idk, stored.Pidk)
+	}
+
+	found, err := store.FindIdentity("enc-1")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("FindIdentity: got %+v, want %+v", *found, *identity)
+	}
+	rekeyed, err := store.ListRekeyedAway(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatalf("ListRekeyedAway failed: %v", err)
+	}
+	if len(rekeyed) != 1 || *rekeyed[0] != *identity {
+		t.Errorf("ListRekeyedAway: got %v", rekeyed)
+	}
+
+	seedIdentity(t, store, identity)
+	var again string
+	if err := db.Raw("SELECT suk FROM sqrl_identities WHERE idk = ?", "enc-1").Scan(&again).Error; err != nil {
+		t.Fatalf("raw select: %v", err)
+	}
+	if again == stored.Suk {
+		t.Error("resaving produced identical ciphertext; nonce is not random")
+	}
+}
+
+// TestWithEncryptionKey_DecryptionFailure verifies a sealed row read with
+// the wrong key, with no key, or after tampering, including values moved
+// between columns or rows, fails with ErrDecryptionFailed.
+func TestWithEncryptionKey_DecryptionFailure(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithEncryptionKey(testKey(EncryptionKeySize, 1)))
+	seedIdentity(t, store, newTestIdentity().withIdk("enc-fail").build())
+
+	for name, other := range map[string]*AuthStore{
+		"wrong key": NewAuthStore(db, WithEncryptionKey(testKey(EncryptionKeySize, 2))),
+		"no key":    NewAuthStore(db),
+	} {
+		if _, err := other.FindIdentity("enc-fail"); !errors.Is(err, ErrDecryptionFailed) {
+			t.Errorf("%s: expected ErrDecryptionFailed, got %v", name, err)
+		}
+	}
+
+	// Values are bound to their column: swapping Suk and Vuk is detected.
+	if err := db.Exec("UPDATE sqrl_identities SET suk = vuk, vuk = suk WHERE idk = ?", "enc-fail").Error; err != nil {
+		t.Fatalf("swap: %v", err)
+	}
+	if _, err := store.FindIdentity("enc-fail"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("swapped columns: expected ErrDecryptionFailed, got %v", err)
+	}
+
+	// And to their row: another identity's Suk and Vuk copied in are too.
+	seedIdentity(t, store, newTestIdentity().withIdk("enc-victim").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("enc-thief").build())
+	err := db.Exec("UPDATE sqrl_identities SET suk = (SELECT suk FROM sqrl_identities WHERE idk = ?), "+
+		"vuk = (SELECT vuk FROM sqrl_identities WHERE idk = ?) WHERE idk = ?", "enc-victim", "enc-victim", "enc-thief").Error
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if _, err := store.FindIdentity("enc-thief"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("values from another row: expected ErrDecryptionFailed, got %v", err)
+	}
+}
+
+// TestWithEncryptionKey_ReadsPlaintextRows verifies rows written before
+// encryption was enabled remain readable under WithPlaintextMigration and
+// are sealed when next saved.
+func TestWithEncryptionKey_ReadsPlaintextRows(t *testing.T) {
+	db, plain := newTestStoreWithOptions(t)
+	identity := newTestIdentity().withIdk("enc-legacy").build()
+	seedIdentity(t, plain, identity)
+
+	store := NewAuthStore(db, WithEncryptionKey(testKey(EncryptionKeySize, 1)), WithPlaintextMigration())
+	found, err := store.FindIdentity("enc-legacy")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("FindIdentity: got %+v, want %+v", *found, *identity)
+	}
+
+	seedIdentity(t, store, found)
+	var suk string
+	if err := db.Raw("SELECT suk FROM sqrl_identities WHERE idk = ?", "enc-legacy").Scan(&suk).Error; err != nil {
+		t.Fatalf("raw select: %v", err)
+	}
+	if !strings.HasPrefix(suk, sealedPrefix) {
+		t.Errorf("resaved suk not sealed: %q", suk)
+	}
+}
+
+// TestWithEncryptionKey_RejectsPlaintext verifies a sealed value replaced in
+// the database by a plaintext one fails to open unless
+// WithPlaintextMigration is set.
+func TestWithEncryptionKey_RejectsPlaintext(t *testing.T) {
+	key := testKey(EncryptionKeySize, 1)
+	db, store := newTestStoreWithOptions(t, WithEncryptionKey(key))
+	seedIdentity(t, store, newTestIdentity().withIdk("enc-downgrade").build())
+	if err := db.Exec("UPDATE sqrl_identities SET suk = ? WHERE idk = ?", "forged-suk", "enc-downgrade").Error; err != nil {
+		t.Fatalf("raw update: %v", err)
+	}
+
+	if _, err := store.FindIdentity("enc-downgrade"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("downgraded suk: expected ErrDecryptionFailed, got %v", err)
+	}
+	if err := store.RotateEncryptionKey(key, testKey(EncryptionKeySize, 2)); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("rotating downgraded suk: expected ErrDecryptionFailed, got %v", err)
+	}
+	migrating := NewAuthStore(db, WithEncryptionKey(key), WithPlaintextMigration())
+	if found, err := migrating.FindIdentity("enc-downgrade"); err != nil || found.Suk != "forged-suk" {
+		t.Errorf("under WithPlaintextMigration: got %+v, %v", found, err)
+	}
+}
+
+// TestWithEncryptionKey_InvalidKey verifies a key of the wrong length makes
+// every operation fail instead of silently storing plaintext.
+func TestWithEncryptionKey_InvalidKey(t *testing.T) {
+	db, _ := newTestStoreWithOptions(t)
+	store := NewAuthStore(db, WithEncryptionKey([]byte("too short")))
+
+	if err := store.SaveIdentity(newTestIdentity().withIdk("enc-bad-key").build()); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Errorf("SaveIdentity: expected ErrInvalidEncryptionKey, got %v", err)
+	}
+	if _, err := store.FindIdentity("enc-bad-key"); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Errorf("FindIdentity: expected ErrInvalidEncryptionKey, got %v", err)
+	}
+}
+
+// TestWithEncryptionKey_BinaryKeyStorage verifies encryption combines with
+// binary key columns.
+func TestWithEncryptionKey_BinaryKeyStorage(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithBinaryKeyStorage(), WithEncryptionKey(testKey(EncryptionKeySize, 1)))
+	identity := newTestIdentity().withIdk("enc-binary").withSuk("suk\x00\xff").withRekeyed("enc-binary-next").build()
+
+	reloaded, err := store.SaveAndReload(context.Background(), identity)
+	if err != nil {
+		t.Fatalf("SaveAndReload failed: %v", err)
+	}
+	if *reloaded != *identity {
+		t.Errorf("SaveAndReload: got %+v, want %+v", *reloaded, *identity)
+	}
+}
+
+// TestWithEncryptionKey_RenameIdentity verifies RenameIdentity rewrites a
+// sealed Rekeyed pointing at the old key.
+func TestWithEncryptionKey_RenameIdentity(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithEncryptionKey(testKey(EncryptionKeySize, 1)))
+	seedIdentity(t, store, newTestIdentity().withIdk("enc-old").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("enc-prior").withRekeyed("enc-old").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("enc-other").withRekeyed("enc-elsewhere").build())
+
+	if err := store.RenameIdentity(context.Background(), "enc-old", "enc-new"); err != nil {
+		t.Fatalf("RenameIdentity failed: %v", err)
+	}
+	for idk, want := range map[string]string{"enc-prior": "enc-new", "enc-other": "enc-elsewhere"} {
+		found, err := store.FindIdentity(idk)
+		if err != nil {
+			t.Fatalf("FindIdentity(%s) failed: %v", idk, err)
+		}
+		if found.Rekeyed != want {
+			t.Errorf("%s rekeyed: got %q, want %q", idk, found.Rekeyed, want)
+		}
+	}
+	if _, err := store.FindIdentity("enc-old"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("old key: expected ssp.ErrNotFound, got %v", err)
+	}
+}
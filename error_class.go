@@ -0,0 +1,182 @@
+package gormauthstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// classifiedError is a database failure marked ErrTransient or ErrStore.
+// errors.Unwrap returns the original error.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+// Error formats the failure as "transient database error: cause".
+func (e *classifiedError) Error() string {
+	return e.class.Error() + ": " + e.err.Error()
+}
+
+// Unwrap returns the original error.
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// Is matches the class, ErrTransient or ErrStore.
+func (e *classifiedError) Is(target error) bool {
+	return target == e.class
+}
+
+// IsRetryable reports whether the failure is transient.
+func (e *classifiedError) IsRetryable() bool {
+	return e.class == ErrTransient
+}
+
+// duplicateError is a unique violation reported as ErrDuplicateIdentity.
+// Its message is the sentinel's alone, since the driver's may quote the
+// identity key; errors.Unwrap returns the driver's error.
+type duplicateError struct {
+	err error
+}
+
+func (e *duplicateError) Error() string { return ErrDuplicateIdentity.Error() }
+
+// Unwrap returns the driver's error.
+func (e *duplicateError) Unwrap() error { return e.err }
+
+// Is matches ErrDuplicateIdentity.
+func (e *duplicateError) Is(target error) bool { return target == ErrDuplicateIdentity }
+
+// IsRetryable reports whether err, returned by a store operation, is a
+// transient database failure worth retrying, one matching ErrTransient.
+// Invalid input, a missing identity and other outcomes of the operation
+// itself are never retryable.
+func IsRetryable(err error) bool {
+	var retryable interface{ IsRetryable() bool }
+	return errors.As(err, &retryable) && retryable.IsRetryable()
+}
+
+// ErrorClass returns a description of err, returned by a store operation,
+// that is safe to log or export: the message of the sentinel error it
+// matches, such as ErrTransient or ssp.ErrNotFound, or OutcomeError for
+// any other error, such as one from an EachIdentity callback. The text of
+// err itself is never used, since a driver or WithValidator error may
+// quote an identity key. ErrorClass returns "" for a nil err.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, outcome := range outcomeErrors {
+		if errors.Is(err, outcome) {
+			return outcome.Error()
+		}
+	}
+	return OutcomeError
+}
+
+// callbackError carries the error of a caller's callback, such as
+// EachIdentity's fn, through run unchanged.
+type callbackError struct {
+	err error
+}
+
+func (e callbackError) Error() string { return e.err.Error() }
+
+// outcomeErrors are errors that report the outcome of an operation rather
+// than a database failure, and are returned by run as they are.
+var outcomeErrors = []error{
+	ssp.ErrNotFound,
+	context.Canceled,
+	ErrEmptyIdentityKey,
+	ErrIdentityKeyTooLong,
+	ErrInvalidIdentityKeyFormat,
+	ErrNilIdentity,
+	ErrFieldTooLong,
+	ErrEmptyFilter,
+	ErrInvalidPagination,
+	ErrDuplicateIdentity,
+	ErrIdentityHardlocked,
+	ErrIdentityDisabled,
+	ErrAmbiguousPidk,
+	ErrRekeyCycle,
+	ErrStaleIdentity,
+	ErrDecryptionFailed,
+	ErrIntegrityCheckFailed,
+	ErrNotInTransaction,
+	ErrSchemaVersionMismatch,
+	ErrTimestampsUnavailable,
+	ErrUnsupportedDialect,
+	ErrTransient,
+	ErrStore,
+}
+
+// transientMessages are driver error fragments reporting a failure that may
+// not recur: a lost connection, a busy database or a deadlock victim.
+var transientMessages = []string{
+	"database is closed",   // database/sql, closed pool
+	"bad connection",       // database/sql, driver.ErrBadConn
+	"invalid connection",   // MySQL, dropped connection
+	"connection refused",   // every network driver
+	"connection reset",     // every network driver
+	"broken pipe",          // every network driver
+	"database is locked",   // SQLite, SQLITE_BUSY
+	"deadlock",             // PostgreSQL 40P01, MySQL 1213
+	"lock wait timeout",    // MySQL 1205
+	"server has gone away", // MySQL 2006
+}
+
+// transientSQLStates are SQLSTATE codes and classes of transient failures:
+// connection exceptions, serialization failures, deadlocks and server
+// shutdown.
+var transientSQLStates = []string{"08", "40001", "40P01", "57P01", "57P02", "57P03"}
+
+// classifyError marks a database failure returned by run as ErrTransient or
+// ErrStore. Errors in outcomeErrors are returned as they are.
+func classifyError(err error) error {
+	for _, outcome := range outcomeErrors {
+		if errors.Is(err, outcome) {
+			return err
+		}
+	}
+	class := ErrStore
+	if isTransient(err) {
+		class = ErrTransient
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// isTransient reports whether err is a failure that may succeed if retried.
+func isTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		for _, prefix := range transientSQLStates {
+			if strings.HasPrefix(state.SQLState(), prefix) {
+				return true
+			}
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range transientMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
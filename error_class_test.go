@@ -0,0 +1,132 @@
+package gormauthstore
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// TestClassifyError verifies database failures are marked transient or not,
+// keep the original error, and that outcomes pass through unmarked.
+func TestClassifyError(t *testing.T) {
+	for name, tt := range map[string]struct {
+		err  error
+		want error
+	}{
+		"deadline":        {context.DeadlineExceeded, ErrTransient},
+		"bad conn":        {fmt.Errorf("query: %w", driver.ErrBadConn), ErrTransient},
+		"refused":         {&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, ErrTransient},
+		"reset":           {syscall.ECONNRESET, ErrTransient},
+		"closed pool":     {errors.New("sql: database is closed"), ErrTransient},
+		"sqlite busy":     {errors.New("database is locked (5) (SQLITE_BUSY)"), ErrTransient},
+		"connection lost": {sqlStateError("08006"), ErrTransient},
+		"serialization":   {sqlStateError("40001"), ErrTransient},
+		"syntax":          {sqlStateError("42601"), ErrStore},
+		"no such table":   {errors.New("no such table: sqrl_identities"), ErrStore},
+		"not found":       {ssp.ErrNotFound, nil},
+		"hardlocked":      {ErrIdentityHardlocked, nil},
+		"canceled":        {context.Canceled, nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := classifyError(tt.err)
+			if tt.want == nil {
+				if got != tt.err {
+					t.Fatalf("outcome was changed: got %v", got)
+				}
+				if IsRetryable(got) {
+					t.Error("outcome is retryable")
+				}
+				return
+			}
+			if !errors.Is(got, tt.want) || errors.Unwrap(got) != tt.err {
+				t.Fatalf("got %v, want %v wrapping %v", got, tt.want, tt.err)
+			}
+			if IsRetryable(got) != (tt.want == ErrTransient) {
+				t.Errorf("IsRetryable: got %v", IsRetryable(got))
+			}
+			if errors.Is(got, ErrTransient) && errors.Is(got, ErrStore) {
+				t.Error("matches both ErrTransient and ErrStore")
+			}
+		})
+	}
+	if IsRetryable(nil) || IsRetryable(errors.New("other")) {
+		t.Error("unclassified errors are retryable")
+	}
+}
+
+// TestRun_DuplicateOmitsDriverText verifies a unique violation is reported
+// as ErrDuplicateIdentity without the driver's message, which quotes the
+// key, while still unwrapping to the driver's error.
+func TestRun_DuplicateOmitsDriverText(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	driverErr := errors.New("Error 1062: Duplicate entry 'dup-leak' for key 'PRIMARY'")
+	err := db.Callback().Create().Before("gorm:create").Register("test:duplicate", func(tx *gorm.DB) {
+		tx.AddError(driverErr)
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	err = store.SaveIdentityInsertOnly(context.Background(), newTestIdentity().withIdk("dup-leak").build())
+	if !errors.Is(err, ErrDuplicateIdentity) || !errors.Is(err, driverErr) {
+		t.Fatalf("expected ErrDuplicateIdentity wrapping the driver error, got %v", err)
+	}
+	if err.Error() != ErrDuplicateIdentity.Error() {
+		t.Errorf("message: got %q, want %q", err.Error(), ErrDuplicateIdentity.Error())
+	}
+}
+
+// TestErrorClass verifies failures are described by their sentinel, never
+// by their own text.
+func TestErrorClass(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{ssp.ErrNotFound, ssp.ErrNotFound.Error()},
+		{fmt.Errorf("%w: key k1", ErrDuplicateIdentity), ErrDuplicateIdentity.Error()},
+		{classifyError(errors.New("Duplicate entry 'k1'")), ErrStore.Error()},
+		{classifyError(driver.ErrBadConn), ErrTransient.Error()},
+		{errors.New("callback failed for k1"), OutcomeError},
+	} {
+		if got := ErrorClass(tt.err); got != tt.want {
+			t.Errorf("ErrorClass(%v): got %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestRun_ClassifiesErrors verifies store operations return classified
+// database failures and callback errors unchanged.
+func TestRun_ClassifiesErrors(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("cls-1").build())
+
+	sentinel := errors.New("stop")
+	err := store.EachIdentity(context.Background(), func(*ssp.SqrlIdentity) error { return sentinel })
+	if err != sentinel {
+		t.Errorf("callback error: got %v, want it unchanged", err)
+	}
+
+	if err := db.Migrator().DropTable("sqrl_identities"); err != nil {
+		t.Fatalf("drop table: %v", err)
+	}
+	if _, err := store.FindIdentity("cls-1"); !errors.Is(err, ErrStore) || IsRetryable(err) {
+		t.Errorf("missing table: expected ErrStore, got %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	sqlDB.Close()
+	if _, err := store.FindIdentity("cls-1"); !errors.Is(err, ErrTransient) || !IsRetryable(err) {
+		t.Errorf("closed pool: expected ErrTransient, got %v", err)
+	}
+}
@@ -1,14 +1,19 @@
 package gormauthstore
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Package-specific errors for validation and security operations.
 var (
 	// ErrEmptyIdentityKey is returned when an empty identity key is provided.
 	ErrEmptyIdentityKey = errors.New("identity key cannot be empty")
 
-	// ErrIdentityKeyTooLong is returned when the identity key exceeds the maximum length.
-	ErrIdentityKeyTooLong = errors.New("identity key exceeds maximum length of 256 characters")
+	// ErrIdentityKeyTooLong is returned when the identity key exceeds the
+	// maximum length: MaxIdkLength, or the WithMaxIdkLength limit, which the
+	// wrapping error then names.
+	ErrIdentityKeyTooLong = errors.New("identity key exceeds maximum length")
 
 	// ErrInvalidIdentityKeyFormat is returned when the identity key contains invalid characters.
 	ErrInvalidIdentityKeyFormat = errors.New("identity key contains invalid characters")
@@ -21,4 +26,153 @@ var (
 
 	// ErrWrappedIdentityDestroyed is returned when accessing a destroyed wrapper.
 	ErrWrappedIdentityDestroyed = errors.New("secure identity wrapper has been destroyed")
+
+	// ErrIdentityDisabled is returned when an identity exists but is disabled.
+	ErrIdentityDisabled = errors.New("identity is disabled")
+
+	// ErrDuplicateIdentity is returned when an identity key is already in use.
+	ErrDuplicateIdentity = errors.New("identity key already exists")
+
+	// ErrIdentityHardlocked is returned when a protected hardlocked identity
+	// would be deleted.
+	ErrIdentityHardlocked = errors.New("identity is hardlocked")
+
+	// ErrFieldTooLong is returned when Suk, Vuk, Pidk or Rekeyed exceeds the
+	// configured maximum length. The wrapping error names the field.
+	ErrFieldTooLong = errors.New("identity field exceeds maximum length")
+
+	// ErrUnsupportedDialect is returned by NewAuthStoreFromSQL for a dialect
+	// name that has not been registered with RegisterDialect.
+	ErrUnsupportedDialect = errors.New("unsupported database dialect")
+
+	// ErrEmptyFilter is returned when a bulk operation is given a filter that
+	// would match every identity.
+	ErrEmptyFilter = errors.New("filter must set at least one condition")
+
+	// ErrInvalidPagination is returned when a list offset is negative or its
+	// limit is not in 1..MaxListLimit.
+	ErrInvalidPagination = errors.New("invalid pagination: offset must be >= 0 and limit in 1..1000")
+
+	// ErrBatchTooLarge is returned by FindIdentities and DeleteIdentities
+	// when given more than MaxFindIdentities keys.
+	ErrBatchTooLarge = errors.New("too many identity keys in one batch")
+
+	// ErrTimestampsUnavailable is returned by ExpireDisabledIdentities when
+	// the identity table has no updated_at column, i.e. the schema predates
+	// migration v4.
+	ErrTimestampsUnavailable = errors.New("identity table has no updated_at column; run Migrate")
+
+	// ErrSchemaVersionMismatch is returned by VerifySchema when the database
+	// schema version differs from the one the store expects.
+	ErrSchemaVersionMismatch = errors.New("schema version mismatch")
+
+	// ErrAmbiguousPidk is returned by FindIdentityByPidk when more than one
+	// identity names the same previous identity key.
+	ErrAmbiguousPidk = errors.New("previous identity key matches more than one identity")
+
+	// ErrInvalidEncryptionKey is returned by every operation of a store
+	// configured with a WithEncryptionKey key of the wrong length.
+	ErrInvalidEncryptionKey = errors.New("invalid encryption key")
+
+	// ErrDecryptionFailed is returned when a sealed Suk, Vuk or Rekeyed
+	// cannot be opened: the key is wrong or missing, or the value was altered.
+	ErrDecryptionFailed = errors.New("failed to decrypt identity field")
+
+	// ErrInvalidIntegrityKey is returned by every operation of a store
+	// configured with a WithIntegrityKey key shorter than IntegrityKeyMinSize.
+	ErrInvalidIntegrityKey = errors.New("invalid integrity key")
+
+	// ErrIntegrityCheckFailed is returned when a stored row's integrity tag
+	// does not match its fields: the row was altered outside the store, or
+	// written without the WithIntegrityKey key.
+	ErrIntegrityCheckFailed = errors.New("identity integrity check failed")
+
+	// ErrIntegrityKeyRequired is returned by VerifyIntegrity on a store
+	// without WithIntegrityKey.
+	ErrIntegrityKeyRequired = errors.New("integrity key not configured")
+
+	// ErrInvalidIdkPepper is returned by every operation of a store
+	// configured with a WithIdkPepper pepper shorter than IdkPepperMinSize.
+	ErrInvalidIdkPepper = errors.New("invalid identity key pepper")
+
+	// ErrIdkPepperRequired is returned by HashIdentityKeys on a store
+	// without WithIdkPepper.
+	ErrIdkPepperRequired = errors.New("identity key pepper not configured")
+
+	// ErrNotInTransaction is returned by FindIdentityForUpdate on a store
+	// not bound to a transaction.
+	ErrNotInTransaction = errors.New("operation requires a transaction")
+
+	// ErrLockTimeout is returned by FindIdentityForUpdate under
+	// WithLockTimeout when another transaction held the row lock for
+	// longer than the timeout. It wraps the driver's error.
+	ErrLockTimeout = errors.New("lock wait timed out")
+
+	// ErrRekeyCycle is returned by Rekey when linking the new identity
+	// would make the rekey chain loop back on itself.
+	ErrRekeyCycle = errors.New("rekey would create a cycle")
+
+	// ErrStaleIdentity is returned by SaveIdentity under
+	// WithOptimisticLocking when the row changed, was created or was deleted
+	// since the identity was read. Re-read it and apply the change again.
+	ErrStaleIdentity = errors.New("identity was modified concurrently")
+
+	// ErrDatabaseUnavailable is returned by Ping when the database cannot be
+	// reached. It wraps the driver's error, or the context's if the ping was
+	// cancelled or timed out.
+	ErrDatabaseUnavailable = errors.New("database unavailable")
+
+	// ErrStoreClosed is returned by every operation of a store after Close.
+	ErrStoreClosed = errors.New("auth store is closed")
+
+	// ErrTransient marks a database failure that may succeed if retried: a
+	// dropped or refused connection, a closed pool, a deadline, a deadlock
+	// or a busy database. The error also matches IsRetryable, and
+	// errors.Unwrap returns the driver's error.
+	ErrTransient = errors.New("transient database error")
+
+	// ErrStore marks any other database failure of a store operation, one
+	// that retrying will not fix. errors.Unwrap returns the driver's error.
+	ErrStore = errors.New("database error")
 )
+
+// MigrationError reports a failed schema migration. Version is the migration
+// that failed, or 0 when the failure was in the migration bookkeeping itself
+// (creating or reading schema_migrations), shown as "auto". Match it with
+// errors.As; Unwrap exposes the underlying GORM or driver error.
+type MigrationError struct {
+	Version     int
+	Description string
+	Err         error
+}
+
+// Error formats the failure as "migration v3 (description) failed: cause".
+func (e MigrationError) Error() string {
+	if e.Version == 0 {
+		return fmt.Sprintf("migration auto failed: %v", e.Err)
+	}
+	return fmt.Sprintf("migration v%d (%s) failed: %v", e.Version, e.Description, e.Err)
+}
+
+// Unwrap returns the underlying cause.
+func (e MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError reports the invalid element of a batch operation's input. Index
+// is its position in the slice the caller passed. Match it with errors.As;
+// errors.Is sees through it to the validation sentinel.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+// Error formats the failure as "batch item 3: cause".
+func (e BatchError) Error() string {
+	return fmt.Sprintf("batch item %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying cause.
+func (e BatchError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,91 @@
+package gormauthstore
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// IdentityFilter selects identities for bulk operations. Each set field adds
+// a condition and all conditions must hold; nil pointers and empty strings
+// are ignored. Values are always bound as query parameters.
+type IdentityFilter struct {
+	// Disabled, Hardlock and SQRLOnly match the identity flag exactly.
+	Disabled *bool
+	Hardlock *bool
+	SQRLOnly *bool
+
+	// Rekeyed matches identities superseded by a rekey (true) or not (false).
+	Rekeyed *bool
+
+	// Pidk matches identities whose previous identity key equals Pidk.
+	Pidk string
+}
+
+// IsEmpty reports whether the filter sets no condition, i.e. matches every row.
+func (f IdentityFilter) IsEmpty() bool {
+	return f.Disabled == nil && f.Hardlock == nil && f.SQRLOnly == nil &&
+		f.Rekeyed == nil && f.Pidk == ""
+}
+
+// apply adds the filter's conditions to db.
+func (f IdentityFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.Disabled != nil {
+		db = db.Where("disabled = ?", *f.Disabled)
+	}
+	if f.Hardlock != nil {
+		db = db.Where("hardlock = ?", *f.Hardlock)
+	}
+	if f.SQRLOnly != nil {
+		db = db.Where("sqrl_only = ?", *f.SQRLOnly)
+	}
+	if f.Rekeyed != nil {
+		if *f.Rekeyed {
+			db = db.Where("rekeyed <> ''")
+		} else {
+			db = db.Where("rekeyed = ''")
+		}
+	}
+	if f.Pidk != "" {
+		db = db.Where("pidk = ?", f.Pidk)
+	}
+	return db
+}
+
+// DeleteWhere deletes every identity matching filter and returns how many
+// were removed. An empty filter is refused with ErrEmptyFilter so a bulk
+// cleanup can never silently empty the table. With WithProtectHardlocked,
+// hardlocked identities are never matched.
+func (as *AuthStore) DeleteWhere(ctx context.Context, filter IdentityFilter) (_ int64, err error) {
+	ctx, done := as.observe(ctx, "DeleteWhere", "", &err)
+	defer done()
+	return as.deleteWhere(ctx, filter, false)
+}
+
+// DeleteWhereDryRun returns how many identities DeleteWhere would remove
+// for filter, without modifying anything, so an operator can confirm the
+// impact first. It counts the same rows, under the read timeout.
+func (as *AuthStore) DeleteWhereDryRun(ctx context.Context, filter IdentityFilter) (_ int64, err error) {
+	ctx, done := as.observe(ctx, "DeleteWhereDryRun", "", &err)
+	defer done()
+	return as.deleteWhere(ctx, filter, true)
+}
+
+// deleteWhere implements DeleteWhere and, under dryRun, its dry run.
+func (as *AuthStore) deleteWhere(ctx context.Context, filter IdentityFilter, dryRun bool) (int64, error) {
+	if filter.IsEmpty() {
+		return 0, ErrEmptyFilter
+	}
+	if filter.Pidk != "" {
+		if err := as.validateIdk(filter.Pidk); err != nil {
+			return 0, err
+		}
+	}
+	return as.bulkDelete(ctx, dryRun, func(db *gorm.DB) (*gorm.DB, error) {
+		db = filter.apply(as.identities(db))
+		if as.cfg.protectHardlocked {
+			db = db.Where("hardlock = ?", false)
+		}
+		return db, nil
+	}, as.deleteRows)
+}
@@ -0,0 +1,113 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// seedFilterFixtures stores a small set of identities covering each flag.
+func seedFilterFixtures(t *testing.T, store *AuthStore) {
+	t.Helper()
+	seedIdentity(t, store, newTestIdentity().withIdk("f-plain").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("f-disabled").withDisabled().build())
+	seedIdentity(t, store, newTestIdentity().withIdk("f-disabled-locked").withDisabled().withHardlock().build())
+	seedIdentity(t, store, newTestIdentity().withIdk("f-rekeyed").withRekeyed("f-plain").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("f-child").withPidk("f-rekeyed").build())
+}
+
+// remainingIdks returns the keys still stored, in idk order.
+func remainingIdks(t *testing.T, store *AuthStore) []string {
+	t.Helper()
+	var keys []string
+	if err := store.db.Model(&identityRecord{}).Order("idk").Pluck("idk", &keys).Error; err != nil {
+		t.Fatalf("pluck: %v", err)
+	}
+	return keys
+}
+
+// TestDeleteWhere verifies each filter field selects the expected rows, and
+// that the dry run counts the same rows without removing them.
+func TestDeleteWhere(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name    string
+		filter  IdentityFilter
+		deleted int64
+		remain  string
+	}{
+		{"disabled", IdentityFilter{Disabled: &yes}, 2, "[f-child f-plain f-rekeyed]"},
+		{"disabled and unlocked", IdentityFilter{Disabled: &yes, Hardlock: &no}, 1, "[f-child f-disabled-locked f-plain f-rekeyed]"},
+		{"rekeyed", IdentityFilter{Rekeyed: &yes}, 1, "[f-child f-disabled f-disabled-locked f-plain]"},
+		{"pidk", IdentityFilter{Pidk: "f-rekeyed"}, 1, "[f-disabled f-disabled-locked f-plain f-rekeyed]"},
+		{"no match", IdentityFilter{SQRLOnly: &yes}, 0, "[f-child f-disabled f-disabled-locked f-plain f-rekeyed]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, store := newTestStoreWithOptions(t)
+			seedFilterFixtures(t, store)
+
+			wouldDelete, err := store.DeleteWhereDryRun(context.Background(), tt.filter)
+			if err != nil || wouldDelete != tt.deleted {
+				t.Errorf("DeleteWhereDryRun: got %d, %v, want %d", wouldDelete, err, tt.deleted)
+			}
+			if got := remainingIdks(t, store); len(got) != 5 {
+				t.Fatalf("dry run removed rows: %v", got)
+			}
+
+			deleted, err := store.DeleteWhere(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("DeleteWhere failed: %v", err)
+			}
+			if deleted != tt.deleted {
+				t.Errorf("deleted: got %d, want %d", deleted, tt.deleted)
+			}
+			if got := remainingIdks(t, store); fmtKeys(got) != tt.remain {
+				t.Errorf("remaining: got %v, want %s", got, tt.remain)
+			}
+		})
+	}
+}
+
+// TestDeleteWhere_EmptyFilterRefused verifies an empty filter deletes nothing.
+func TestDeleteWhere_EmptyFilterRefused(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedFilterFixtures(t, store)
+
+	deleted, err := store.DeleteWhere(context.Background(), IdentityFilter{})
+	if !errors.Is(err, ErrEmptyFilter) || deleted != 0 {
+		t.Fatalf("expected ErrEmptyFilter and 0 deleted, got %d, %v", deleted, err)
+	}
+	if _, err := store.DeleteWhereDryRun(context.Background(), IdentityFilter{}); !errors.Is(err, ErrEmptyFilter) {
+		t.Errorf("dry run: expected ErrEmptyFilter, got %v", err)
+	}
+	if got := remainingIdks(t, store); len(got) != 5 {
+		t.Errorf("rows deleted despite refusal: %v", got)
+	}
+}
+
+// TestDeleteWhere_InvalidPidk verifies the Pidk filter is validated like an idk.
+func TestDeleteWhere_InvalidPidk(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	if _, err := store.DeleteWhere(context.Background(), IdentityFilter{Pidk: "x' OR '1'='1"}); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+}
+
+// TestDeleteWhere_ProtectHardlocked verifies protected stores skip hardlocked rows.
+func TestDeleteWhere_ProtectHardlocked(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithProtectHardlocked())
+	seedFilterFixtures(t, store)
+
+	yes := true
+	if wouldDelete, err := store.DeleteWhereDryRun(context.Background(), IdentityFilter{Disabled: &yes}); err != nil || wouldDelete != 1 {
+		t.Errorf("DeleteWhereDryRun: got %d, %v, want 1", wouldDelete, err)
+	}
+	deleted, err := store.DeleteWhere(context.Background(), IdentityFilter{Disabled: &yes})
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected 1 deleted, got %d, %v", deleted, err)
+	}
+	if got := remainingIdks(t, store); fmtKeys(got) != "[f-child f-disabled-locked f-plain f-rekeyed]" {
+		t.Errorf("remaining: got %v", got)
+	}
+}
@@ -8,6 +8,7 @@ toolchain go1.25.7
 
 require (
 	github.com/dxcSithLord/server-go-ssp v0.0.0-20260202110616-66529f78b7f1
+	golang.org/x/text v0.33.0
 	gorm.io/driver/sqlite v1.6.0
 	gorm.io/gorm v1.31.1
 )
@@ -24,7 +25,6 @@ require (
 	github.com/yeqown/go-qrcode/writer/standard v1.3.0 // indirect
 	github.com/yeqown/reedsolomon v1.0.0 // indirect
 	golang.org/x/image v0.35.0 // indirect
-	golang.org/x/text v0.33.0 // indirect
 )
 
 // NOTE: Replace directives for local development.
@@ -0,0 +1,87 @@
+package gormauthstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"gorm.io/gorm"
+)
+
+// IdkPepperMinSize is the minimum length in bytes of a WithIdkPepper pepper.
+const IdkPepperMinSize = 32
+
+// hashedIdkPrefix marks an idk column value that is a peppered hash. ':' is
+// not a valid identity key character under the built-in rules, so no raw
+// key carries it unless a WithValidator admits one.
+const hashedIdkPrefix = "h:"
+
+// lookupKey returns the idk column value for the raw identity key idk: its
+// peppered hash under WithIdkPepper, idk itself otherwise. Every statement
+// that filters on or writes the idk column of a caller-supplied key goes
+// through here, after the raw key has been validated.
+func (as *AuthStore) lookupKey(idk string) string {
+	if as.cfg.idkPepper == nil {
+		return idk
+	}
+	mac := hmac.New(sha256.New, as.cfg.idkPepper)
+	mac.Write([]byte(idk))
+	return hashedIdkPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// HashIdentityKeys converts a table keyed by raw identity keys to peppered
+// hashes after WithIdkPepper is enabled on it: every row whose idk is not
+// yet hashed is rewritten with its hash, in transactions of
+// DefaultBatchSize rows. Rows already hashed are left alone, so an
+// interrupted run can simply be repeated. Until it completes, lookups miss
+// the unconverted rows. It returns the number of rows converted, and
+// ErrIdkPepperRequired on a store without a pepper.
+//
+// Pidk and Rekeyed are not identity lookups and keep their raw values.
+func (as *AuthStore) HashIdentityKeys(ctx context.Context) (converted int, err error) {
+	ctx, done := as.observe(ctx, "HashIdentityKeys", "", &err)
+	defer done()
+	if as.cfg.idkPepper == nil {
+		return 0, ErrIdkPepperRequired
+	}
+	columns := append([]string{"idk"}, identityColumns...)
+	err = as.run(ctx, opStream, func(db *gorm.DB) error {
+		for {
+			var records []identityRecord
+			err := db.Transaction(func(tx *gorm.DB) error {
+				err := as.allIdentities(tx).Where("idk NOT LIKE ?", hashedIdkPrefix+"%").
+					Order("idk").Limit(DefaultBatchSize).Find(&records).Error
+				if err != nil {
+					return err
+				}
+				for i := range records {
+					r := &records[i]
+					if err := as.verifyRecord(r); err != nil {
+						return err
+					}
+					raw := r.Idk
+					r.Idk = as.lookupKey(raw)
+					as.signRecord(r)
+					err := as.allIdentities(tx).Model(&identityRecord{}).Where("idk = ?", raw).
+						Select(columns).Updates(r).Error
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			for i := range records {
+				clearRecord(&records[i])
+			}
+			if err != nil {
+				return err
+			}
+			converted += len(records)
+			if len(records) < DefaultBatchSize {
+				return nil
+			}
+		}
+	})
+	return converted, err
+}
@@ -0,0 +1,165 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// TestWithIdkPepper_RoundTrip verifies the idk column holds the peppered
+// hash while lookups by key see the raw key.
+func TestWithIdkPepper_RoundTrip(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithIdkPepper(testKey(IdkPepperMinSize, 1)))
+	identity := newTestIdentity().withIdk("pep-1").withPidk("pep-prev").build()
+	seedIdentity(t, store, identity)
+
+	var stored []string
+	if err := db.Raw("SELECT idk FROM sqrl_identities").Scan(&stored).Error; err != nil {
+		t.Fatalf("raw select: %v", err)
+	}
+	if len(stored) != 1 || !strings.HasPrefix(stored[0], hashedIdkPrefix) || strings.Contains(stored[0], "pep-1") {
+		t.Fatalf("stored idk: got %v, want a peppered hash", stored)
+	}
+
+	found, err := store.FindIdentity("pep-1")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("FindIdentity: got %+v, want %+v", *found, *identity)
+	}
+	if exists, err := store.ExistsIdentity("pep-1"); err != nil || !exists {
+		t.Errorf("ExistsIdentity: got %v, %v", exists, err)
+	}
+	reloaded, err := store.SaveAndReload(context.Background(), identity)
+	if err != nil || reloaded.Idk != "pep-1" {
+		t.Errorf("SaveAndReload: got %+v, %v", reloaded, err)
+	}
+	claimed, err := store.ClaimAndDisable(context.Background(), "pep-1")
+	if err != nil || claimed.Idk != "pep-1" {
+		t.Errorf("ClaimAndDisable: got %+v, %v", claimed, err)
+	}
+
+	if _, err := NewAuthStore(db, WithIdkPepper(testKey(IdkPepperMinSize, 2))).FindIdentity("pep-1"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("other pepper: expected ssp.ErrNotFound, got %v", err)
+	}
+
+	if err := store.DeleteIdentity("pep-1"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("rows after delete: got %d, want 0", n)
+	}
+}
+
+// TestWithIdkPepper_ValidatesRawKey verifies validation runs on the key as
+// given, not on its hash.
+func TestWithIdkPepper_ValidatesRawKey(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithIdkPepper(testKey(IdkPepperMinSize, 1)))
+	if _, err := store.FindIdentity("bad key!"); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+}
+
+// TestWithIdkPepper_RenameIdentity verifies renaming rehashes the key and
+// rewrites raw Pidk references, with and without whole-row rewrites.
+func TestWithIdkPepper_RenameIdentity(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":     {WithIdkPepper(testKey(IdkPepperMinSize, 1))},
+		"integrity": {WithIdkPepper(testKey(IdkPepperMinSize, 1)), WithIntegrityKey(testKey(IntegrityKeyMinSize, 1))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, store := newTestStoreWithOptions(t, opts...)
+			seedIdentity(t, store, newTestIdentity().withIdk("pep-old").build())
+			seedIdentity(t, store, newTestIdentity().withIdk("pep-next").withPidk("pep-old").build())
+
+			if err := store.RenameIdentity(context.Background(), "pep-old", "pep-new"); err != nil {
+				t.Fatalf("RenameIdentity failed: %v", err)
+			}
+			if _, err := store.FindIdentity("pep-new"); err != nil {
+				t.Errorf("FindIdentity(new) failed: %v", err)
+			}
+			if _, err := store.FindIdentity("pep-old"); !errors.Is(err, ssp.ErrNotFound) {
+				t.Errorf("old key: expected ssp.ErrNotFound, got %v", err)
+			}
+			next, err := store.FindIdentity("pep-next")
+			if err != nil || next.Pidk != "pep-new" {
+				t.Errorf("successor: got %+v, %v", next, err)
+			}
+		})
+	}
+}
+
+// TestHashIdentityKeys verifies an existing plaintext-keyed table is
+// converted in batches and that repeating the conversion is a no-op.
+func TestHashIdentityKeys(t *testing.T) {
+	db, plain := newTestStoreWithOptions(t)
+	batch := batchOf("pep-conv", DefaultBatchSize+DefaultBatchSize/2)
+	if err := plain.SaveIdentities(batch); err != nil {
+		t.Fatalf("SaveIdentities failed: %v", err)
+	}
+
+	store := NewAuthStore(db, WithIdkPepper(testKey(IdkPepperMinSize, 1)))
+	if _, err := store.FindIdentity(batch[0].Idk); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("before conversion: expected ssp.ErrNotFound, got %v", err)
+	}
+	converted, err := store.HashIdentityKeys(context.Background())
+	if err != nil {
+		t.Fatalf("HashIdentityKeys failed: %v", err)
+	}
+	if converted != len(batch) {
+		t.Errorf("converted: got %d, want %d", converted, len(batch))
+	}
+	for _, identity := range batch {
+		found, err := store.FindIdentity(identity.Idk)
+		if err != nil {
+			t.Fatalf("FindIdentity(%s) failed: %v", identity.Idk, err)
+		}
+		if *found != *identity {
+			t.Fatalf("FindIdentity(%s): got %+v, want %+v", identity.Idk, *found, *identity)
+		}
+	}
+
+	if converted, err := store.HashIdentityKeys(context.Background()); err != nil || converted != 0 {
+		t.Errorf("repeated HashIdentityKeys: got %d, %v, want 0, nil", converted, err)
+	}
+	if n := countRows(t, db); n != int64(len(batch)) {
+		t.Errorf("rows: got %d, want %d", n, len(batch))
+	}
+}
+
+// TestHashIdentityKeys_Encrypted verifies converted rows are resealed for
+// their new key, as sealed values are bound to the row's stored idk.
+func TestHashIdentityKeys_Encrypted(t *testing.T) {
+	db, plain := newTestStoreWithOptions(t, WithEncryptionKey(testKey(EncryptionKeySize, 1)))
+	identity := newTestIdentity().withIdk("pep-sealed").withRekeyed("pep-next").build()
+	seedIdentity(t, plain, identity)
+
+	store := NewAuthStore(db, WithEncryptionKey(testKey(EncryptionKeySize, 1)), WithIdkPepper(testKey(IdkPepperMinSize, 1)))
+	if _, err := store.HashIdentityKeys(context.Background()); err != nil {
+		t.Fatalf("HashIdentityKeys failed: %v", err)
+	}
+	found, err := store.FindIdentity("pep-sealed")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("FindIdentity: got %+v, want %+v", *found, *identity)
+	}
+}
+
+// TestWithIdkPepper_Errors verifies a short pepper and converting without
+// one are rejected.
+func TestWithIdkPepper_Errors(t *testing.T) {
+	db, plain := newTestStoreWithOptions(t)
+	if _, err := plain.HashIdentityKeys(context.Background()); !errors.Is(err, ErrIdkPepperRequired) {
+		t.Errorf("HashIdentityKeys without pepper: expected ErrIdkPepperRequired, got %v", err)
+	}
+	short := NewAuthStore(db, WithIdkPepper([]byte("short")))
+	if _, err := short.FindIdentity("pep-short"); !errors.Is(err, ErrInvalidIdkPepper) {
+		t.Errorf("short pepper: expected ErrInvalidIdkPepper, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// TestWithIntegrityKey_RoundTrip verifies rows are tagged on write and
+// verify on every read path.
+func TestWithIntegrityKey_RoundTrip(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithIntegrityKey(testKey(IntegrityKeyMinSize, 1)))
+	identity := newTestIdentity().withIdk("mac-1").withPidk("mac-prev").withBtn(3).build()
+	seedIdentity(t, store, identity)
+
+	var mac string
+	if err := db.Raw("SELECT mac FROM sqrl_identities WHERE idk = ?", "mac-1").Scan(&mac).Error; err != nil {
+		t.Fatalf("raw select: %v", err)
+	}
+	if len(mac) != 64 {
+		t.Errorf("mac: got %q, want 64 hex characters", mac)
+	}
+
+	found, err := store.FindIdentity("mac-1")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("FindIdentity: got %+v, want %+v", *found, *identity)
+	}
+	if _, err := store.FindIdentityByPidk("mac-prev"); err != nil {
+		t.Errorf("FindIdentityByPidk failed: %v", err)
+	}
+	if _, err := store.ListIdentities(0, 10); err != nil {
+		t.Errorf("ListIdentities failed: %v", err)
+	}
+	if _, err := store.SaveAndReload(context.Background(), identity); err != nil {
+		t.Errorf("SaveAndReload failed: %v", err)
+	}
+}
+
+// TestWithIntegrityKey_DetectsTampering verifies a field changed directly
+// in the database fails verification on every read path.
+func TestWithIntegrityKey_DetectsTampering(t *testing.T) {
+	tampering := map[string]string{
+		"disabled": "UPDATE sqrl_identities SET disabled = true WHERE idk = ?",
+		"btn":      "UPDATE sqrl_identities SET btn = 9 WHERE idk = ?",
+		"suk":      "UPDATE sqrl_identities SET suk = 'forged' WHERE idk = ?",
+		"rekeyed":  "UPDATE sqrl_identities SET rekeyed = 'mac-elsewhere' WHERE idk = ?",
+		"mac":      "UPDATE sqrl_identities SET mac = '' WHERE idk = ?",
+	}
+	for name, stmt := range tampering {
+		t.Run(name, func(t *testing.T) {
+			db, store := newTestStoreWithOptions(t, WithIntegrityKey(testKey(IntegrityKeyMinSize, 1)))
+			seedIdentity(t, store, newTestIdentity().withIdk("mac-tamper").build())
+			if err := db.Exec(stmt, "mac-tamper").Error; err != nil {
+				t.Fatalf("tamper: %v", err)
+			}
+
+			if _, err := store.FindIdentity("mac-tamper"); !errors.Is(err, ErrIntegrityCheckFailed) {
+				t.Errorf("FindIdentity: expected ErrIntegrityCheckFailed, got %v", err)
+			}
+			if _, err := store.ListIdentities(0, 10); !errors.Is(err, ErrIntegrityCheckFailed) {
+				t.Errorf("ListIdentities: expected ErrIntegrityCheckFailed, got %v", err)
+			}
+			err := store.EachIdentity(context.Background(), func(*ssp.SqrlIdentity) error { return nil })
+			if !errors.Is(err, ErrIntegrityCheckFailed) {
+				t.Errorf("EachIdentity: expected ErrIntegrityCheckFailed, got %v", err)
+			}
+			if err := store.VerifyIntegrity(context.Background(), "mac-tamper"); !errors.Is(err, ErrIntegrityCheckFailed) {
+				t.Errorf("VerifyIntegrity: expected ErrIntegrityCheckFailed, got %v", err)
+			}
+			if _, err := store.ClaimAndDisable(context.Background(), "mac-tamper"); !errors.Is(err, ErrIntegrityCheckFailed) {
+				t.Errorf("ClaimAndDisable: expected ErrIntegrityCheckFailed, got %v", err)
+			}
+		})
+	}
+}
+
+// TestWithIntegrityKey_UntaggedAndWrongKey verifies rows written without
+// the key, or under another key, fail verification.
+func TestWithIntegrityKey_UntaggedAndWrongKey(t *testing.T) {
+	db, plain := newTestStoreWithOptions(t)
+	seedIdentity(t, plain, newTestIdentity().withIdk("mac-untagged").build())
+	seedIdentity(t, NewAuthStore(db, WithIntegrityKey(testKey(IntegrityKeyMinSize, 2))), newTestIdentity().withIdk("mac-other").build())
+
+	store := NewAuthStore(db, WithIntegrityKey(testKey(IntegrityKeyMinSize, 1)))
+	for _, idk := range []string{"mac-untagged", "mac-other"} {
+		if _, err := store.FindIdentity(idk); !errors.Is(err, ErrIntegrityCheckFailed) {
+			t.Errorf("%s: expected ErrIntegrityCheckFailed, got %v", idk, err)
+		}
+	}
+}
+
+// TestWithIntegrityKey_StoreWritesKeepTagsValid verifies the store's own
+// partial updates, ClaimAndDisable and RenameIdentity, re-tag the rows
+// they change.
+func TestWithIntegrityKey_StoreWritesKeepTagsValid(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithIntegrityKey(testKey(IntegrityKeyMinSize, 1)), WithEncryptionKey(testKey(EncryptionKeySize, 1)))
+	seedIdentity(t, store, newTestIdentity().withIdk("mac-claim").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("mac-old").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("mac-next").withPidk("mac-old").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("mac-prior").withRekeyed("mac-old").build())
+
+	if _, err := store.ClaimAndDisable(context.Background(), "mac-claim"); err != nil {
+		t.Fatalf("ClaimAndDisable failed: %v", err)
+	}
+	claimed, err := store.FindIdentity("mac-claim")
+	if err != nil || !claimed.Disabled {
+		t.Errorf("after claim: got %+v, %v", claimed, err)
+	}
+
+	if err := store.RenameIdentity(context.Background(), "mac-old", "mac-new"); err != nil {
+		t.Fatalf("RenameIdentity failed: %v", err)
+	}
+	checks := map[string]func(*ssp.SqrlIdentity) bool{
+		"mac-new":   func(id *ssp.SqrlIdentity) bool { return id.Suk == "default-test-suk" },
+		"mac-next":  func(id *ssp.SqrlIdentity) bool { return id.Pidk == "mac-new" },
+		"mac-prior": func(id *ssp.SqrlIdentity) bool { return id.Rekeyed == "mac-new" },
+	}
+	for idk, ok := range checks {
+		found, err := store.FindIdentity(idk)
+		if err != nil {
+			t.Errorf("FindIdentity(%s) after rename failed: %v", idk, err)
+			continue
+		}
+		if !ok(found) {
+			t.Errorf("%s after rename: got %+v", idk, *found)
+		}
+	}
+	if _, err := store.FindIdentity("mac-old"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("old key: expected ssp.ErrNotFound, got %v", err)
+	}
+}
+
+// TestVerifyIntegrity verifies an intact row passes, a missing one is
+// reported as not found, and a store without the key refuses to check.
+func TestVerifyIntegrity(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithIntegrityKey(testKey(IntegrityKeyMinSize, 1)))
+	seedIdentity(t, store, newTestIdentity().withIdk("mac-intact").build())
+	ctx := context.Background()
+
+	if err := store.VerifyIntegrity(ctx, "mac-intact"); err != nil {
+		t.Errorf("intact row: expected nil, got %v", err)
+	}
+	if err := store.VerifyIntegrity(ctx, "mac-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("missing row: expected ssp.ErrNotFound, got %v", err)
+	}
+	if err := store.VerifyIntegrity(ctx, ""); !errors.Is(err, ErrEmptyIdentityKey) {
+		t.Errorf("empty idk: expected ErrEmptyIdentityKey, got %v", err)
+	}
+	if err := NewAuthStore(db).VerifyIntegrity(ctx, "mac-intact"); !errors.Is(err, ErrIntegrityKeyRequired) {
+		t.Errorf("no key: expected ErrIntegrityKeyRequired, got %v", err)
+	}
+}
+
+// TestWithIntegrityKey_InvalidKey verifies a short key makes every
+// operation fail.
+func TestWithIntegrityKey_InvalidKey(t *testing.T) {
+	db, _ := newTestStoreWithOptions(t)
+	store := NewAuthStore(db, WithIntegrityKey([]byte("short")))
+	if err := store.SaveIdentity(newTestIdentity().withIdk("mac-bad-key").build()); !errors.Is(err, ErrInvalidIntegrityKey) {
+		t.Errorf("SaveIdentity: expected ErrInvalidIntegrityKey, got %v", err)
+	}
+}
+
+// TestRecordMAC_Canonical verifies the tag separates field boundaries and
+// covers every field.
+func TestRecordMAC_Canonical(t *testing.T) {
+	key := testKey(IntegrityKeyMinSize, 1)
+	base := identityRecord{Idk: "ab", Suk: "c", Vuk: "v", Pidk: "p", Rekeyed: "r", Btn: 1}
+	shifted := base
+	shifted.Idk, shifted.Suk = "a", "bc"
+	if recordMAC(key, &base) == recordMAC(key, &shifted) {
+		t.Error("moving bytes between fields does not change the tag")
+	}
+
+	mutations := map[string]func(*identityRecord){
+		"Idk":      func(r *identityRecord) { r.Idk = "x" },
+		"Suk":      func(r *identityRecord) { r.Suk = "x" },
+		"Vuk":      func(r *identityRecord) { r.Vuk = "x" },
+		"Pidk":     func(r *identityRecord) { r.Pidk = "x" },
+		"SQRLOnly": func(r *identityRecord) { r.SQRLOnly = true },
+		"Hardlock": func(r *identityRecord) { r.Hardlock = true },
+		"Disabled": func(r *identityRecord) { r.Disabled = true },
+		"Rekeyed":  func(r *identityRecord) { r.Rekeyed = "x" },
+		"Btn":      func(r *identityRecord) { r.Btn = 2 },
+	}
+	for field, mutate := range mutations {
+		changed := base
+		mutate(&changed)
+		if recordMAC(key, &base) == recordMAC(key, &changed) {
+			t.Errorf("tag does not cover %s", field)
+		}
+	}
+}
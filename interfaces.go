@@ -0,0 +1,50 @@
+package gormauthstore
+
+import (
+	"context"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// ReadStore is the read-only view of an identity store. Hand it to layers
+// that only look identities up so they cannot modify or delete them.
+// Every identity a read returns is a fresh copy owned by the caller:
+// modifying or clearing it never affects the store or another result.
+type ReadStore interface {
+	FindIdentity(idk string) (*ssp.SqrlIdentity, error)
+	FindIdentityWithContext(ctx context.Context, idk string) (*ssp.SqrlIdentity, error)
+	FindIdentitySecure(idk string) (*SecureIdentityWrapper, error)
+	FindIdentitySecureWithContext(ctx context.Context, idk string) (*SecureIdentityWrapper, error)
+	FindActiveIdentity(ctx context.Context, idk string) (*ssp.SqrlIdentity, error)
+	ListRekeyedAway(ctx context.Context, offset, limit int) ([]*ssp.SqrlIdentity, error)
+	EachIdentity(ctx context.Context, fn func(*ssp.SqrlIdentity) error) error
+}
+
+// WriteStore is the mutating view of an identity store: save, delete, rekey
+// and claim.
+type WriteStore interface {
+	SaveIdentity(identity *ssp.SqrlIdentity) error
+	SaveIdentityWithContext(ctx context.Context, identity *ssp.SqrlIdentity) error
+	SaveAndReload(ctx context.Context, identity *ssp.SqrlIdentity) (*ssp.SqrlIdentity, error)
+	SaveIdentityInsertOnly(ctx context.Context, identity *ssp.SqrlIdentity) error
+	DeleteIdentity(idk string) error
+	DeleteIdentityWithContext(ctx context.Context, idk string) error
+	ForceDeleteIdentity(idk string) error
+	ForceDeleteIdentityWithContext(ctx context.Context, idk string) error
+	RenameIdentity(ctx context.Context, oldIdk, newIdk string) error
+	ClaimAndDisable(ctx context.Context, idk string) (*ssp.SqrlIdentity, error)
+}
+
+// Store is the full identity store. It is a superset of ssp.AuthStore.
+type Store interface {
+	ReadStore
+	WriteStore
+}
+
+// Compile-time checks that AuthStore satisfies every store interface.
+var (
+	_ ReadStore     = (*AuthStore)(nil)
+	_ WriteStore    = (*AuthStore)(nil)
+	_ Store         = (*AuthStore)(nil)
+	_ ssp.AuthStore = Store(nil)
+)
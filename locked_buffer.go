@@ -0,0 +1,103 @@
+package gormauthstore
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// LockedSecureBuffer holds a copy of secret bytes, such as a Suk or Vuk, in
+// memory that is locked against being paged to swap where the platform
+// supports it (mlock on Linux and macOS). Locking is best effort:
+// when it fails, typically because RLIMIT_MEMLOCK is too low, the failure is
+// logged through slog and the buffer still works, unlocked. Locked reports
+// which case applies.
+//
+// The secret occupies whole pages of its own, so unlocking one buffer never
+// unlocks another's memory. Destroy wipes and unlocks it; all methods are
+// safe for concurrent use. Strings cannot be locked, so keep the secret in
+// the buffer and avoid converting it back to a string.
+type LockedSecureBuffer struct {
+	mu     sync.Mutex
+	region []byte // page-aligned, whole pages; what is locked
+	data   []byte // the secret, a prefix of region
+	locked bool
+}
+
+// NewLockedSecureBuffer copies secret into a new locked buffer. The caller
+// should wipe its own copy afterwards.
+func NewLockedSecureBuffer(secret []byte) *LockedSecureBuffer {
+	region := pageAlignedRegion(len(secret))
+	b := &LockedSecureBuffer{
+		region: region,
+		data:   region[:len(secret):len(secret)],
+	}
+	copy(b.data, secret)
+	if len(region) > 0 {
+		if err := mlock(region); err != nil {
+			slog.Warn("gormauthstore: memory lock unavailable; secret buffer may be swapped", "error", err)
+		} else {
+			b.locked = true
+		}
+	}
+	return b
+}
+
+// pageAlignedRegion returns a zeroed slice of whole pages, starting on a page
+// boundary, large enough for n bytes. The Go heap does not move objects, so
+// the alignment holds for the slice's lifetime.
+func pageAlignedRegion(n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	page := os.Getpagesize()
+	size := (n + page - 1) / page * page
+	raw := make([]byte, size+page)
+	offset := 0
+	if rem := int(addressOf(raw) % uintptr(page)); rem != 0 {
+		offset = page - rem
+	}
+	return raw[offset : offset+size : offset+size]
+}
+
+// Bytes returns the secret, or nil once the buffer is destroyed. The slice
+// aliases the locked memory: do not retain it past Destroy.
+func (b *LockedSecureBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.data
+}
+
+// Locked reports whether the buffer's memory is currently locked.
+func (b *LockedSecureBuffer) Locked() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.locked
+}
+
+// Destroy wipes the secret and unlocks the memory. It is idempotent.
+func (b *LockedSecureBuffer) Destroy() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.region == nil {
+		return
+	}
+	WipeBytes(b.region)
+	if b.locked {
+		if err := munlock(b.region); err != nil {
+			slog.Warn("gormauthstore: memory unlock failed", "error", err)
+		}
+		b.locked = false
+	}
+	b.region = nil
+	b.data = nil
+}
@@ -0,0 +1,82 @@
+package gormauthstore
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+)
+
+// TestLockedSecureBuffer verifies the buffer holds a private copy of the
+// secret on its own pages and that Destroy wipes and releases it.
+func TestLockedSecureBuffer(t *testing.T) {
+	secret := []byte("locked-suk-material")
+	buf := NewLockedSecureBuffer(secret)
+	t.Logf("memory locked: %v", buf.Locked())
+
+	if !bytes.Equal(buf.Bytes(), secret) {
+		t.Fatalf("Bytes() = %q, want %q", buf.Bytes(), secret)
+	}
+	secret[0] = 'X'
+	if buf.Bytes()[0] != 'l' {
+		t.Error("buffer aliases the caller's slice")
+	}
+	if cap(buf.Bytes()) != len(secret) {
+		t.Errorf("cap(Bytes()) = %d, want %d so appends cannot reach the padding", cap(buf.Bytes()), len(secret))
+	}
+
+	page := uintptr(os.Getpagesize())
+	if addr := addressOf(buf.region); addr%page != 0 || uintptr(len(buf.region))%page != 0 {
+		t.Errorf("region not whole pages: addr %#x len %d", addr, len(buf.region))
+	}
+
+	region := buf.region
+	buf.Destroy()
+	if buf.Bytes() != nil || buf.Locked() {
+		t.Error("buffer still usable after Destroy")
+	}
+	for i, c := range region {
+		if c != 0 {
+			t.Fatalf("byte %d not wiped: %#x", i, c)
+		}
+	}
+	buf.Destroy()
+}
+
+// TestLockedSecureBuffer_EmptyAndNil verifies the degenerate cases.
+func TestLockedSecureBuffer_EmptyAndNil(t *testing.T) {
+	empty := NewLockedSecureBuffer(nil)
+	if len(empty.Bytes()) != 0 || empty.Locked() {
+		t.Error("empty buffer should hold nothing and lock nothing")
+	}
+	empty.Destroy()
+
+	var none *LockedSecureBuffer
+	if none.Bytes() != nil || none.Locked() {
+		t.Error("nil buffer should be empty")
+	}
+	none.Destroy()
+}
+
+// TestLockedSecureBuffer_ConcurrentDestroy races Destroy against readers;
+// run under -race.
+func TestLockedSecureBuffer_ConcurrentDestroy(t *testing.T) {
+	buf := NewLockedSecureBuffer([]byte("concurrent-vuk"))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			if g%2 == 0 {
+				buf.Destroy()
+				return
+			}
+			_ = buf.Locked()
+			_ = buf.Bytes()
+		}(g)
+	}
+	wg.Wait()
+	if buf.Bytes() != nil {
+		t.Error("buffer not destroyed")
+	}
+}
@@ -0,0 +1,232 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	gormauthstore "github.com/dxcSithLord/server-go-ssp-gormauthstore"
+)
+
+var dbSeq atomic.Int64
+
+// implementations lists the factories the contract runs against. Each call
+// returns an empty, isolated store.
+var implementations = []struct {
+	name      string
+	testStore func(t *testing.T) gormauthstore.Store
+}{
+	{"gorm", func(t *testing.T) gormauthstore.Store {
+		t.Helper()
+		dsn := fmt.Sprintf("file:contract-%d?mode=memory&cache=shared", dbSeq.Add(1))
+		db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+		if err != nil {
+			t.Fatalf("open database: %v", err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatalf("get sql.DB: %v", err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+		t.Cleanup(func() { _ = sqlDB.Close() })
+		store := gormauthstore.NewAuthStore(db)
+		if err := store.AutoMigrate(); err != nil {
+			t.Fatalf("AutoMigrate: %v", err)
+		}
+		return store
+	}},
+	{"memory", func(*testing.T) gormauthstore.Store { return New() }},
+}
+
+// forEachImplementation runs fn as a subtest against every implementation.
+func forEachImplementation(t *testing.T, fn func(t *testing.T, store gormauthstore.Store)) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			fn(t, impl.testStore(t))
+		})
+	}
+}
+
+func identity(idk string) *ssp.SqrlIdentity {
+	return &ssp.SqrlIdentity{Idk: idk, Suk: "suk-" + idk, Vuk: "vuk-" + idk}
+}
+
+// TestContract_ValidationErrors verifies every entry point rejects bad input
+// with the same error.
+func TestContract_ValidationErrors(t *testing.T) {
+	keys := []struct {
+		name string
+		idk  string
+		want error
+	}{
+		{"empty", "", gormauthstore.ErrEmptyIdentityKey},
+		{"too long", strings.Repeat("a", gormauthstore.MaxIdkLength+1), gormauthstore.ErrIdentityKeyTooLong},
+		{"invalid format", "bad key", gormauthstore.ErrInvalidIdentityKeyFormat},
+	}
+	forEachImplementation(t, func(t *testing.T, store gormauthstore.Store) {
+		ctx := context.Background()
+		for _, tt := range keys {
+			calls := map[string]error{
+				"FindIdentity":    second(store.FindIdentity(tt.idk)),
+				"FindActive":      second(store.FindActiveIdentity(ctx, tt.idk)),
+				"FindSecure":      second(store.FindIdentitySecure(tt.idk)),
+				"SaveIdentity":    store.SaveIdentity(identity(tt.idk)),
+				"SaveAndReload":   second(store.SaveAndReload(ctx, identity(tt.idk))),
+				"InsertOnly":      store.SaveIdentityInsertOnly(ctx, identity(tt.idk)),
+				"DeleteIdentity":  store.DeleteIdentity(tt.idk),
+				"ForceDelete":     store.ForceDeleteIdentity(tt.idk),
+				"RenameFrom":      store.RenameIdentity(ctx, tt.idk, "valid"),
+				"RenameTo":        store.RenameIdentity(ctx, "valid", tt.idk),
+				"ClaimAndDisable": second(store.ClaimAndDisable(ctx, tt.idk)),
+			}
+			for call, err := range calls {
+				if !errors.Is(err, tt.want) {
+					t.Errorf("%s(%s): expected %v, got %v", call, tt.name, tt.want, err)
+				}
+			}
+		}
+		if err := store.SaveIdentity(nil); !errors.Is(err, gormauthstore.ErrNilIdentity) {
+			t.Errorf("SaveIdentity(nil): expected ErrNilIdentity, got %v", err)
+		}
+		long := identity("long-suk")
+		long.Suk = strings.Repeat("s", gormauthstore.MaxFieldLength+1)
+		if err := store.SaveIdentity(long); !errors.Is(err, gormauthstore.ErrFieldTooLong) {
+			t.Errorf("oversized Suk: expected ErrFieldTooLong, got %v", err)
+		}
+		if _, err := store.ListRekeyedAway(ctx, 0, 0); !errors.Is(err, gormauthstore.ErrInvalidPagination) {
+			t.Errorf("ListRekeyedAway(0, 0): expected ErrInvalidPagination, got %v", err)
+		}
+	})
+}
+
+// TestContract_NotFound verifies missing keys report ssp.ErrNotFound where
+// the gorm store does, and deletes stay idempotent.
+func TestContract_NotFound(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, store gormauthstore.Store) {
+		ctx := context.Background()
+		for call, err := range map[string]error{
+			"FindIdentity":    second(store.FindIdentity("missing")),
+			"FindActive":      second(store.FindActiveIdentity(ctx, "missing")),
+			"FindSecure":      second(store.FindIdentitySecure("missing")),
+			"RenameIdentity":  store.RenameIdentity(ctx, "missing", "other"),
+			"ClaimAndDisable": second(store.ClaimAndDisable(ctx, "missing")),
+		} {
+			if !errors.Is(err, ssp.ErrNotFound) {
+				t.Errorf("%s: expected ssp.ErrNotFound, got %v", call, err)
+			}
+		}
+		if err := store.DeleteIdentity("missing"); err != nil {
+			t.Errorf("DeleteIdentity(missing): expected nil, got %v", err)
+		}
+	})
+}
+
+// TestContract_UpsertAndDelete verifies saves replace the whole identity and
+// deletes are idempotent.
+func TestContract_UpsertAndDelete(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, store gormauthstore.Store) {
+		first := identity("upsert")
+		first.Pidk = "prev"
+		first.Btn = 2
+		if err := store.SaveIdentity(first); err != nil {
+			t.Fatalf("SaveIdentity: %v", err)
+		}
+		second := identity("upsert")
+		second.Hardlock = true
+		if err := store.SaveIdentity(second); err != nil {
+			t.Fatalf("SaveIdentity (update): %v", err)
+		}
+		found, err := store.FindIdentity("upsert")
+		if err != nil {
+			t.Fatalf("FindIdentity: %v", err)
+		}
+		if *found != *second {
+			t.Errorf("after upsert: got %+v, want %+v", *found, *second)
+		}
+
+		if err := store.SaveIdentityInsertOnly(context.Background(), first); !errors.Is(err, gormauthstore.ErrDuplicateIdentity) {
+			t.Errorf("insert-only over existing: expected ErrDuplicateIdentity, got %v", err)
+		}
+
+		found.Btn = 7
+		again, _ := store.FindIdentity("upsert")
+		if again.Btn != 0 {
+			t.Error("mutating a returned identity changed the store")
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := store.DeleteIdentity("upsert"); err != nil {
+				t.Fatalf("DeleteIdentity #%d: %v", i+1, err)
+			}
+		}
+		if _, err := store.FindIdentity("upsert"); !errors.Is(err, ssp.ErrNotFound) {
+			t.Errorf("after delete: expected ssp.ErrNotFound, got %v", err)
+		}
+	})
+}
+
+// TestContract_StateTransitions verifies disabled, claim, rename and list
+// behaviour match.
+func TestContract_StateTransitions(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, store gormauthstore.Store) {
+		ctx := context.Background()
+		for _, id := range []*ssp.SqrlIdentity{identity("a-old"), identity("b-new"), identity("c-child")} {
+			if err := store.SaveIdentity(id); err != nil {
+				t.Fatalf("SaveIdentity: %v", err)
+			}
+		}
+		child := identity("c-child")
+		child.Pidk = "a-old"
+		child.Rekeyed = "b-new"
+		if err := store.SaveIdentity(child); err != nil {
+			t.Fatalf("SaveIdentity: %v", err)
+		}
+
+		if err := store.RenameIdentity(ctx, "a-old", "b-new"); !errors.Is(err, gormauthstore.ErrDuplicateIdentity) {
+			t.Errorf("rename onto existing: expected ErrDuplicateIdentity, got %v", err)
+		}
+		if err := store.RenameIdentity(ctx, "a-old", "a-renamed"); err != nil {
+			t.Fatalf("RenameIdentity: %v", err)
+		}
+		if got, _ := store.FindIdentity("c-child"); got == nil || got.Pidk != "a-renamed" {
+			t.Errorf("Pidk reference not rewritten: %+v", got)
+		}
+
+		listed, err := store.ListRekeyedAway(ctx, 0, 10)
+		if err != nil || len(listed) != 1 || listed[0].Idk != "c-child" {
+			t.Errorf("ListRekeyedAway: got %v, %v", listed, err)
+		}
+
+		claimed, err := store.ClaimAndDisable(ctx, "b-new")
+		if err != nil || !claimed.Disabled {
+			t.Fatalf("ClaimAndDisable: got %+v, %v", claimed, err)
+		}
+		if _, err := store.ClaimAndDisable(ctx, "b-new"); !errors.Is(err, gormauthstore.ErrIdentityDisabled) {
+			t.Errorf("second claim: expected ErrIdentityDisabled, got %v", err)
+		}
+		if _, err := store.FindActiveIdentity(ctx, "b-new"); !errors.Is(err, gormauthstore.ErrIdentityDisabled) {
+			t.Errorf("FindActiveIdentity: expected ErrIdentityDisabled, got %v", err)
+		}
+
+		var seen []string
+		err = store.EachIdentity(ctx, func(id *ssp.SqrlIdentity) error {
+			seen = append(seen, id.Idk)
+			return nil
+		})
+		if err != nil || fmt.Sprint(seen) != "[a-renamed b-new c-child]" {
+			t.Errorf("EachIdentity: got %v, %v", seen, err)
+		}
+	})
+}
+
+// second returns the error from a (value, error) pair.
+func second[T any](_ T, err error) error {
+	return err
+}
@@ -0,0 +1,271 @@
+// Package memstore provides an in-memory implementation of the
+// gormauthstore.Store interface for tests.
+//
+// It enforces the same validation and returns the same errors as
+// gormauthstore.AuthStore with default options: ErrEmptyIdentityKey,
+// ErrIdentityKeyTooLong, ErrInvalidIdentityKeyFormat, ErrNilIdentity,
+// ErrFieldTooLong, ssp.ErrNotFound and so on, with upsert saves and
+// idempotent deletes. A shared contract test runs against both
+// implementations so they cannot diverge.
+package memstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+
+	gormauthstore "github.com/dxcSithLord/server-go-ssp-gormauthstore"
+)
+
+// Store is an in-memory identity store, safe for concurrent use.
+type Store struct {
+	mu         sync.RWMutex
+	identities map[string]ssp.SqrlIdentity
+}
+
+var _ gormauthstore.Store = (*Store)(nil)
+
+// New returns an empty Store.
+func New() *Store {
+	return &Store{identities: make(map[string]ssp.SqrlIdentity)}
+}
+
+// FindIdentity implements gormauthstore.ReadStore.
+func (s *Store) FindIdentity(idk string) (*ssp.SqrlIdentity, error) {
+	return s.FindIdentityWithContext(context.Background(), idk)
+}
+
+// FindIdentityWithContext implements gormauthstore.ReadStore.
+func (s *Store) FindIdentityWithContext(ctx context.Context, idk string) (*ssp.SqrlIdentity, error) {
+	if err := gormauthstore.ValidateIdk(idk); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	identity, ok := s.identities[idk]
+	if !ok {
+		return nil, ssp.ErrNotFound
+	}
+	return &identity, nil
+}
+
+// FindIdentitySecure implements gormauthstore.ReadStore.
+func (s *Store) FindIdentitySecure(idk string) (*gormauthstore.SecureIdentityWrapper, error) {
+	return s.FindIdentitySecureWithContext(context.Background(), idk)
+}
+
+// FindIdentitySecureWithContext implements gormauthstore.ReadStore.
+func (s *Store) FindIdentitySecureWithContext(ctx context.Context, idk string) (*gormauthstore.SecureIdentityWrapper, error) {
+	identity, err := s.FindIdentityWithContext(ctx, idk)
+	if err != nil {
+		return nil, err
+	}
+	return gormauthstore.NewSecureIdentityWrapper(identity), nil
+}
+
+// FindActiveIdentity implements gormauthstore.ReadStore.
+func (s *Store) FindActiveIdentity(ctx context.Context, idk string) (*ssp.SqrlIdentity, error) {
+	identity, err := s.FindIdentityWithContext(ctx, idk)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Disabled {
+		gormauthstore.ClearIdentity(identity)
+		return nil, gormauthstore.ErrIdentityDisabled
+	}
+	return identity, nil
+}
+
+// ListRekeyedAway implements gormauthstore.ReadStore.
+func (s *Store) ListRekeyedAway(ctx context.Context, offset, limit int) ([]*ssp.SqrlIdentity, error) {
+	if offset < 0 || limit < 1 || limit > gormauthstore.MaxListLimit {
+		return nil, gormauthstore.ErrInvalidPagination
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var page []*ssp.SqrlIdentity
+	for _, identity := range s.sorted() {
+		if identity.Rekeyed != "" {
+			page = append(page, identity)
+		}
+	}
+	if offset >= len(page) {
+		return []*ssp.SqrlIdentity{}, nil
+	}
+	page = page[offset:]
+	if len(page) > limit {
+		page = page[:limit]
+	}
+	return page, nil
+}
+
+// EachIdentity implements gormauthstore.ReadStore. It iterates over a
+// snapshot, so fn may call back into the store.
+func (s *Store) EachIdentity(ctx context.Context, fn func(*ssp.SqrlIdentity) error) error {
+	for _, identity := range s.sorted() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn(identity)
+		gormauthstore.ClearIdentity(identity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveIdentity implements gormauthstore.WriteStore.
+func (s *Store) SaveIdentity(identity *ssp.SqrlIdentity) error {
+	return s.SaveIdentityWithContext(context.Background(), identity)
+}
+
+// SaveIdentityWithContext implements gormauthstore.WriteStore.
+func (s *Store) SaveIdentityWithContext(ctx context.Context, identity *ssp.SqrlIdentity) error {
+	if err := gormauthstore.ValidateIdentity(identity); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identities[identity.Idk] = *identity
+	return nil
+}
+
+// SaveIdentityInsertOnly implements gormauthstore.WriteStore.
+func (s *Store) SaveIdentityInsertOnly(ctx context.Context, identity *ssp.SqrlIdentity) error {
+	if err := gormauthstore.ValidateIdentity(identity); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, taken := s.identities[identity.Idk]; taken {
+		return gormauthstore.ErrDuplicateIdentity
+	}
+	s.identities[identity.Idk] = *identity
+	return nil
+}
+
+// SaveAndReload implements gormauthstore.WriteStore.
+func (s *Store) SaveAndReload(ctx context.Context, identity *ssp.SqrlIdentity) (*ssp.SqrlIdentity, error) {
+	if err := s.SaveIdentityWithContext(ctx, identity); err != nil {
+		return nil, err
+	}
+	stored := *identity
+	return &stored, nil
+}
+
+// DeleteIdentity implements gormauthstore.WriteStore.
+func (s *Store) DeleteIdentity(idk string) error {
+	return s.DeleteIdentityWithContext(context.Background(), idk)
+}
+
+// DeleteIdentityWithContext implements gormauthstore.WriteStore. Deleting a
+// missing key is not an error.
+func (s *Store) DeleteIdentityWithContext(ctx context.Context, idk string) error {
+	if err := gormauthstore.ValidateIdk(idk); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.identities, idk)
+	return nil
+}
+
+// ForceDeleteIdentity implements gormauthstore.WriteStore. The in-memory
+// store never protects hardlocked identities, so it equals DeleteIdentity.
+func (s *Store) ForceDeleteIdentity(idk string) error {
+	return s.DeleteIdentity(idk)
+}
+
+// ForceDeleteIdentityWithContext implements gormauthstore.WriteStore.
+func (s *Store) ForceDeleteIdentityWithContext(ctx context.Context, idk string) error {
+	return s.DeleteIdentityWithContext(ctx, idk)
+}
+
+// RenameIdentity implements gormauthstore.WriteStore.
+func (s *Store) RenameIdentity(ctx context.Context, oldIdk, newIdk string) error {
+	if err := gormauthstore.ValidateIdk(oldIdk); err != nil {
+		return err
+	}
+	if err := gormauthstore.ValidateIdk(newIdk); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	identity, ok := s.identities[oldIdk]
+	if !ok {
+		return ssp.ErrNotFound
+	}
+	if oldIdk == newIdk {
+		return nil
+	}
+	if _, taken := s.identities[newIdk]; taken {
+		return gormauthstore.ErrDuplicateIdentity
+	}
+	delete(s.identities, oldIdk)
+	identity.Idk = newIdk
+	s.identities[newIdk] = identity
+	for idk, other := range s.identities {
+		if other.Pidk == oldIdk {
+			other.Pidk = newIdk
+		}
+		if other.Rekeyed == oldIdk {
+			other.Rekeyed = newIdk
+		}
+		s.identities[idk] = other
+	}
+	return nil
+}
+
+// ClaimAndDisable implements gormauthstore.WriteStore.
+func (s *Store) ClaimAndDisable(ctx context.Context, idk string) (*ssp.SqrlIdentity, error) {
+	if err := gormauthstore.ValidateIdk(idk); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	identity, ok := s.identities[idk]
+	if !ok {
+		return nil, ssp.ErrNotFound
+	}
+	if identity.Disabled {
+		return nil, gormauthstore.ErrIdentityDisabled
+	}
+	identity.Disabled = true
+	s.identities[idk] = identity
+	return &identity, nil
+}
+
+// sorted returns copies of all identities ordered by idk, matching the
+// ordering guarantee of the gorm store's list methods.
+func (s *Store) sorted() []*ssp.SqrlIdentity {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make([]*ssp.SqrlIdentity, 0, len(s.identities))
+	for _, identity := range s.identities {
+		all = append(all, &identity)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Idk < all[j].Idk })
+	return all
+}
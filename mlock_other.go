@@ -0,0 +1,26 @@
+//go:build !(linux || darwin)
+
+package gormauthstore
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// errMlockUnsupported reports that this platform has no memory locking.
+var errMlockUnsupported = errors.New("memory locking not supported on this platform")
+
+// mlock is unavailable here; LockedSecureBuffer degrades to unlocked memory.
+func mlock([]byte) error {
+	return errMlockUnsupported
+}
+
+// munlock is never reached, since mlock always fails.
+func munlock([]byte) error {
+	return nil
+}
+
+// addressOf returns the address of b's first byte, for page alignment.
+func addressOf(b []byte) uintptr {
+	return uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin
+
+package gormauthstore
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// mlock locks b's pages into RAM. The standard library's syscall wrapper is
+// used rather than golang.org/x/sys to avoid a dependency for two calls.
+func mlock(b []byte) error {
+	return syscall.Mlock(b)
+}
+
+// munlock releases a lock taken by mlock.
+func munlock(b []byte) error {
+	return syscall.Munlock(b)
+}
+
+// addressOf returns the address of b's first byte, for page alignment.
+func addressOf(b []byte) uintptr {
+	return uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+}
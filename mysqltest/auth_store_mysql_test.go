@@ -0,0 +1,249 @@
+//go:build integration
+
+package mysqltest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	gormauthstore "github.com/dxcSithLord/server-go-ssp-gormauthstore"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// dsnEnv names the environment variable holding the test database DSN.
+const dsnEnv = "MYSQL_TEST_DSN"
+
+// setupMySQLStore returns a migrated store on a freshly created
+// sqrl_identities table in the MYSQL_TEST_DSN database, skipping the test
+// if the variable is unset. The tables are dropped again afterwards.
+func setupMySQLStore(t *testing.T) (*gorm.DB, *gormauthstore.AuthStore) {
+	t.Helper()
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", dsnEnv)
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open MySQL database: %v", err)
+	}
+	dropTables := func() {
+		if err := db.Migrator().DropTable("sqrl_identities", "schema_migrations"); err != nil {
+			t.Fatalf("drop tables: %v", err)
+		}
+	}
+	dropTables()
+	t.Cleanup(func() {
+		dropTables()
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	store := gormauthstore.NewAuthStore(db)
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+	return db, store
+}
+
+// MY-001: AutoMigrate creates the schema with case-sensitive key columns,
+// an idk column holding MaxIdkLength characters and the expected types.
+func TestMySQL_Schema(t *testing.T) {
+	db, store := setupMySQLStore(t)
+	if err := store.VerifySchema(context.Background()); err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+
+	columns, err := db.Migrator().ColumnTypes("sqrl_identities")
+	if err != nil {
+		t.Fatalf("ColumnTypes failed: %v", err)
+	}
+	types := make(map[string]gorm.ColumnType, len(columns))
+	for _, column := range columns {
+		types[column.Name()] = column
+	}
+	for _, name := range []string{"idk", "suk", "vuk", "pidk", "sqrl_only", "hardlock", "disabled",
+		"rekeyed", "btn", "mac", "version", "created_at", "updated_at", "deleted_at"} {
+		if _, ok := types[name]; !ok {
+			t.Errorf("column %s missing", name)
+		}
+	}
+	if length, ok := types["idk"].Length(); !ok || length != gormauthstore.MaxIdkLength {
+		t.Errorf("idk length: got %d, want %d", length, gormauthstore.MaxIdkLength)
+	}
+	if pk, ok := types["idk"].PrimaryKey(); !ok || !pk {
+		t.Error("idk is not the primary key")
+	}
+	for _, name := range []string{"sqrl_only", "hardlock", "disabled"} {
+		if dbType := strings.ToLower(types[name].DatabaseTypeName()); dbType != "tinyint" {
+			t.Errorf("%s: got %s, want tinyint", name, dbType)
+		}
+	}
+}
+
+// MY-002: Full Create-Read-Update-Read-Delete cycle, with every field.
+func TestMySQL_CRUDRoundTrip(t *testing.T) {
+	_, store := setupMySQLStore(t)
+	identity := &ssp.SqrlIdentity{
+		Idk:      "mysql-crud",
+		Suk:      "mysql-suk",
+		Vuk:      "mysql-vuk",
+		Pidk:     "mysql-prev",
+		SQRLOnly: true,
+		Btn:      3,
+	}
+	if err := store.SaveIdentity(identity); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	found, err := store.FindIdentity("mysql-crud")
+	if err != nil || *found != *identity {
+		t.Fatalf("read after create: got %+v, %v, want %+v", found, err, *identity)
+	}
+
+	identity.Hardlock = true
+	identity.Btn = -1
+	identity.Rekeyed = "mysql-next"
+	if err := store.SaveIdentity(identity); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	found, err = store.FindIdentity("mysql-crud")
+	if err != nil || *found != *identity {
+		t.Fatalf("read after update: got %+v, %v, want %+v", found, err, *identity)
+	}
+
+	if err := store.DeleteIdentity("mysql-crud"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := store.FindIdentity("mysql-crud"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("after delete: expected ssp.ErrNotFound, got %v", err)
+	}
+}
+
+// MY-003: Keys differing only in case are distinct identities, and a key of
+// MaxIdkLength round-trips.
+func TestMySQL_KeysAreExact(t *testing.T) {
+	_, store := setupMySQLStore(t)
+	long := strings.Repeat("k", gormauthstore.MaxIdkLength)
+	for _, idk := range []string{"CaseKey", "casekey", long} {
+		if err := store.SaveIdentity(&ssp.SqrlIdentity{Idk: idk, Suk: "suk-" + idk[:4]}); err != nil {
+			t.Fatalf("save %q failed: %v", idk[:8], err)
+		}
+	}
+	for _, idk := range []string{"CaseKey", "casekey", long} {
+		found, err := store.FindIdentity(idk)
+		if err != nil || found.Idk != idk || found.Suk != "suk-"+idk[:4] {
+			t.Errorf("find %q: got %+v, %v", idk[:8], found, err)
+		}
+	}
+	if _, err := store.FindIdentity("CASEKEY"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("other case: expected ssp.ErrNotFound, got %v", err)
+	}
+	err := store.SaveIdentityInsertOnly(context.Background(), &ssp.SqrlIdentity{Idk: "casekey"})
+	if !errors.Is(err, gormauthstore.ErrDuplicateIdentity) {
+		t.Errorf("insert-only duplicate: expected ErrDuplicateIdentity, got %v", err)
+	}
+}
+
+// MY-004: SQRL rekey workflow — Pidk links old and new identities, and
+// RenameIdentity rewrites the links.
+func TestMySQL_RekeyWorkflow(t *testing.T) {
+	_, store := setupMySQLStore(t)
+	original := &ssp.SqrlIdentity{Idk: "original-idk", Suk: "original-suk", Vuk: "original-vuk"}
+	if err := store.SaveIdentity(original); err != nil {
+		t.Fatalf("save original failed: %v", err)
+	}
+	rekeyed := &ssp.SqrlIdentity{Idk: "new-idk", Suk: "new-suk", Vuk: "new-vuk", Pidk: "original-idk"}
+	if err := store.SaveIdentity(rekeyed); err != nil {
+		t.Fatalf("save rekeyed failed: %v", err)
+	}
+	original.Rekeyed = "new-idk"
+	if err := store.SaveIdentity(original); err != nil {
+		t.Fatalf("update original failed: %v", err)
+	}
+
+	successor, err := store.FindIdentityByPidk("original-idk")
+	if err != nil || successor.Idk != "new-idk" {
+		t.Fatalf("FindIdentityByPidk: got %+v, %v", successor, err)
+	}
+	if err := store.RenameIdentity(context.Background(), "new-idk", "renamed-idk"); err != nil {
+		t.Fatalf("RenameIdentity failed: %v", err)
+	}
+	found, err := store.FindIdentity("original-idk")
+	if err != nil || found.Rekeyed != "renamed-idk" {
+		t.Errorf("Rekeyed after rename: got %+v, %v", found, err)
+	}
+	found, err = store.FindIdentity("renamed-idk")
+	if err != nil || found.Pidk != "original-idk" {
+		t.Errorf("Pidk after rename: got %+v, %v", found, err)
+	}
+}
+
+// MY-005: Boolean field combinations persist correctly.
+func TestMySQL_BooleanCombinations(t *testing.T) {
+	_, store := setupMySQLStore(t)
+	var combos []ssp.SqrlIdentity
+	for bits := range 8 {
+		combos = append(combos, ssp.SqrlIdentity{
+			Idk:      "bool-" + string(rune('0'+bits)),
+			Suk:      "suk",
+			Vuk:      "vuk",
+			SQRLOnly: bits&1 != 0,
+			Hardlock: bits&2 != 0,
+			Disabled: bits&4 != 0,
+			Btn:      bits,
+		})
+	}
+	for i := range combos {
+		if err := store.SaveIdentity(&combos[i]); err != nil {
+			t.Fatalf("save %q failed: %v", combos[i].Idk, err)
+		}
+	}
+	for _, want := range combos {
+		found, err := store.FindIdentity(want.Idk)
+		if err != nil || *found != want {
+			t.Errorf("find %q: got %+v, %v, want %+v", want.Idk, found, err, want)
+		}
+	}
+
+	active, err := store.FindActiveIdentity(context.Background(), "bool-4")
+	if !errors.Is(err, gormauthstore.ErrIdentityDisabled) {
+		t.Errorf("FindActiveIdentity(disabled): got %+v, %v", active, err)
+	}
+	claimed, err := store.ClaimAndDisable(context.Background(), "bool-0")
+	if err != nil || !claimed.Disabled {
+		t.Errorf("ClaimAndDisable: got %+v, %v", claimed, err)
+	}
+}
+
+// MY-006: A locking read blocked by another transaction's row lock fails
+// with ErrLockTimeout under WithLockTimeout.
+func TestMySQL_LockTimeout(t *testing.T) {
+	db, store := setupMySQLStore(t)
+	if err := store.SaveIdentity(&ssp.SqrlIdentity{Idk: "locked-idk", Suk: "suk", Vuk: "vuk"}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	ctx := context.Background()
+	holder := db.Begin()
+	defer holder.Rollback()
+	if _, err := store.WithTx(holder).FindIdentityForUpdate(ctx, "locked-idk"); err != nil {
+		t.Fatalf("first lock failed: %v", err)
+	}
+
+	waiter := gormauthstore.NewAuthStore(db, gormauthstore.WithLockTimeout(time.Second))
+	start := time.Now()
+	err := waiter.TransactionWithContext(ctx, func(tx *gormauthstore.AuthStore) error {
+		_, err := tx.FindIdentityForUpdate(ctx, "locked-idk")
+		return err
+	})
+	if !errors.Is(err, gormauthstore.ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout, got %v", err)
+	}
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Errorf("waited %v for a 1s lock timeout", waited)
+	}
+}
@@ -0,0 +1,10 @@
+// Package mysqltest runs the store's integration tests against MySQL or
+// MariaDB. They are built with the integration tag and need a database
+// whose tables they may drop:
+//
+//	MYSQL_TEST_DSN='user:pass@tcp(localhost:3306)/sqrl_test?charset=utf8mb4&parseTime=True&loc=UTC' \
+//		go test -tags integration .
+//
+// Without MYSQL_TEST_DSN every test is skipped. It is a separate module,
+// so the store does not depend on the MySQL driver.
+package mysqltest
@@ -0,0 +1,14 @@
+// The MySQL integration tests are their own module so that the store itself
+// does not depend on the MySQL driver.
+module github.com/dxcSithLord/server-go-ssp-gormauthstore/mysqltest
+
+go 1.25.0
+
+require (
+	github.com/dxcSithLord/server-go-ssp v0.0.0-20260202110616-66529f78b7f1
+	github.com/dxcSithLord/server-go-ssp-gormauthstore v0.0.0-00010101000000-000000000000
+	gorm.io/driver/mysql v1.6.0
+	gorm.io/gorm v1.31.1
+)
+
+replace github.com/dxcSithLord/server-go-ssp-gormauthstore => ../
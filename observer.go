@@ -0,0 +1,124 @@
+package gormauthstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// ErrorObserver receives the failures of store operations; see
+// WithErrorObserver. op is the method name without any WithContext suffix,
+// such as "FindIdentity". idkHash identifies the identity the operation was
+// given without revealing it (see IdkHash) and is empty for operations that
+// are not about a single identity. err is the error returned to the caller.
+type ErrorObserver func(op, idkHash string, err error)
+
+// IdkHash returns the form of idk passed to an ErrorObserver: the first 8
+// bytes of its SHA-256 digest, hex encoded. An empty idk hashes to "".
+// Applications can use it to correlate observed failures with their own
+// records without logging identity keys.
+func IdkHash(idk string) string {
+	if idk == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(idk))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Collector receives the outcome and latency of every store operation; see
+// WithMetrics. The prometheus and otel subpackages provide one each.
+type Collector interface {
+	// ObserveOp is called once per operation, as it returns. op is named as
+	// for an ErrorObserver, dur is the time spent in the method, including
+	// validation and retries, and err is the error returned to the caller:
+	// nil on success and ssp.ErrNotFound for a missing identity.
+	ObserveOp(op string, dur time.Duration, err error)
+}
+
+// Outcome values of an operation, as recorded by the Collector adapters.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not_found"
+	OutcomeError    = "error"
+)
+
+// Outcome returns the outcome of an operation that returned err. A missing
+// identity is an expected result of a lookup, not a failure, so it is
+// counted apart from errors. The Collector adapters label their metrics
+// with it so that every metrics backend classifies operations alike.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, ssp.ErrNotFound):
+		return OutcomeNotFound
+	default:
+		return OutcomeError
+	}
+}
+
+// Tracer starts a trace span for each store operation; see WithTracer. The
+// otel subpackage provides one for OpenTelemetry.
+type Tracer interface {
+	// Start begins the span of the operation op, named as for an
+	// ErrorObserver, as a child of any span in ctx. It returns the context
+	// the operation runs in and the function that ends the span with the
+	// error returned to the caller. The identity key is never passed.
+	Start(ctx context.Context, op string) (context.Context, func(err error))
+}
+
+// observe starts observing the operation op and returns the context it runs
+// in and the function that completes it, so each public operation begins
+// with
+//
+//	ctx, done := as.observe(ctx, "Op", idk, &err)
+//	defer done()
+//
+// The operation runs in the WithTracer span, if any. The returned function
+// ends the span, passes the operation to the WithMetrics Collector, writes
+// its WithLogger records and reports *err to the ErrorObserver;
+// ssp.ErrNotFound is an expected outcome, not a failure, and is never
+// reported to the latter.
+func (as *AuthStore) observe(ctx context.Context, op, idk string, err *error) (context.Context, func()) {
+	if as.cfg.metrics == nil && as.cfg.errorObserver == nil && as.cfg.tracer == nil && as.cfg.logger == nil {
+		return ctx, func() {}
+	}
+	var endSpan func(error)
+	if as.cfg.tracer != nil {
+		ctx, endSpan = as.cfg.tracer.Start(ctx, op)
+	}
+	var note *rowsNote
+	if as.cfg.logger != nil && mutatingOps[op] {
+		note = &rowsNote{}
+		ctx = context.WithValue(ctx, rowsNoteKey{}, note)
+	}
+	start := time.Now()
+	return ctx, func() {
+		dur := time.Since(start)
+		if endSpan != nil {
+			endSpan(*err)
+		}
+		if as.cfg.metrics != nil {
+			as.cfg.metrics.ObserveOp(op, dur, *err)
+		}
+		if as.cfg.logger != nil {
+			as.logOp(ctx, op, idk, note, dur, *err)
+		}
+		if as.cfg.errorObserver == nil || *err == nil || errors.Is(*err, ssp.ErrNotFound) {
+			return
+		}
+		as.cfg.errorObserver(op, IdkHash(idk), *err)
+	}
+}
+
+// identityIdk returns identity.Idk, or "" for a nil identity.
+func identityIdk(identity *ssp.SqrlIdentity) string {
+	if identity == nil {
+		return ""
+	}
+	return identity.Idk
+}
@@ -0,0 +1,250 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// observation is one ErrorObserver call.
+type observation struct {
+	op      string
+	idkHash string
+	err     error
+}
+
+// observerRecorder collects ErrorObserver calls.
+type observerRecorder struct {
+	mu    sync.Mutex
+	calls []observation
+}
+
+func (r *observerRecorder) observe(op, idkHash string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, observation{op, idkHash, err})
+}
+
+func (r *observerRecorder) take() []observation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.calls
+	r.calls = nil
+	return calls
+}
+
+// TestErrorObserver_ReportsFailures verifies failures are reported once,
+// under the public method name, with a hashed idk.
+func TestErrorObserver_ReportsFailures(t *testing.T) {
+	rec := &observerRecorder{}
+	_, store := newTestStoreWithOptions(t, WithErrorObserver(rec.observe), WithProtectHardlocked())
+	seedIdentity(t, store, newTestIdentity().withIdk("obs-locked").withHardlock().build())
+	seedIdentity(t, store, newTestIdentity().withIdk("obs-disabled").withDisabled().build())
+
+	tests := []struct {
+		op   string
+		idk  string
+		call func() error
+		want error
+	}{
+		{"DeleteIdentity", "obs-locked", func() error { return store.DeleteIdentity("obs-locked") }, ErrIdentityHardlocked},
+		{"FindActiveIdentity", "obs-disabled", func() error {
+			_, err := store.FindActiveIdentity(context.Background(), "obs-disabled")
+			return err
+		}, ErrIdentityDisabled},
+		{"SaveIdentity", "bad idk", func() error {
+			return store.SaveIdentity(newTestIdentity().withIdk("bad idk").build())
+		}, ErrInvalidIdentityKeyFormat},
+		{"SaveIdentity", "", func() error { return store.SaveIdentity(nil) }, ErrNilIdentity},
+		{"DeleteWhere", "", func() error {
+			_, err := store.DeleteWhere(context.Background(), IdentityFilter{})
+			return err
+		}, ErrEmptyFilter},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.op, tt.want, err)
+		}
+		calls := rec.take()
+		if len(calls) != 1 {
+			t.Fatalf("%s: expected 1 observation, got %d: %+v", tt.op, len(calls), calls)
+		}
+		got := calls[0]
+		if got.op != tt.op || got.idkHash != IdkHash(tt.idk) || !errors.Is(got.err, tt.want) {
+			t.Errorf("%s: observed %+v, want op %q hash %q err %v", tt.op, got, tt.op, IdkHash(tt.idk), tt.want)
+		}
+	}
+}
+
+// TestErrorObserver_IgnoresSuccessAndNotFound verifies successes and
+// ssp.ErrNotFound are not reported, including by SelfTest's inner steps.
+func TestErrorObserver_IgnoresSuccessAndNotFound(t *testing.T) {
+	rec := &observerRecorder{}
+	_, store := newTestStoreWithOptions(t, WithErrorObserver(rec.observe))
+
+	seedIdentity(t, store, newTestIdentity().withIdk("obs-ok").build())
+	if _, err := store.FindIdentity("obs-ok"); err != nil {
+		t.Fatalf("FindIdentity: %v", err)
+	}
+	if _, err := store.FindIdentitySecure("obs-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Fatalf("FindIdentitySecure: expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.ClaimAndDisable(context.Background(), "obs-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Fatalf("ClaimAndDisable: expected ErrNotFound, got %v", err)
+	}
+	if err := store.SelfTest(context.Background()); err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+	if calls := rec.take(); len(calls) != 0 {
+		t.Errorf("expected no observations, got %+v", calls)
+	}
+}
+
+// TestIdkHash verifies the hash is stable, short and never the idk itself.
+func TestIdkHash(t *testing.T) {
+	if IdkHash("") != "" {
+		t.Error("empty idk should hash to empty string")
+	}
+	h := IdkHash("obs-idk")
+	if len(h) != 16 || h == "obs-idk" || h != IdkHash("obs-idk") || h == IdkHash("obs-idk2") {
+		t.Errorf("unexpected hash %q", h)
+	}
+}
+
+// TestOutcome verifies a missing identity is told apart from a failure.
+func TestOutcome(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{nil, OutcomeSuccess},
+		{fmt.Errorf("lookup: %w", ssp.ErrNotFound), OutcomeNotFound},
+		{ErrStore, OutcomeError},
+	} {
+		if got := Outcome(tc.err); got != tc.want {
+			t.Errorf("Outcome(%v): got %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+// metricsRecorder is a Collector that records the operations it observes.
+type metricsRecorder struct {
+	mu   sync.Mutex
+	ops  []string
+	errs []error
+}
+
+func (r *metricsRecorder) ObserveOp(op string, dur time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if dur < 0 {
+		op += " (negative duration)"
+	}
+	r.ops = append(r.ops, op)
+	r.errs = append(r.errs, err)
+}
+
+// TestWithMetrics verifies every operation is observed once, under its
+// public name, whatever its outcome.
+func TestWithMetrics(t *testing.T) {
+	rec := &metricsRecorder{}
+	_, store := newTestStoreWithOptions(t, WithMetrics(rec))
+	seedIdentity(t, store, newTestIdentity().withIdk("met-1").build())
+	if _, err := store.FindIdentity("met-1"); err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if _, err := store.FindIdentity("met-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Fatalf("expected ssp.ErrNotFound, got %v", err)
+	}
+	if err := store.DeleteIdentity("bad idk"); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Fatalf("expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+	if err := store.SelfTest(context.Background()); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+
+	wantOps := []string{"Migrate", "SaveIdentity", "FindIdentity", "FindIdentity", "DeleteIdentity", "Migrate", "SelfTest"}
+	wantErrs := []error{nil, nil, nil, ssp.ErrNotFound, ErrInvalidIdentityKeyFormat, nil, nil}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.ops) != len(wantOps) {
+		t.Fatalf("observed %v, want %v", rec.ops, wantOps)
+	}
+	for i := range wantOps {
+		if rec.ops[i] != wantOps[i] || !errors.Is(rec.errs[i], wantErrs[i]) || (wantErrs[i] == nil) != (rec.errs[i] == nil) {
+			t.Errorf("observation %d: got %s, %v, want %s, %v", i, rec.ops[i], rec.errs[i], wantOps[i], wantErrs[i])
+		}
+	}
+}
+
+// spanKey marks the context a tracerRecorder span was started in.
+type spanKey struct{}
+
+// tracerRecorder is a Tracer that records started and ended spans, and
+// gorm callbacks that record whether statements ran in a span's context.
+type tracerRecorder struct {
+	mu      sync.Mutex
+	started []string
+	ended   []error
+	inSpan  []string
+}
+
+func (r *tracerRecorder) Start(ctx context.Context, op string) (context.Context, func(err error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = append(r.started, op)
+	return context.WithValue(ctx, spanKey{}, op), func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.ended = append(r.ended, err)
+	}
+}
+
+// TestWithTracer verifies each operation runs its statements in its own span
+// and ends the span with the operation's error.
+func TestWithTracer(t *testing.T) {
+	rec := &tracerRecorder{}
+	db, store := newTestStoreWithOptions(t, WithTracer(rec))
+	err := db.Callback().Query().Before("gorm:query").Register("test:span", func(tx *gorm.DB) {
+		op, _ := tx.Statement.Context.Value(spanKey{}).(string)
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.inSpan = append(rec.inSpan, op)
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	seedIdentity(t, store, newTestIdentity().withIdk("trc-1").build())
+	if _, err := store.FindIdentity("trc-1"); err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if _, err := store.FindIdentity("trc-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Fatalf("expected ssp.ErrNotFound, got %v", err)
+	}
+
+	wantOps := []string{"Migrate", "SaveIdentity", "FindIdentity", "FindIdentity"}
+	wantErrs := []error{nil, nil, nil, ssp.ErrNotFound}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if !slices.Equal(rec.started, wantOps) || len(rec.ended) != len(wantErrs) {
+		t.Fatalf("spans: started %v, ended %v, want %v", rec.started, rec.ended, wantOps)
+	}
+	for i, want := range wantErrs {
+		if !errors.Is(rec.ended[i], want) || (want == nil) != (rec.ended[i] == nil) {
+			t.Errorf("span %d ended with %v, want %v", i, rec.ended[i], want)
+		}
+	}
+	if want := []string{"FindIdentity", "FindIdentity"}; !slices.Equal(rec.inSpan, want) {
+		t.Errorf("queries ran in spans %q, want %q", rec.inSpan, want)
+	}
+}
@@ -0,0 +1,93 @@
+package gormauthstore
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"sync"
+	"weak"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// versionTracker remembers, for WithOptimisticLocking, the row version each
+// identity object returned by the store was read at. ssp.SqrlIdentity has
+// no field for it, so the version is keyed by the object itself. The keys
+// are weak: an entry is dropped once the caller lets go of its identity.
+type versionTracker struct {
+	mu       sync.Mutex
+	versions map[weak.Pointer[ssp.SqrlIdentity]]int64
+}
+
+// set records version for identity.
+func (t *versionTracker) set(identity *ssp.SqrlIdentity, version int64) {
+	key := weak.Make(identity)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.versions == nil {
+		t.versions = make(map[weak.Pointer[ssp.SqrlIdentity]]int64)
+	}
+	if _, ok := t.versions[key]; !ok {
+		runtime.AddCleanup(identity, t.forget, key)
+	}
+	t.versions[key] = version
+}
+
+// get returns the version recorded for identity, if any.
+func (t *versionTracker) get(identity *ssp.SqrlIdentity) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	version, ok := t.versions[weak.Make(identity)]
+	return version, ok
+}
+
+// forget drops the entry of a collected identity.
+func (t *versionTracker) forget(key weak.Pointer[ssp.SqrlIdentity]) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.versions, key)
+}
+
+// trackVersion records that identity was read at version, under
+// WithOptimisticLocking.
+func (as *AuthStore) trackVersion(identity *ssp.SqrlIdentity, version int64) {
+	if as.cfg.optimisticLocking {
+		as.versions.set(identity, version)
+	}
+}
+
+// saveVersioned is SaveIdentity under WithOptimisticLocking: an update
+// conditional on the version identity was read at, or an insert that does
+// nothing if the row exists. Either way no affected row means another
+// writer got there first.
+func (as *AuthStore) saveVersioned(ctx context.Context, identity *ssp.SqrlIdentity, record *identityRecord) error {
+	read, tracked := as.versions.get(identity)
+	if tracked {
+		record.Version = read + 1
+	}
+	var affected int64
+	err := as.run(ctx, opWriteOnce, func(db *gorm.DB) error {
+		var result *gorm.DB
+		if tracked {
+			result = as.identities(db).Model(&identityRecord{}).
+				Where("idk = ? AND version = ?", record.Idk, read).
+				Select(slices.Concat([]string{"version", "updated_at"}, identityColumns)).Updates(record)
+		} else {
+			result = as.identities(db).
+				Select(slices.Concat([]string{"idk", "version"}, identityColumns, timestampColumns)).
+				Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		}
+		affected = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrStaleIdentity
+	}
+	as.versions.set(identity, record.Version)
+	return nil
+}
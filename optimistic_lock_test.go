@@ -0,0 +1,126 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// storedVersion returns the raw version column of the row keyed by idk.
+func storedVersion(t *testing.T, db *gorm.DB, idk string) int64 {
+	t.Helper()
+	var version int64
+	if err := db.Raw("SELECT version FROM sqrl_identities WHERE idk = ?", idk).Scan(&version).Error; err != nil {
+		t.Fatalf("raw select: %v", err)
+	}
+	return version
+}
+
+// TestWithOptimisticLocking_ConflictingWriters verifies that of two writers
+// who read the same version, the second to save gets ErrStaleIdentity and
+// succeeds after reading again.
+func TestWithOptimisticLocking_ConflictingWriters(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithOptimisticLocking())
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-race").build())
+
+	first, err := store.FindIdentity("opt-race")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	second, err := store.FindIdentity("opt-race")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+
+	first.Btn = 1
+	if err := store.SaveIdentity(first); err != nil {
+		t.Fatalf("first save failed: %v", err)
+	}
+	second.Btn = 2
+	if err := store.SaveIdentity(second); !errors.Is(err, ErrStaleIdentity) {
+		t.Fatalf("second save: expected ErrStaleIdentity, got %v", err)
+	}
+	if found, err := store.FindIdentity("opt-race"); err != nil || found.Btn != 1 {
+		t.Errorf("after conflict: got %+v, %v, want Btn 1", found, err)
+	}
+
+	retry, err := store.FindIdentity("opt-race")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	retry.Btn = 2
+	if err := store.SaveIdentity(retry); err != nil {
+		t.Fatalf("retried save failed: %v", err)
+	}
+	if v := storedVersion(t, db, "opt-race"); v != 2 {
+		t.Errorf("version: got %d, want 2", v)
+	}
+}
+
+// TestWithOptimisticLocking_RepeatedSaves verifies a successful save records
+// the new version, so the same object can be saved again.
+func TestWithOptimisticLocking_RepeatedSaves(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithOptimisticLocking())
+	identity := newTestIdentity().withIdk("opt-repeat").build()
+	for btn := 1; btn <= 3; btn++ {
+		identity.Btn = btn
+		if err := store.SaveIdentity(identity); err != nil {
+			t.Fatalf("save %d failed: %v", btn, err)
+		}
+	}
+}
+
+// TestWithOptimisticLocking_UntrackedIdentity verifies an identity object
+// the store did not return only creates rows.
+func TestWithOptimisticLocking_UntrackedIdentity(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithOptimisticLocking())
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-exists").build())
+
+	err := store.SaveIdentity(newTestIdentity().withIdk("opt-exists").withBtn(7).build())
+	if !errors.Is(err, ErrStaleIdentity) {
+		t.Errorf("overwrite by untracked identity: expected ErrStaleIdentity, got %v", err)
+	}
+	if found, err := store.FindIdentity("opt-exists"); err != nil || found.Btn == 7 {
+		t.Errorf("row was overwritten: got %+v, %v", found, err)
+	}
+}
+
+// TestWithOptimisticLocking_OtherWrites verifies writes that do not check the
+// version still bump it, and a deleted row is reported as stale.
+func TestWithOptimisticLocking_OtherWrites(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithOptimisticLocking())
+	plain := NewAuthStore(db)
+	ctx := context.Background()
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-plain").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-claim").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-gone").build())
+
+	writes := map[string]func() error{
+		"opt-plain": func() error { return plain.SaveIdentity(newTestIdentity().withIdk("opt-plain").build()) },
+		"opt-claim": func() error { _, err := plain.ClaimAndDisable(ctx, "opt-claim"); return err },
+		"opt-gone":  func() error { return plain.DeleteIdentity("opt-gone") },
+	}
+	for idk, write := range writes {
+		identity, err := store.FindIdentity(idk)
+		if err != nil {
+			t.Fatalf("FindIdentity(%s) failed: %v", idk, err)
+		}
+		if err := write(); err != nil {
+			t.Fatalf("%s: concurrent write failed: %v", idk, err)
+		}
+		if err := store.SaveIdentity(identity); !errors.Is(err, ErrStaleIdentity) {
+			t.Errorf("%s: expected ErrStaleIdentity, got %v", idk, err)
+		}
+	}
+
+	claimed, err := store.ClaimAndDisable(ctx, "opt-plain")
+	if err != nil {
+		t.Fatalf("ClaimAndDisable failed: %v", err)
+	}
+	claimed.Btn = 5
+	if err := store.SaveIdentity(claimed); err != nil {
+		t.Errorf("saving the claimed identity failed: %v", err)
+	}
+}
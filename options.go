@@ -0,0 +1,460 @@
+package gormauthstore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Option configures an AuthStore at construction time. See NewAuthStore.
+type Option func(*config)
+
+// config holds the resolved options for an AuthStore. The zero value is the
+// default behaviour.
+type config struct {
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	retryMax       int
+	retryDelay     time.Duration
+	defaultTimeout time.Duration
+	lockTimeout    time.Duration
+
+	protectHardlocked bool
+	binaryKeys        bool
+	maxFieldLength    int
+	baseCtx           context.Context
+
+	validationDisabled    bool
+	validationUnconfirmed bool
+	errorObserver         ErrorObserver
+	metrics               Collector
+	tracer                Tracer
+
+	tableName    string
+	maxIdkLength int
+	validator    func(idk string) error
+	logger       *slog.Logger
+
+	encryptionKey []byte
+	previousKeys  [][]byte
+	cipher        *fieldCipher
+	integrityKey  []byte
+	idkPepper     []byte
+
+	optimisticLocking  bool
+	softDelete         bool
+	plaintextMigration bool
+	// optionErr is the first invalid key option, returned by every
+	// operation of the store.
+	optionErr error
+}
+
+// WithReadTimeout bounds each read operation to d, or to the caller's context
+// deadline if that is sooner. A read is any operation that leaves the table
+// unchanged, such as a lookup, listing, count or dry run; with WithRetry the
+// timeout applies to each attempt. Operations that walk the whole table,
+// such as EachIdentity, are bounded by neither timeout. A zero or negative
+// d disables the timeout.
+//
+// Reads sit on the authentication hot path and should fail fast, so this is
+// typically much shorter than the write timeout.
+func WithReadTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.readTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds each write operation to d, or to the caller's
+// context deadline if that is sooner. A write is any operation that
+// changes the table or its schema, such as a save, delete, flag update or
+// migration, except the table-wide batch rewrites, which are bounded only
+// by the caller's context. A zero or negative d disables the timeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.writeTimeout = d
+	}
+}
+
+// WithDefaultTimeout bounds each operation of the methods without a context
+// parameter, such as FindIdentity, SaveIdentity and DeleteIdentity, to d, so
+// they cannot hang on a stuck database; they fail with an error matching
+// context.DeadlineExceeded instead. The *WithContext variants are left to
+// the caller's deadline. WithReadTimeout and WithWriteTimeout, which bound
+// both, take precedence. A zero or negative d disables the timeout.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.defaultTimeout = d
+	}
+}
+
+// WithLockTimeout bounds how long FindIdentityForUpdate waits for a row
+// lock held by another transaction to d, after which it fails with
+// ErrLockTimeout instead of blocking, so a stuck transaction cannot hang
+// its callers. PostgreSQL applies d with SET LOCAL lock_timeout, and MySQL
+// with innodb_lock_wait_timeout, which counts whole seconds, rounded up;
+// the session's previous value is restored after the read. SQLite takes no
+// row locks, so the read never waits there; waits for its database lock
+// are bounded by the connection's busy timeout. A zero or negative d
+// leaves the database's own timeout in place.
+func WithLockTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.lockTimeout = d
+	}
+}
+
+// WithRetry retries an operation that fails with a transient database error
+// (see IsRetryable), making up to maxAttempts attempts in all. Before
+// attempt n+1 it waits a random delay between half and all of
+// baseDelay<<(n-1). Any other outcome, such as a validation error or
+// ssp.ErrNotFound, returns at once, as does the last failure when ctx is
+// cancelled or its deadline would pass during the wait. The read and write
+// timeouts apply to each attempt.
+//
+// Operations on a store bound to a transaction (see WithTx) and EachIdentity
+// are not retried: the transaction is lost with its connection, and fn has
+// already seen some rows. Nor are writes that cannot safely run twice, since
+// the connection may drop after the database applied them: IncrementBtn,
+// ClaimAndDisable, Rekey, RenameIdentity, SaveIdentityInsertOnly,
+// FindOrCreateIdentity, and SaveIdentity under WithOptimisticLocking. They
+// return the transient error, and the caller must read the identity back to
+// learn whether the write took effect. A maxAttempts below 2 disables
+// retrying.
+func WithRetry(maxAttempts int, baseDelay time.Duration) Option {
+	return func(c *config) {
+		c.retryMax = maxAttempts
+		c.retryDelay = baseDelay
+	}
+}
+
+// WithOperationTimeout sets both the read and the write timeout to d. Later
+// WithReadTimeout or WithWriteTimeout options override it per kind.
+func WithOperationTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.readTimeout = d
+		c.writeTimeout = d
+	}
+}
+
+// WithProtectHardlocked makes DeleteIdentity refuse to remove a hardlocked
+// identity, returning ErrIdentityHardlocked instead. SQRL hardlock exists to
+// resist changes, so this enforces it at the storage layer.
+// ForceDeleteIdentity still removes such identities.
+func WithProtectHardlocked() Option {
+	return func(c *config) {
+		c.protectHardlocked = true
+	}
+}
+
+// WithBinaryKeyStorage stores Suk and Vuk in binary (BLOB/bytea) columns
+// instead of text, avoiding charset and collation handling of key material.
+// Keys are written as their raw bytes, so the conversion is lossless. Pidk
+// stays text: it is an identity key that other rows and queries compare.
+//
+// The column type is fixed when the table is created, so choose this before
+// the first AutoMigrate; switching an existing table needs a data migration.
+func WithBinaryKeyStorage() Option {
+	return func(c *config) {
+		c.binaryKeys = true
+	}
+}
+
+// WithMaxFieldLength sets the maximum length in bytes of Suk, Vuk, Pidk and
+// Rekeyed accepted by SaveIdentity. A zero or negative n keeps the default,
+// MaxFieldLength. Oversized fields are rejected with ErrFieldTooLong.
+func WithMaxFieldLength(n int) Option {
+	return func(c *config) {
+		c.maxFieldLength = n
+	}
+}
+
+// WithBaseContext sets the context used by every database operation
+// without a context parameter: each runs as its context-taking
+// counterpart, usually the *WithContext variant, called with it. Binding
+// it to an application-lifetime context lets those methods observe
+// shutdown cancellation and carry process-wide values such as a
+// correlation ID. Per-request cancellation still requires the methods that
+// take a context. A nil ctx keeps the default, context.Background().
+func WithBaseContext(ctx context.Context) Option {
+	return func(c *config) {
+		c.baseCtx = ctx
+	}
+}
+
+// ConfirmValidationDisabled is the confirmation WithValidationDisabled
+// requires. Spelling it out at the call site keeps the option from being
+// enabled by accident or by autocomplete.
+const ConfirmValidationDisabled = "I understand identity key validation is disabled"
+
+// WithValidationDisabled makes the store skip ValidateIdk on the identity
+// keys passed to its methods, so a trusted one-time migration can load
+// legacy keys that predate the current character rules.
+//
+// DO NOT use this on a store that serves authentication traffic. Identity
+// keys are still bound as query parameters, but nothing else stops a
+// malformed key reaching the database. Empty keys, nil identities and the
+// field length limit are still rejected.
+//
+// confirm must equal ConfirmValidationDisabled; any other value leaves
+// validation enabled. Either way NewAuthStore logs a warning (see
+// WithLogger).
+func WithValidationDisabled(confirm string) Option {
+	return func(c *config) {
+		if confirm != ConfirmValidationDisabled {
+			c.validationUnconfirmed = true
+			return
+		}
+		c.validationDisabled = true
+	}
+}
+
+// WithMetrics registers c to observe every store operation, successful or
+// not, with its latency: FindIdentity, SaveIdentity, DeleteIdentity,
+// Migrate (which AutoMigrate runs) and the rest, each named as for
+// WithErrorObserver. Like an
+// ErrorObserver, c runs synchronously on the caller's goroutine and must be
+// fast and safe for concurrent use. A nil c disables it.
+func WithMetrics(c Collector) Option {
+	return func(cfg *config) {
+		cfg.metrics = c
+	}
+}
+
+// WithTracer runs every store operation in a span started by t, so the
+// database calls it makes, and any GORM tracing plugin, nest under it. The
+// otel subpackage's WithTracerProvider returns this option for an
+// OpenTelemetry tracer. A nil t disables tracing.
+func WithTracer(t Tracer) Option {
+	return func(c *config) {
+		c.tracer = t
+	}
+}
+
+// WithErrorObserver registers fn to be called, synchronously, whenever a
+// store operation returns an error other than ssp.ErrNotFound. It gives
+// embedded deployments a hook for surfacing database failures to their own
+// logging without a metrics library. fn receives the operation name, a hash
+// of the identity key and the error, never Suk, Vuk or the key itself. It
+// runs on the caller's goroutine, so it must be fast and safe for concurrent
+// use. A nil fn disables observation.
+func WithErrorObserver(fn ErrorObserver) Option {
+	return func(c *config) {
+		c.errorObserver = fn
+	}
+}
+
+// WithTableName stores identities in the named table instead of
+// sqrl_identities, for deployments with naming conventions or several
+// stores in one database. Every operation and Migrate use it; the table's
+// schema versions are recorded in <name>_schema_migrations, so each store
+// migrates its own table. An empty name keeps the default.
+func WithTableName(name string) Option {
+	return func(c *config) {
+		c.tableName = name
+	}
+}
+
+// WithMaxIdkLength sets the maximum identity key length in bytes accepted by
+// the store, in place of MaxIdkLength. The character rules are unchanged. A
+// zero or negative n keeps the default. The package-level ValidateIdk always
+// applies MaxIdkLength. On MySQL the idk column holds MaxIdkLength
+// characters, so a larger n needs the column widened to match.
+func WithMaxIdkLength(n int) Option {
+	return func(c *config) {
+		c.maxIdkLength = n
+	}
+}
+
+// WithValidator replaces the built-in identity key rules with fn, for
+// deployments whose keys follow another convention. fn runs on every key
+// the store is given, and a non-nil result is returned to the caller
+// unchanged. Empty keys are still rejected with ErrEmptyIdentityKey before
+// fn is called; WithMaxIdkLength no longer applies, so fn must bound the
+// length itself. To extend rather than replace the rules, wrap
+// DefaultValidator:
+//
+//	WithValidator(func(idk string) error {
+//		if err := gormauthstore.DefaultValidator(idk); err != nil {
+//			return err
+//		}
+//		return checkTenantPrefix(idk)
+//	})
+//
+// fn is skipped under WithValidationDisabled. A nil fn restores the
+// built-in rules.
+func WithValidator(fn func(idk string) error) Option {
+	return func(c *config) {
+		c.validator = fn
+	}
+}
+
+// WithLogger sets the logger for the store's diagnostics, such as the
+// WithValidationDisabled warning and prepared-statement cache resets. A nil
+// logger keeps the default, slog.Default().
+//
+// A logger set here also receives an audit record of every mutation, such
+// as SaveIdentity or DeleteIdentity: at Info with the operation, whether it
+// affected a row and its duration, or at Warn with the ErrorClass of the
+// error if it failed. Identity keys that fail validation are logged at Warn
+// with the rule they broke. These records never carry key material: the
+// identity key appears only as its IdkHash fingerprint, and Suk, Vuk, Pidk
+// and Rekeyed not at all. They are not written to slog.Default().
+func WithLogger(l *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// WithEncryptionKey seals Suk, Vuk and Rekeyed with AES-256-GCM under key
+// before they are written, and opens them on read, so a database dump alone
+// does not reveal key material. Idk and Pidk stay plaintext: every lookup
+// and the rekey graph compare them.
+//
+// key must be EncryptionKeySize bytes; any other length makes every
+// operation fail with ErrInvalidEncryptionKey. NewAuthStore copies and
+// expands the key, so the caller may wipe it afterwards. Each value is bound
+// to its column and row, so one copied to another column or row in the
+// database no longer opens. A sealed value read with an unknown key, or
+// with no key, fails with ErrDecryptionFailed, as does a plaintext value
+// unless WithPlaintextMigration is set.
+func WithEncryptionKey(key []byte) Option {
+	return func(c *config) {
+		c.encryptionKey = append([]byte{}, key...)
+	}
+}
+
+// WithPreviousEncryptionKeys lets a store using WithEncryptionKey also open
+// values sealed under keys, which are never used to seal. Configure the
+// retiring key here while RotateEncryptionKey moves the table to the new
+// one, so the store reads rows on either side of the rotation. Each key
+// must be EncryptionKeySize bytes; without WithEncryptionKey every
+// operation fails with ErrInvalidEncryptionKey.
+func WithPreviousEncryptionKeys(keys ...[]byte) Option {
+	return func(c *config) {
+		for _, key := range keys {
+			c.previousKeys = append(c.previousKeys, append([]byte(nil), key...))
+		}
+	}
+}
+
+// WithPlaintextMigration lets a store using WithEncryptionKey read Suk, Vuk
+// and Rekeyed values stored unsealed, as in rows written before encryption
+// was enabled, and lets RotateEncryptionKey seal them. Such rows are sealed
+// when next saved.
+//
+// Without it a plaintext value fails with ErrDecryptionFailed: anyone able
+// to write a row could otherwise replace a sealed value with one of their
+// choosing, which no key or row binding checks. Set it only while
+// migrating an existing table, and remove it once RotateEncryptionKey has
+// sealed every row. It has no effect without WithEncryptionKey.
+func WithPlaintextMigration() Option {
+	return func(c *config) {
+		c.plaintextMigration = true
+	}
+}
+
+// WithIntegrityKey makes the store tag every row it writes with an
+// HMAC-SHA256, under key, of all the identity's fields, kept in the mac
+// column, and verify the tag on every read. A row altered in the database
+// itself, such as Disabled flipped by hand, then fails with
+// ErrIntegrityCheckFailed instead of being returned.
+//
+// key must be at least IntegrityKeyMinSize bytes; a shorter one makes every
+// operation fail with ErrInvalidIntegrityKey. Rows written without the key
+// have no tag and fail verification too, so enable it on an empty table or
+// re-save existing rows through a store configured with it.
+func WithIntegrityKey(key []byte) Option {
+	return func(c *config) {
+		c.integrityKey = append([]byte{}, key...)
+	}
+}
+
+// WithIdkPepper stores each identity key as its HMAC-SHA256 under pepper
+// instead of in plaintext, so a stolen database does not list the users'
+// identity keys. Keys passed to the store are validated raw, then hashed
+// before every lookup and write; Pidk and Rekeyed keep their raw values.
+// The hash cannot be reversed, so identities returned by the list methods,
+// EachIdentity and FindIdentityByPidk carry the stored hash as Idk; the
+// lookups by key return the key they were given.
+//
+// pepper must be at least IdkPepperMinSize bytes; a shorter one makes every
+// operation fail with ErrInvalidIdkPepper. Keep it outside the database and
+// never change it: rows hashed under one pepper are unreachable under
+// another. To convert an existing table, enable it and run
+// HashIdentityKeys.
+func WithIdkPepper(pepper []byte) Option {
+	return func(c *config) {
+		c.idkPepper = append([]byte{}, pepper...)
+	}
+}
+
+// WithOptimisticLocking makes SaveIdentity fail with ErrStaleIdentity,
+// instead of overwriting, when another writer changed the identity since it
+// was read. Every write bumps the row's version column; the store remembers
+// the version each identity it returns was read at, and SaveIdentity only
+// updates the row if it still has that version:
+//
+//	identity, err := store.FindIdentity(idk)
+//	...
+//	identity.Btn = btn
+//	if err := store.SaveIdentity(identity); errors.Is(err, ErrStaleIdentity) {
+//		// someone else saved first: find again and retry
+//	}
+//
+// Versions are recorded for identities returned by FindIdentity,
+// FindActiveIdentity, FindIdentityForUpdate, FindIdentitySecure,
+// SaveAndReload, ClaimAndDisable and a successful SaveIdentity. Saving any
+// other identity object creates the row, and fails with ErrStaleIdentity if
+// it already exists. SaveAndReload and SaveIdentities write unconditionally.
+// It is an alternative to FindIdentityForUpdate that holds no row lock.
+func WithOptimisticLocking() Option {
+	return func(c *config) {
+		c.optimisticLocking = true
+	}
+}
+
+// WithSoftDelete makes the delete methods (DeleteIdentity, DeleteIdentities,
+// DeleteWhere and the Force variants) stamp the row's deleted_at instead of
+// removing it, to retain revoked identities for a compliance period. Every
+// other method then treats a soft-deleted identity as absent: FindIdentity
+// returns ssp.ErrNotFound, and the list, count and bulk methods skip it.
+// FindIdentityIncludingDeleted still reads it, and PurgeDeleted removes it
+// for good once the retention period has passed.
+//
+// A soft-deleted row keeps its key: saving an identity with that key again
+// overwrites and undeletes it, and RenameIdentity cannot take it. Key
+// rotation and HashIdentityKeys convert soft-deleted rows too.
+func WithSoftDelete() Option {
+	return func(c *config) {
+		c.softDelete = true
+	}
+}
+
+// buildKeys expands the WithEncryptionKey and WithPreviousEncryptionKeys
+// keys into the store's fieldCipher, wiping the raw copies, and checks the
+// WithIntegrityKey key and WithIdkPepper pepper. The first invalid one is
+// kept as optionErr.
+func (c *config) buildKeys() {
+	defer func() {
+		WipeBytes(c.encryptionKey)
+		for _, key := range c.previousKeys {
+			WipeBytes(key)
+		}
+		c.encryptionKey, c.previousKeys = nil, nil
+	}()
+	switch {
+	case c.encryptionKey != nil:
+		c.cipher, c.optionErr = newFieldCipher(c.encryptionKey, c.previousKeys...)
+		if c.cipher != nil {
+			c.cipher.acceptPlaintext = c.plaintextMigration
+		}
+	case c.previousKeys != nil:
+		c.optionErr = fmt.Errorf("%w: previous keys set without WithEncryptionKey", ErrInvalidEncryptionKey)
+	}
+	if c.optionErr == nil && c.integrityKey != nil && len(c.integrityKey) < IntegrityKeyMinSize {
+		c.optionErr = fmt.Errorf("%w: got %d bytes, want at least %d", ErrInvalidIntegrityKey, len(c.integrityKey), IntegrityKeyMinSize)
+	}
+	if c.optionErr == nil && c.idkPepper != nil && len(c.idkPepper) < IdkPepperMinSize {
+		c.optionErr = fmt.Errorf("%w: got %d bytes, want at least %d", ErrInvalidIdkPepper, len(c.idkPepper), IdkPepperMinSize)
+	}
+}
@@ -0,0 +1,551 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// deadlineRecorder captures the time remaining until the statement context
+// deadline for the most recent read and write statement.
+type deadlineRecorder struct {
+	mu    sync.Mutex
+	read  time.Duration
+	write time.Duration
+}
+
+// noDeadline marks a statement that ran without a context deadline.
+const noDeadline = time.Duration(-1)
+
+func recordDeadlines(t *testing.T, db *gorm.DB) *deadlineRecorder {
+	t.Helper()
+	rec := &deadlineRecorder{read: noDeadline, write: noDeadline}
+	remaining := func(tx *gorm.DB) time.Duration {
+		deadline, ok := tx.Statement.Context.Deadline()
+		if !ok {
+			return noDeadline
+		}
+		return time.Until(deadline)
+	}
+	onRead := func(tx *gorm.DB) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.read = remaining(tx)
+	}
+	onWrite := func(tx *gorm.DB) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.write = remaining(tx)
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("test:read_deadline", onRead); err != nil {
+		t.Fatalf("register query callback: %v", err)
+	}
+	for _, register := range []func(string, func(*gorm.DB)) error{
+		db.Callback().Create().Before("gorm:create").Register,
+		db.Callback().Update().Before("gorm:update").Register,
+		db.Callback().Delete().Before("gorm:delete").Register,
+	} {
+		if err := register("test:write_deadline", onWrite); err != nil {
+			t.Fatalf("register write callback: %v", err)
+		}
+	}
+	return rec
+}
+
+func (r *deadlineRecorder) last() (read, write time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.read, r.write
+}
+
+// TestNewAuthStore_NoOptions verifies the zero configuration applies no timeouts.
+func TestNewAuthStore_NoOptions(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	rec := recordDeadlines(t, db)
+
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-none").build())
+	if _, err := store.FindIdentity("opt-none"); err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+
+	read, write := rec.last()
+	if read != noDeadline || write != noDeadline {
+		t.Errorf("expected no deadlines, got read=%v write=%v", read, write)
+	}
+}
+
+// TestReadWriteTimeouts_AppliedByKind verifies reads and writes get their own timeout.
+func TestReadWriteTimeouts_AppliedByKind(t *testing.T) {
+	const readTimeout = 50 * time.Millisecond
+	const writeTimeout = 500 * time.Millisecond
+
+	db, store := newTestStoreWithOptions(t, WithReadTimeout(readTimeout), WithWriteTimeout(writeTimeout))
+	rec := recordDeadlines(t, db)
+
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-kinds").build())
+	if _, err := store.FindIdentity("opt-kinds"); err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if err := store.DeleteIdentity("opt-kinds"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+
+	read, write := rec.last()
+	if read == noDeadline || read > readTimeout {
+		t.Errorf("read deadline: got %v, want <= %v", read, readTimeout)
+	}
+	if write == noDeadline || write > writeTimeout || write <= readTimeout {
+		t.Errorf("write deadline: got %v, want in (%v, %v]", write, readTimeout, writeTimeout)
+	}
+}
+
+// TestReadTimeout_CallerDeadlineNotExtended verifies a caller deadline sooner
+// than the store default is respected rather than extended.
+func TestReadTimeout_CallerDeadlineNotExtended(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithOperationTimeout(time.Second))
+	rec := recordDeadlines(t, db)
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-caller").build())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := store.FindIdentityWithContext(ctx, "opt-caller"); err != nil {
+		t.Fatalf("FindIdentityWithContext failed: %v", err)
+	}
+
+	read, _ := rec.last()
+	if read == noDeadline || read > 10*time.Millisecond {
+		t.Errorf("caller deadline extended: remaining %v, want <= 10ms", read)
+	}
+}
+
+// TestReadTimeout_ShrinksLaterCallerDeadline verifies the store default
+// applies when the caller's deadline is later than it.
+func TestReadTimeout_ShrinksLaterCallerDeadline(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithReadTimeout(50*time.Millisecond))
+	rec := recordDeadlines(t, db)
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-later").build())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := store.FindIdentityWithContext(ctx, "opt-later"); err != nil {
+		t.Fatalf("FindIdentityWithContext failed: %v", err)
+	}
+
+	read, _ := rec.last()
+	if read == noDeadline || read > 50*time.Millisecond {
+		t.Errorf("store timeout not applied: remaining %v, want <= 50ms", read)
+	}
+}
+
+// TestWithOperationTimeout_SetsBothKinds verifies the combined option and
+// that a later per-kind option overrides it.
+func TestWithOperationTimeout_SetsBothKinds(t *testing.T) {
+	var c config
+	for _, opt := range []Option{WithOperationTimeout(time.Second), WithWriteTimeout(2 * time.Second)} {
+		opt(&c)
+	}
+	if c.readTimeout != time.Second || c.writeTimeout != 2*time.Second {
+		t.Errorf("got read=%v write=%v, want read=1s write=2s", c.readTimeout, c.writeTimeout)
+	}
+}
+
+// TestReadTimeout_Expires verifies a read fails once the read timeout elapses.
+func TestReadTimeout_Expires(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithReadTimeout(10*time.Millisecond))
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-expire").build())
+
+	err := db.Callback().Query().Before("gorm:query").Register("test:stall", func(tx *gorm.DB) {
+		<-tx.Statement.Context.Done()
+	})
+	if err != nil {
+		t.Fatalf("register stall callback: %v", err)
+	}
+
+	_, err = store.FindIdentity("opt-expire")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestWithDefaultTimeout verifies the default timeout bounds only the
+// methods without a context parameter, and that a stalled database fails
+// them with a deadline error instead of hanging.
+func TestWithDefaultTimeout(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithDefaultTimeout(time.Second))
+	rec := recordDeadlines(t, db)
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-default").build())
+
+	if _, err := store.FindIdentity("opt-default"); err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if read, write := rec.last(); read == noDeadline || read > time.Second || write == noDeadline {
+		t.Errorf("non-context methods: got read=%v write=%v, want deadlines <= 1s", read, write)
+	}
+	if _, err := store.FindIdentityWithContext(context.Background(), "opt-default"); err != nil {
+		t.Fatalf("FindIdentityWithContext failed: %v", err)
+	}
+	if read, _ := rec.last(); read != noDeadline {
+		t.Errorf("*WithContext method: got deadline %v, want none", read)
+	}
+
+	stalling := NewAuthStore(db, WithDefaultTimeout(20*time.Millisecond))
+	err := db.Callback().Query().Before("gorm:query").Register("test:stall", func(tx *gorm.DB) {
+		<-tx.Statement.Context.Done()
+	})
+	if err != nil {
+		t.Fatalf("register stall callback: %v", err)
+	}
+	if _, err := stalling.FindIdentity("opt-default"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("stalled FindIdentity: expected context.DeadlineExceeded, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := stalling.FindIdentityWithContext(ctx, "opt-default"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("stalled FindIdentityWithContext: expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestProtectHardlocked_DeleteRefused verifies a protected store keeps a
+// hardlocked identity and ForceDeleteIdentity still removes it.
+func TestProtectHardlocked_DeleteRefused(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithProtectHardlocked())
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-locked").withHardlock().build())
+
+	if err := store.DeleteIdentity("opt-locked"); !errors.Is(err, ErrIdentityHardlocked) {
+		t.Fatalf("expected ErrIdentityHardlocked, got %v", err)
+	}
+	if _, err := store.FindIdentity("opt-locked"); err != nil {
+		t.Fatalf("hardlocked identity was deleted: %v", err)
+	}
+
+	if err := store.ForceDeleteIdentity("opt-locked"); err != nil {
+		t.Fatalf("ForceDeleteIdentity failed: %v", err)
+	}
+	if _, err := store.FindIdentity("opt-locked"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("expected ssp.ErrNotFound after force delete, got %v", err)
+	}
+}
+
+// TestProtectHardlocked_UnlockedAndMissing verifies a protected store still
+// deletes unlocked identities and treats missing keys as a no-op.
+func TestProtectHardlocked_UnlockedAndMissing(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithProtectHardlocked())
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-unlocked").build())
+
+	if err := store.DeleteIdentity("opt-unlocked"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+	if _, err := store.FindIdentity("opt-unlocked"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("expected ssp.ErrNotFound, got %v", err)
+	}
+	if err := store.DeleteIdentity("opt-missing"); err != nil {
+		t.Errorf("deleting a missing key: expected nil, got %v", err)
+	}
+}
+
+// TestProtectHardlocked_DefaultDeletes verifies hardlocked identities are
+// deleted when the option is not set.
+func TestProtectHardlocked_DefaultDeletes(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-default").withHardlock().build())
+
+	if err := store.DeleteIdentity("opt-default"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+	if _, err := store.FindIdentity("opt-default"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("expected ssp.ErrNotFound, got %v", err)
+	}
+}
+
+// TestBinaryKeyStorage_ColumnsAndRoundTrip verifies Suk and Vuk are created
+// and written as binary and read back losslessly through every read path.
+func TestBinaryKeyStorage_ColumnsAndRoundTrip(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithBinaryKeyStorage())
+
+	var columnType string
+	if err := db.Raw("SELECT type FROM pragma_table_info('sqrl_identities') WHERE name = 'suk'").Scan(&columnType).Error; err != nil {
+		t.Fatalf("table info: %v", err)
+	}
+	if !strings.EqualFold(columnType, "blob") {
+		t.Errorf("suk column type: got %q, want blob", columnType)
+	}
+
+	identity := newTestIdentity().withIdk("opt-binary").withSuk("suk\x00\xff\xfe").withVuk("vuk-é").withPidk("opt-prev").build()
+	reloaded, err := store.SaveAndReload(context.Background(), identity)
+	if err != nil {
+		t.Fatalf("SaveAndReload failed: %v", err)
+	}
+	if *reloaded != *identity {
+		t.Errorf("SaveAndReload: got %+v, want %+v", *reloaded, *identity)
+	}
+
+	var stored struct{ Suk, Vuk string }
+	if err := db.Raw("SELECT typeof(suk) AS suk, typeof(vuk) AS vuk FROM sqrl_identities WHERE idk = ?", "opt-binary").Scan(&stored).Error; err != nil {
+		t.Fatalf("typeof: %v", err)
+	}
+	if stored.Suk != "blob" || stored.Vuk != "blob" {
+		t.Errorf("stored value types: suk=%s vuk=%s, want blob", stored.Suk, stored.Vuk)
+	}
+
+	found, err := store.FindIdentity("opt-binary")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("FindIdentity: got %+v, want %+v", *found, *identity)
+	}
+	err = store.EachIdentity(context.Background(), func(id *ssp.SqrlIdentity) error {
+		if id.Suk != identity.Suk || id.Vuk != identity.Vuk {
+			t.Errorf("EachIdentity: got suk=%q vuk=%q", id.Suk, id.Vuk)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachIdentity failed: %v", err)
+	}
+}
+
+// TestBinaryKeyStorage_DefaultText verifies keys stay text without the option.
+func TestBinaryKeyStorage_DefaultText(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-text").build())
+
+	var valueType string
+	if err := db.Raw("SELECT typeof(suk) FROM sqrl_identities WHERE idk = ?", "opt-text").Scan(&valueType).Error; err != nil {
+		t.Fatalf("typeof: %v", err)
+	}
+	if valueType != "text" {
+		t.Errorf("stored suk type: got %s, want text", valueType)
+	}
+}
+
+// TestWithMaxFieldLength verifies SaveIdentity enforces a configured field
+// length limit and the default applies otherwise.
+func TestWithMaxFieldLength(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithMaxFieldLength(16))
+
+	if err := store.SaveIdentity(newTestIdentity().withIdk("opt-len-ok").withSuk(strings.Repeat("s", 16)).build()); err != nil {
+		t.Errorf("at limit: expected nil, got %v", err)
+	}
+	err := store.SaveIdentity(newTestIdentity().withIdk("opt-len-long").withVuk(strings.Repeat("v", 17)).build())
+	if !errors.Is(err, ErrFieldTooLong) {
+		t.Errorf("over limit: expected ErrFieldTooLong, got %v", err)
+	}
+	if _, err := store.FindIdentity("opt-len-long"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("rejected identity was stored: %v", err)
+	}
+
+	_, defaults := newTestStoreWithOptions(t)
+	if err := defaults.SaveIdentity(newTestIdentity().withIdk("opt-len-default").withSuk(strings.Repeat("s", MaxFieldLength+1)).build()); !errors.Is(err, ErrFieldTooLong) {
+		t.Errorf("default limit: expected ErrFieldTooLong, got %v", err)
+	}
+}
+
+// TestWithBaseContext verifies the context-free methods use the base context
+// and stop once it is cancelled, while *WithContext methods are unaffected.
+func TestWithBaseContext(t *testing.T) {
+	base, cancel := context.WithCancel(ContextWithCorrelationID(context.Background(), "base-req"))
+	db, store := newTestStoreWithOptions(t, WithBaseContext(base))
+	seedIdentity(t, store, newTestIdentity().withIdk("opt-base").build())
+
+	var seen string
+	err := db.Callback().Query().Before("gorm:query").Register("test:base_ctx", func(tx *gorm.DB) {
+		seen, _ = CorrelationIDFromContext(tx.Statement.Context)
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	if _, err := store.FindIdentity("opt-base"); err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if seen != "base-req" {
+		t.Errorf("FindIdentity did not use the base context: correlation ID %q", seen)
+	}
+
+	cancel()
+	if _, err := store.FindIdentity("opt-base"); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindIdentity after cancel: expected context.Canceled, got %v", err)
+	}
+	if err := store.SaveIdentity(newTestIdentity().withIdk("opt-base-2").build()); !errors.Is(err, context.Canceled) {
+		t.Errorf("SaveIdentity after cancel: expected context.Canceled, got %v", err)
+	}
+	if _, err := store.FindIdentityWithContext(context.Background(), "opt-base"); err != nil {
+		t.Errorf("FindIdentityWithContext should ignore the base context: %v", err)
+	}
+}
+
+// TestWithValidationDisabled verifies a confirmed store accepts legacy idks
+// end to end, still rejects empty keys and oversized fields, and that a
+// wrong confirmation leaves validation on.
+func TestWithValidationDisabled(t *testing.T) {
+	const legacy = "legacy idk:with#chars"
+	if ValidateIdk(legacy) == nil {
+		t.Fatal("test idk must fail ValidateIdk")
+	}
+
+	_, store := newTestStoreWithOptions(t, WithValidationDisabled(ConfirmValidationDisabled))
+	if err := store.SaveIdentity(newTestIdentity().withIdk(legacy).build()); err != nil {
+		t.Fatalf("SaveIdentity: %v", err)
+	}
+	got, err := store.FindIdentity(legacy)
+	if err != nil || got.Idk != legacy {
+		t.Fatalf("FindIdentity = %v, %v", got, err)
+	}
+	if err := store.DeleteIdentity(legacy); err != nil {
+		t.Errorf("DeleteIdentity: %v", err)
+	}
+	if _, err := store.FindIdentity(""); !errors.Is(err, ErrEmptyIdentityKey) {
+		t.Errorf("empty idk: expected ErrEmptyIdentityKey, got %v", err)
+	}
+	err = store.SaveIdentity(newTestIdentity().withIdk(legacy).withSuk(strings.Repeat("s", MaxFieldLength+1)).build())
+	if !errors.Is(err, ErrFieldTooLong) {
+		t.Errorf("oversized field: expected ErrFieldTooLong, got %v", err)
+	}
+
+	_, unconfirmed := newTestStoreWithOptions(t, WithValidationDisabled("yes"))
+	if err := unconfirmed.SaveIdentity(newTestIdentity().withIdk(legacy).build()); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("unconfirmed: expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+}
+
+// TestWithTableName verifies every operation and the migration use the
+// configured table and leave the default one untouched.
+func TestWithTableName(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithTableName("custom_identities"))
+	ctx := context.Background()
+
+	if store.TableName() != "custom_identities" {
+		t.Fatalf("TableName() = %q", store.TableName())
+	}
+	if !db.Migrator().HasTable("custom_identities") || db.Migrator().HasTable("sqrl_identities") {
+		t.Fatal("migration did not create only the custom table")
+	}
+
+	seedIdentity(t, store, newTestIdentity().withIdk("tbl-a").withPidk("tbl-prev").build())
+	if err := store.SaveIdentities([]*ssp.SqrlIdentity{newTestIdentity().withIdk("tbl-b").build()}); err != nil {
+		t.Fatalf("SaveIdentities: %v", err)
+	}
+	if _, err := store.SaveAndReload(ctx, newTestIdentity().withIdk("tbl-c").build()); err != nil {
+		t.Fatalf("SaveAndReload: %v", err)
+	}
+	if _, err := store.FindIdentityByPidk("tbl-prev"); err != nil {
+		t.Errorf("FindIdentityByPidk: %v", err)
+	}
+	if ok, err := store.ExistsIdentity("tbl-b"); err != nil || !ok {
+		t.Errorf("ExistsIdentity = %v, %v", ok, err)
+	}
+	if _, err := store.ClaimAndDisable(ctx, "tbl-b"); err != nil {
+		t.Errorf("ClaimAndDisable: %v", err)
+	}
+	if err := store.RenameIdentity(ctx, "tbl-c", "tbl-d"); err != nil {
+		t.Errorf("RenameIdentity: %v", err)
+	}
+	if err := store.DeleteIdentity("tbl-a"); err != nil {
+		t.Errorf("DeleteIdentity: %v", err)
+	}
+	list, err := store.ListIdentities(0, 10)
+	if err != nil || fmtKeys(idks(list)) != "[tbl-b tbl-d]" {
+		t.Errorf("ListIdentities = %v, %v; want [tbl-b tbl-d]", idks(list), err)
+	}
+
+	var rows int64
+	if err := db.Table("custom_identities").Count(&rows).Error; err != nil || rows != 2 {
+		t.Errorf("custom table has %d rows (%v), want 2", rows, err)
+	}
+	if err := store.VerifySchema(ctx); err != nil {
+		t.Errorf("VerifySchema: %v", err)
+	}
+}
+
+// TestWithMaxIdkLength verifies the store applies the configured key limit
+// while ValidateIdk keeps the default.
+func TestWithMaxIdkLength(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithMaxIdkLength(8))
+
+	if err := store.SaveIdentity(newTestIdentity().withIdk("eight888").build()); err != nil {
+		t.Errorf("at limit: %v", err)
+	}
+	if _, err := store.FindIdentity("nine99999"); !errors.Is(err, ErrIdentityKeyTooLong) {
+		t.Errorf("over limit: expected ErrIdentityKeyTooLong, got %v", err)
+	}
+	if err := ValidateIdk("nine99999"); err != nil {
+		t.Errorf("ValidateIdk should keep MaxIdkLength, got %v", err)
+	}
+}
+
+// TestWithValidator verifies a custom validator replaces the built-in rules
+// on every method, and that DefaultValidator lets it extend them instead.
+func TestWithValidator(t *testing.T) {
+	errPrefix := errors.New("idk must start with app:")
+	var seen []string
+	_, store := newTestStoreWithOptions(t, WithValidator(func(idk string) error {
+		seen = append(seen, idk)
+		if !strings.HasPrefix(idk, "app:") {
+			return errPrefix
+		}
+		return nil
+	}))
+
+	// ':' is rejected by the built-in rules but accepted here.
+	if err := store.SaveIdentity(newTestIdentity().withIdk("app:ok").build()); err != nil {
+		t.Errorf("accepted key: %v", err)
+	}
+	if _, err := store.FindIdentity("app:ok"); err != nil {
+		t.Errorf("FindIdentity: %v", err)
+	}
+	if err := store.DeleteIdentity("other"); !errors.Is(err, errPrefix) {
+		t.Errorf("rejected key: expected validator error, got %v", err)
+	}
+	if _, err := store.FindIdentity(""); !errors.Is(err, ErrEmptyIdentityKey) {
+		t.Errorf("empty key: expected ErrEmptyIdentityKey, got %v", err)
+	}
+	if fmtKeys(seen) != "[app:ok app:ok other]" {
+		t.Errorf("validator saw %v, want [app:ok app:ok other]", seen)
+	}
+
+	_, wrapped := newTestStoreWithOptions(t, WithValidator(func(idk string) error {
+		if err := DefaultValidator(idk); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(idk, "app-") {
+			return errPrefix
+		}
+		return nil
+	}))
+	if _, err := wrapped.FindIdentity("app:ok"); !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Errorf("wrapped default: expected ErrInvalidIdentityKeyFormat, got %v", err)
+	}
+	if _, err := wrapped.FindIdentity("other"); !errors.Is(err, errPrefix) {
+		t.Errorf("wrapped extra rule: expected validator error, got %v", err)
+	}
+}
+
+// TestWithLogger verifies store diagnostics go to the configured logger.
+func TestWithLogger(t *testing.T) {
+	var buf strings.Builder
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	NewAuthStore(nil, WithLogger(logger), WithValidationDisabled(ConfirmValidationDisabled))
+	if !strings.Contains(buf.String(), "level=WARN") || !strings.Contains(buf.String(), "DISABLED") {
+		t.Errorf("expected a validation warning, got %q", buf.String())
+	}
+
+	buf.Reset()
+	NewAuthStore(nil, WithValidationDisabled("no"), WithLogger(logger))
+	if !strings.Contains(buf.String(), "ignored") {
+		t.Errorf("expected an ignored-confirmation warning regardless of option order, got %q", buf.String())
+	}
+
+	buf.Reset()
+	NewAuthStore(nil, WithLogger(logger))
+	if buf.Len() != 0 {
+		t.Errorf("default store logged %q", buf.String())
+	}
+}
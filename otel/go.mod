@@ -0,0 +1,17 @@
+// The OpenTelemetry adapter is its own module so that the store itself does
+// not depend on the OpenTelemetry API.
+module github.com/dxcSithLord/server-go-ssp-gormauthstore/otel
+
+go 1.25.0
+
+require (
+	github.com/dxcSithLord/server-go-ssp v0.0.0-20260202110616-66529f78b7f1
+	github.com/dxcSithLord/server-go-ssp-gormauthstore v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.38.0
+	go.opentelemetry.io/otel/metric v1.38.0
+	go.opentelemetry.io/otel/sdk v1.38.0
+	go.opentelemetry.io/otel/sdk/metric v1.38.0
+	go.opentelemetry.io/otel/trace v1.38.0
+)
+
+replace github.com/dxcSithLord/server-go-ssp-gormauthstore => ../
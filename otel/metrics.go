@@ -0,0 +1,60 @@
+package otel
+
+import (
+	"context"
+	"time"
+
+	gormauthstore "github.com/dxcSithLord/server-go-ssp-gormauthstore"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// OutcomeKey is the metric attribute of an operation's outcome: success,
+// not_found or error, as returned by gormauthstore.Outcome.
+const OutcomeKey = attribute.Key("gormauthstore.outcome")
+
+// Collector is a gormauthstore.Collector recording the same two metrics as
+// the prometheus adapter with OpenTelemetry instruments, both carrying the
+// operation as OperationKey:
+//
+//   - gormauthstore.operations, a counter also carrying OutcomeKey.
+//   - gormauthstore.operation.duration, a latency histogram in seconds.
+//
+// Pass it to the store with gormauthstore.WithMetrics.
+type Collector struct {
+	ops      metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+var _ gormauthstore.Collector = (*Collector)(nil)
+
+// NewCollector returns a Collector recording through mp, or the global
+// provider if mp is nil. An error means an instrument could not be
+// created.
+func NewCollector(mp metric.MeterProvider) (*Collector, error) {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(ScopeName)
+	ops, err := meter.Int64Counter("gormauthstore.operations",
+		metric.WithDescription("Identity store operations by operation and outcome."),
+		metric.WithUnit("{operation}"))
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram("gormauthstore.operation.duration",
+		metric.WithDescription("Latency of identity store operations."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	return &Collector{ops: ops, duration: duration}, nil
+}
+
+// ObserveOp implements gormauthstore.Collector.
+func (c *Collector) ObserveOp(op string, dur time.Duration, err error) {
+	ctx := context.Background()
+	c.ops.Add(ctx, 1, metric.WithAttributes(OperationKey.String(op), OutcomeKey.String(gormauthstore.Outcome(err))))
+	c.duration.Record(ctx, dur.Seconds(), metric.WithAttributes(OperationKey.String(op)))
+}
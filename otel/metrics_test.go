@@ -0,0 +1,77 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	gormauthstore "github.com/dxcSithLord/server-go-ssp-gormauthstore"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// TestCollector verifies operations are counted by outcome and timed.
+func TestCollector(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	c, err := NewCollector(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatalf("NewCollector failed: %v", err)
+	}
+
+	c.ObserveOp("FindIdentity", time.Millisecond, nil)
+	c.ObserveOp("FindIdentity", time.Millisecond, fmt.Errorf("lookup: %w", ssp.ErrNotFound))
+	c.ObserveOp("SaveIdentity", time.Second, errors.New("connection refused"))
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("scopes: got %d, want 1", len(rm.ScopeMetrics))
+	}
+	metrics := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m.Data
+	}
+
+	ops, ok := metrics["gormauthstore.operations"].(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("gormauthstore.operations: got %T, want a Sum[int64]", metrics["gormauthstore.operations"])
+	}
+	counts := map[[2]string]int64{}
+	for _, dp := range ops.DataPoints {
+		op, _ := dp.Attributes.Value(OperationKey)
+		outcome, _ := dp.Attributes.Value(OutcomeKey)
+		counts[[2]string{op.AsString(), outcome.AsString()}] = dp.Value
+	}
+	want := map[[2]string]int64{
+		{"FindIdentity", gormauthstore.OutcomeSuccess}:  1,
+		{"FindIdentity", gormauthstore.OutcomeNotFound}: 1,
+		{"SaveIdentity", gormauthstore.OutcomeError}:    1,
+	}
+	if len(counts) != len(want) {
+		t.Errorf("operations: got %v, want %v", counts, want)
+	}
+	for labels, n := range want {
+		if counts[labels] != n {
+			t.Errorf("operations%v: got %d, want %d", labels, counts[labels], n)
+		}
+	}
+
+	duration, ok := metrics["gormauthstore.operation.duration"].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("gormauthstore.operation.duration: got %T, want a Histogram[float64]", metrics["gormauthstore.operation.duration"])
+	}
+	series := map[attribute.Distinct]uint64{}
+	for _, dp := range duration.DataPoints {
+		series[dp.Attributes.Equivalent()] = dp.Count
+	}
+	find := attribute.NewSet(OperationKey.String("FindIdentity"))
+	if len(series) != 2 || series[find.Equivalent()] != 2 {
+		t.Errorf("duration series: got %v, want 2 with FindIdentity counted twice", series)
+	}
+}
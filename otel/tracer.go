@@ -0,0 +1,97 @@
+// Package otel traces gormauthstore operations and records their metrics
+// with OpenTelemetry. Pass the options to the store:
+//
+//	metrics, err := otel.NewCollector(nil)
+//	if err != nil {
+//		return err
+//	}
+//	store := gormauthstore.NewAuthStore(db,
+//		otel.WithTracerProvider(nil), gormauthstore.WithMetrics(metrics))
+//
+// Each operation runs in a span named "gormauthstore.<Op>", such as
+// "gormauthstore.FindIdentity". Spans never carry the identity key or the
+// identity's keys; lookups record only whether the identity was found. A
+// correlation ID set with gormauthstore.ContextWithCorrelationID is
+// recorded as CorrelationIDKey.
+//
+// It is a separate module, so applications that do not use OpenTelemetry
+// do not depend on it.
+package otel
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	gormauthstore "github.com/dxcSithLord/server-go-ssp-gormauthstore"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the tracer.
+const ScopeName = "github.com/dxcSithLord/server-go-ssp-gormauthstore"
+
+// Span attribute keys.
+const (
+	// OperationKey is the store operation, such as "FindIdentity".
+	OperationKey = attribute.Key("gormauthstore.operation")
+	// FoundKey is set on lookups: whether the identity was found.
+	FoundKey = attribute.Key("gormauthstore.found")
+	// CorrelationIDKey is the correlation ID of the operation's context,
+	// omitted when it has none.
+	CorrelationIDKey = attribute.Key("gormauthstore.correlation_id")
+)
+
+// Tracer is a gormauthstore.Tracer that starts OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ gormauthstore.Tracer = (*Tracer)(nil)
+
+// NewTracer returns a Tracer using tp, or the global provider if tp is nil.
+// The provider is resolved on each span when global, so one installed
+// after the store is built is still used.
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		return &Tracer{}
+	}
+	return &Tracer{tracer: tp.Tracer(ScopeName)}
+}
+
+// WithTracerProvider returns the store option that traces every operation
+// with tp, or the global provider if tp is nil.
+func WithTracerProvider(tp trace.TracerProvider) gormauthstore.Option {
+	return gormauthstore.WithTracer(NewTracer(tp))
+}
+
+// Start begins the span of op. The returned function sets the span's status
+// to Error on a failure, described by its gormauthstore.ErrorClass rather
+// than its text, which may quote a key; ssp.ErrNotFound is an expected
+// outcome, recorded only as found=false on lookups.
+func (t *Tracer) Start(ctx context.Context, op string) (context.Context, func(err error)) {
+	tracer := t.tracer
+	if tracer == nil {
+		tracer = otel.GetTracerProvider().Tracer(ScopeName)
+	}
+	attrs := []attribute.KeyValue{OperationKey.String(op)}
+	if id, ok := gormauthstore.CorrelationIDFromContext(ctx); ok {
+		attrs = append(attrs, CorrelationIDKey.String(id))
+	}
+	ctx, span := tracer.Start(ctx, "gormauthstore."+op,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		defer span.End()
+		notFound := errors.Is(err, ssp.ErrNotFound)
+		if strings.HasPrefix(op, "Find") && (err == nil || notFound) {
+			span.SetAttributes(FoundKey.Bool(err == nil))
+		}
+		if err != nil && !notFound {
+			span.SetStatus(codes.Error, gormauthstore.ErrorClass(err))
+		}
+	}
+}
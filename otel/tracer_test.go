@@ -0,0 +1,109 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	gormauthstore "github.com/dxcSithLord/server-go-ssp-gormauthstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestTracer verifies spans are named after the operation, record lookup
+// outcomes as found, treat only real failures as errors, described by their
+// class, and carry no other attributes or events.
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	for _, call := range []struct {
+		op  string
+		err error
+	}{
+		{"FindIdentity", nil},
+		{"FindIdentity", fmt.Errorf("lookup: %w", ssp.ErrNotFound)},
+		{"SaveIdentity", fmt.Errorf("%w: Duplicate entry 'k1'", gormauthstore.ErrDuplicateIdentity)},
+	} {
+		_, end := tracer.Start(context.Background(), call.op)
+		end(call.err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("ended spans: got %d, want 3", len(spans))
+	}
+	for i, want := range []struct {
+		name   string
+		status sdktrace.Status
+		attrs  []attribute.KeyValue
+	}{
+		{"gormauthstore.FindIdentity", sdktrace.Status{}, []attribute.KeyValue{OperationKey.String("FindIdentity"), FoundKey.Bool(true)}},
+		{"gormauthstore.FindIdentity", sdktrace.Status{}, []attribute.KeyValue{OperationKey.String("FindIdentity"), FoundKey.Bool(false)}},
+		{"gormauthstore.SaveIdentity", sdktrace.Status{Code: codes.Error, Description: gormauthstore.ErrDuplicateIdentity.Error()},
+			[]attribute.KeyValue{OperationKey.String("SaveIdentity")}},
+	} {
+		span := spans[i]
+		if span.Name() != want.name || span.Status() != want.status || len(span.Events()) != 0 {
+			t.Errorf("span %d: got %s %v %v, want %s %v", i, span.Name(), span.Status(), span.Events(), want.name, want.status)
+		}
+		got := attribute.NewSet(span.Attributes()...)
+		if wantSet := attribute.NewSet(want.attrs...); !got.Equals(&wantSet) {
+			t.Errorf("span %d attributes: got %v, want %v", i, span.Attributes(), want.attrs)
+		}
+	}
+}
+
+// TestTracer_ChildSpan verifies the operation's span is a child of the
+// caller's and is the one in the returned context.
+func TestTracer_ChildSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+
+	opCtx, end := NewTracer(provider).Start(ctx, "ExistsIdentity")
+	end(nil)
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended spans: got %d, want 2", len(spans))
+	}
+	op := spans[0]
+	if op.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("parent: got %v, want %v", op.Parent().SpanID(), parent.SpanContext().SpanID())
+	}
+	if got := trace.SpanContextFromContext(opCtx).SpanID(); got != op.SpanContext().SpanID() {
+		t.Errorf("returned context carries span %v, want %v", got, op.SpanContext().SpanID())
+	}
+}
+
+// TestTracer_CorrelationID verifies a span carries the correlation ID of
+// its context, and no such attribute when there is none.
+func TestTracer_CorrelationID(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, end := tracer.Start(gormauthstore.ContextWithCorrelationID(context.Background(), "req-42"), "SaveIdentity")
+	end(nil)
+	_, end = tracer.Start(context.Background(), "SaveIdentity")
+	end(nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended spans: got %d, want 2", len(spans))
+	}
+	for i, want := range [][]attribute.KeyValue{
+		{OperationKey.String("SaveIdentity"), CorrelationIDKey.String("req-42")},
+		{OperationKey.String("SaveIdentity")},
+	} {
+		got := attribute.NewSet(spans[i].Attributes()...)
+		if wantSet := attribute.NewSet(want...); !got.Equals(&wantSet) {
+			t.Errorf("span %d attributes: got %v, want %v", i, spans[i].Attributes(), want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Package prometheus exports gormauthstore operation metrics to Prometheus.
+// Register a Collector and pass it to the store with WithMetrics:
+//
+//	metrics := prometheus.New("myapp")
+//	registry.MustRegister(metrics)
+//	store := gormauthstore.NewAuthStore(db, gormauthstore.WithMetrics(metrics))
+//
+// It is a separate module, so applications that do not use Prometheus do
+// not depend on its client.
+package prometheus
+
+import (
+	"time"
+
+	gormauthstore "github.com/dxcSithLord/server-go-ssp-gormauthstore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Outcome label values.
+const (
+	OutcomeSuccess  = gormauthstore.OutcomeSuccess
+	OutcomeNotFound = gormauthstore.OutcomeNotFound
+	OutcomeError    = gormauthstore.OutcomeError
+)
+
+// Collector records store operations as two metrics, both labelled with the
+// operation name, such as "FindIdentity":
+//
+//   - <namespace>_authstore_operations_total, a counter also labelled with
+//     the outcome: success, not_found or error.
+//   - <namespace>_authstore_operation_duration_seconds, a latency histogram.
+type Collector struct {
+	ops      *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+var (
+	_ gormauthstore.Collector = (*Collector)(nil)
+	_ prometheus.Collector    = (*Collector)(nil)
+)
+
+// New returns a Collector whose metric names start with namespace, which
+// may be empty. It must be registered with a prometheus.Registerer to be
+// exported.
+func New(namespace string) *Collector {
+	return &Collector{
+		ops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "authstore",
+			Name:      "operations_total",
+			Help:      "Identity store operations by operation and outcome.",
+		}, []string{"op", "outcome"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "authstore",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of identity store operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"op"}),
+	}
+}
+
+// ObserveOp implements gormauthstore.Collector.
+func (c *Collector) ObserveOp(op string, dur time.Duration, err error) {
+	c.ops.WithLabelValues(op, Outcome(err)).Inc()
+	c.duration.WithLabelValues(op).Observe(dur.Seconds())
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.ops.Describe(ch)
+	c.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.ops.Collect(ch)
+	c.duration.Collect(ch)
+}
+
+// Outcome returns the outcome label for an operation that returned err; see
+// gormauthstore.Outcome.
+func Outcome(err error) string {
+	return gormauthstore.Outcome(err)
+}
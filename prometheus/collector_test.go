@@ -0,0 +1,41 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestCollector verifies operations are counted by outcome and timed, and
+// that the collector registers cleanly.
+func TestCollector(t *testing.T) {
+	c := New("test")
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	c.ObserveOp("FindIdentity", time.Millisecond, nil)
+	c.ObserveOp("FindIdentity", time.Millisecond, fmt.Errorf("lookup: %w", ssp.ErrNotFound))
+	c.ObserveOp("SaveIdentity", time.Second, errors.New("connection refused"))
+
+	counts := map[[2]string]float64{
+		{"FindIdentity", OutcomeSuccess}:  1,
+		{"FindIdentity", OutcomeNotFound}: 1,
+		{"SaveIdentity", OutcomeError}:    1,
+		{"SaveIdentity", OutcomeSuccess}:  0,
+	}
+	for labels, want := range counts {
+		if got := testutil.ToFloat64(c.ops.WithLabelValues(labels[0], labels[1])); got != want {
+			t.Errorf("operations_total%v: got %v, want %v", labels, got, want)
+		}
+	}
+	if n := testutil.CollectAndCount(c, "test_authstore_operation_duration_seconds"); n != 2 {
+		t.Errorf("duration series: got %d, want 2", n)
+	}
+}
@@ -0,0 +1,13 @@
+// The Prometheus adapter is its own module so that the store itself does not
+// depend on the Prometheus client.
+module github.com/dxcSithLord/server-go-ssp-gormauthstore/prometheus
+
+go 1.25.0
+
+require (
+	github.com/dxcSithLord/server-go-ssp v0.0.0-20260202110616-66529f78b7f1
+	github.com/dxcSithLord/server-go-ssp-gormauthstore v0.0.0-00010101000000-000000000000
+	github.com/prometheus/client_golang v1.23.2
+)
+
+replace github.com/dxcSithLord/server-go-ssp-gormauthstore => ../
@@ -0,0 +1,41 @@
+package gormauthstore
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// maxRetryShift bounds the exponent of the WithRetry backoff, so the delay
+// cannot overflow however many attempts are allowed.
+const maxRetryShift = 16
+
+// retryDelay returns the wait before the attempt after attempt, for a
+// WithRetry base delay of base: a random delay between half and all of
+// base<<(attempt-1).
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base << min(attempt-1, maxRetryShift)
+	return d/2 + rand.N(d/2+1)
+}
+
+// waitRetry waits d before a retry and reports whether to make it: false if
+// ctx is done first or its deadline would pass before d elapses.
+func waitRetry(ctx context.Context, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,201 @@
+package gormauthstore
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// failQueries makes the next n queries on db fail with driver.ErrBadConn, as
+// a dropped connection would, and returns the number of queries attempted.
+func failQueries(t *testing.T, db *gorm.DB, n int64) *atomic.Int64 {
+	t.Helper()
+	var attempts atomic.Int64
+	err := db.Callback().Query().Before("gorm:query").Register("test:flaky", func(tx *gorm.DB) {
+		if attempts.Add(1) <= n {
+			tx.AddError(driver.ErrBadConn)
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	return &attempts
+}
+
+// failAfterCommit makes the next n inserts and updates on db report
+// driver.ErrBadConn once they have committed, as a connection dropped before
+// the reply would, and returns the number of writes attempted.
+func failAfterCommit(t *testing.T, db *gorm.DB, n int64) *atomic.Int64 {
+	t.Helper()
+	var attempts atomic.Int64
+	fail := func(tx *gorm.DB) {
+		if attempts.Add(1) <= n {
+			tx.AddError(driver.ErrBadConn)
+		}
+	}
+	err := errors.Join(
+		db.Callback().Create().After("gorm:commit_or_rollback_transaction").Register("test:lost-reply", fail),
+		db.Callback().Update().After("gorm:commit_or_rollback_transaction").Register("test:lost-reply", fail),
+	)
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	return &attempts
+}
+
+// TestWithRetry_RecoversFromTransientFailures verifies an operation that
+// fails twice with a dropped connection succeeds on the third attempt.
+func TestWithRetry_RecoversFromTransientFailures(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithRetry(3, time.Millisecond))
+	identity := newTestIdentity().withIdk("retry-1").build()
+	seedIdentity(t, store, identity)
+	attempts := failQueries(t, db, 2)
+
+	found, err := store.FindIdentity("retry-1")
+	if err != nil {
+		t.Fatalf("FindIdentity failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("FindIdentity: got %+v, want %+v", *found, *identity)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("attempts: got %d, want 3", n)
+	}
+}
+
+// TestWithRetry_GivesUp verifies retrying stops after maxAttempts, for
+// outcomes that are not transient, without the option, inside a
+// transaction and when the context ends.
+func TestWithRetry_GivesUp(t *testing.T) {
+	t.Run("exhausted", func(t *testing.T) {
+		db, store := newTestStoreWithOptions(t, WithRetry(3, time.Millisecond))
+		attempts := failQueries(t, db, 10)
+		if _, err := store.FindIdentity("retry-none"); !errors.Is(err, ErrTransient) {
+			t.Errorf("expected ErrTransient, got %v", err)
+		}
+		if n := attempts.Load(); n != 3 {
+			t.Errorf("attempts: got %d, want 3", n)
+		}
+	})
+	t.Run("not found", func(t *testing.T) {
+		db, store := newTestStoreWithOptions(t, WithRetry(3, time.Millisecond))
+		attempts := failQueries(t, db, 0)
+		if _, err := store.FindIdentity("retry-none"); !errors.Is(err, ssp.ErrNotFound) {
+			t.Errorf("expected ssp.ErrNotFound, got %v", err)
+		}
+		if n := attempts.Load(); n != 1 {
+			t.Errorf("attempts: got %d, want 1", n)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		db, store := newTestStoreWithOptions(t)
+		attempts := failQueries(t, db, 10)
+		if _, err := store.FindIdentity("retry-none"); !errors.Is(err, ErrTransient) {
+			t.Errorf("expected ErrTransient, got %v", err)
+		}
+		if n := attempts.Load(); n != 1 {
+			t.Errorf("attempts: got %d, want 1", n)
+		}
+	})
+	t.Run("transaction", func(t *testing.T) {
+		db, store := newTestStoreWithOptions(t, WithRetry(3, time.Millisecond))
+		attempts := failQueries(t, db, 10)
+		err := store.Transaction(func(tx *AuthStore) error {
+			_, err := tx.FindIdentity("retry-none")
+			return err
+		})
+		if !errors.Is(err, ErrTransient) {
+			t.Errorf("expected ErrTransient, got %v", err)
+		}
+		if n := attempts.Load(); n != 1 {
+			t.Errorf("attempts: got %d, want 1", n)
+		}
+	})
+	t.Run("deadline", func(t *testing.T) {
+		db, store := newTestStoreWithOptions(t, WithRetry(10, time.Hour))
+		attempts := failQueries(t, db, 10)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		start := time.Now()
+		if _, err := store.FindIdentityWithContext(ctx, "retry-none"); !errors.Is(err, ErrTransient) {
+			t.Errorf("expected ErrTransient, got %v", err)
+		}
+		if n := attempts.Load(); n != 1 || time.Since(start) > time.Second {
+			t.Errorf("waited past the deadline: %d attempts in %v", n, time.Since(start))
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		db, store := newTestStoreWithOptions(t, WithRetry(10, time.Hour))
+		attempts := failQueries(t, db, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if _, err := store.FindIdentityWithContext(ctx, "retry-none"); !errors.Is(err, ErrTransient) {
+			t.Errorf("expected ErrTransient, got %v", err)
+		}
+		if n := attempts.Load(); n != 1 {
+			t.Errorf("attempts: got %d, want 1", n)
+		}
+	})
+}
+
+// TestRetryDelay verifies the backoff doubles per attempt within its jitter.
+func TestRetryDelay(t *testing.T) {
+	base := 10 * time.Millisecond
+	for attempt := 1; attempt <= 4; attempt++ {
+		full := base << (attempt - 1)
+		for range 100 {
+			if d := retryDelay(base, attempt); d < full/2 || d > full {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v]", attempt, d, full/2, full)
+			}
+		}
+	}
+	if d := retryDelay(0, 3); d != 0 {
+		t.Errorf("zero base: got %v", d)
+	}
+	if d := retryDelay(time.Second, 1000); d <= 0 {
+		t.Errorf("large attempt overflowed: got %v", d)
+	}
+}
+
+// TestWithRetry_SkipsNonIdempotentWrites verifies a write that cannot be
+// applied twice is not retried when its reply is lost after it committed.
+func TestWithRetry_SkipsNonIdempotentWrites(t *testing.T) {
+	t.Run("IncrementBtn", func(t *testing.T) {
+		db, store := newTestStoreWithOptions(t, WithRetry(3, time.Millisecond))
+		seedIdentity(t, store, newTestIdentity().withIdk("retry-btn").withBtn(1).build())
+		attempts := failAfterCommit(t, db, 1)
+		if _, err := store.IncrementBtn("retry-btn", 1); !errors.Is(err, ErrTransient) {
+			t.Errorf("expected ErrTransient, got %v", err)
+		}
+		if n := attempts.Load(); n != 1 {
+			t.Errorf("attempts: got %d, want 1", n)
+		}
+		found, err := store.FindIdentity("retry-btn")
+		if err != nil {
+			t.Fatalf("FindIdentity failed: %v", err)
+		}
+		if found.Btn != 2 {
+			t.Errorf("btn: got %d, want 2", found.Btn)
+		}
+	})
+	t.Run("SaveIdentityInsertOnly", func(t *testing.T) {
+		db, store := newTestStoreWithOptions(t, WithRetry(3, time.Millisecond))
+		attempts := failAfterCommit(t, db, 1)
+		identity := newTestIdentity().withIdk("retry-insert").build()
+		if err := store.SaveIdentityInsertOnly(context.Background(), identity); !errors.Is(err, ErrTransient) {
+			t.Errorf("expected ErrTransient, got %v", err)
+		}
+		if n := attempts.Load(); n != 1 {
+			t.Errorf("attempts: got %d, want 1", n)
+		}
+		if _, err := store.FindIdentity("retry-insert"); err != nil {
+			t.Errorf("FindIdentity failed: %v", err)
+		}
+	})
+}
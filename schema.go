@@ -0,0 +1,206 @@
+package gormauthstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CurrentSchemaVersion is the version of the sqrl_identities schema this
+// release of the store creates and expects: the version of the last entry in
+// migrations.
+const CurrentSchemaVersion = 6
+
+// schemaMigration records one applied schema version in schema_migrations.
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName returns the table name for recorded schema versions.
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrationsTable returns the table recording the schema versions of the
+// store's identity table: schema_migrations for sqrl_identities, and
+// <table>_schema_migrations for a WithTableName table, so stores sharing a
+// database migrate their tables independently.
+func (as *AuthStore) migrationsTable() string {
+	if table := as.TableName(); table != (identityRecord{}).TableName() {
+		return table + "_" + (schemaMigration{}).TableName()
+	}
+	return (schemaMigration{}).TableName()
+}
+
+// SchemaVersion returns the schema version this store is configured for.
+func (as *AuthStore) SchemaVersion() int {
+	return CurrentSchemaVersion
+}
+
+// RecordedSchemaVersion returns the highest schema version recorded for the
+// store's identity table, or 0 if none has been recorded yet.
+func (as *AuthStore) RecordedSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := as.run(ctx, opRead, func(db *gorm.DB) error {
+		table := as.migrationsTable()
+		if !db.Migrator().HasTable(table) {
+			return nil
+		}
+		return db.Table(table).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	})
+	return version, err
+}
+
+// VerifySchema checks that the database records the schema version this
+// store expects. It returns an error wrapping ErrSchemaVersionMismatch when
+// the database is unmigrated, behind or ahead, so a service can refuse to
+// start against the wrong schema.
+func (as *AuthStore) VerifySchema(ctx context.Context) error {
+	recorded, err := as.RecordedSchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if recorded != as.SchemaVersion() {
+		return fmt.Errorf("%w: database at version %d, store expects %d",
+			ErrSchemaVersionMismatch, recorded, as.SchemaVersion())
+	}
+	return nil
+}
+
+// Migration is one ordered, versioned schema change. Up runs inside a
+// transaction together with recording Version in the migrations table, so a
+// failed migration leaves neither its changes nor its record behind (on
+// databases with transactional DDL; MySQL commits DDL implicitly). tx is
+// scoped to the store's identity table (see WithTableName), so migrations of
+// that table must not name it.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *gorm.DB) error
+}
+
+// migrations is the ordered schema history. Versions start at 1, increase by
+// one, and the last one equals CurrentSchemaVersion. Never edit an entry once
+// released; append a new one instead.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create sqrl_identities",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&identityRecord{})
+		},
+	},
+	{
+		Version:     2,
+		Description: "add mac integrity column",
+		Up: func(tx *gorm.DB) error {
+			// Version 1 creates the table from the current model, which
+			// already has the column on a fresh database.
+			if tx.Migrator().HasColumn(&identityRecord{}, "mac") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&identityRecord{}, "Mac")
+		},
+	},
+	{
+		Version:     3,
+		Description: "add version column",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&identityRecord{}, "version") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&identityRecord{}, "Version")
+		},
+	},
+	{
+		Version:     4,
+		Description: "add created_at and updated_at columns",
+		Up: func(tx *gorm.DB) error {
+			for _, field := range []string{"CreatedAt", "UpdatedAt"} {
+				if tx.Migrator().HasColumn(&identityRecord{}, field) {
+					continue
+				}
+				if err := tx.Migrator().AddColumn(&identityRecord{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     5,
+		Description: "add deleted_at soft-delete column",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&identityRecord{}, "deleted_at") {
+				if err := tx.Migrator().AddColumn(&identityRecord{}, "DeletedAt"); err != nil {
+					return err
+				}
+			}
+			if tx.Migrator().HasIndex(&identityRecord{}, "DeletedAt") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&identityRecord{}, "DeletedAt")
+		},
+	},
+	{
+		Version:     6,
+		Description: "make key columns case-sensitive on MySQL",
+		Up: func(tx *gorm.DB) error {
+			// MySQL's default collations compare case-insensitively, so
+			// keys differing only in case would share a row, and GORM
+			// sizes the string primary key VARCHAR(191), below
+			// MaxIdkLength. Other databases compare bytes already.
+			if tx.Dialector.Name() != "mysql" {
+				return nil
+			}
+			return tx.Exec(fmt.Sprintf("ALTER TABLE ? "+
+				"MODIFY idk VARCHAR(%d) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL, "+
+				"MODIFY pidk LONGTEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_bin, "+
+				"MODIFY rekeyed LONGTEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_bin", MaxIdkLength),
+				clause.Table{Name: clause.CurrentTable}).Error
+		},
+	},
+}
+
+// Migrate applies, in order, every migration not yet recorded for the
+// store's identity table in its migrations table: schema_migrations, or
+// <table>_schema_migrations under WithTableName. Each runs in its own
+// transaction, so an interrupted run resumes at the first unapplied
+// version. Failures are returned as a MigrationError naming the version.
+func (as *AuthStore) Migrate(ctx context.Context) (err error) {
+	ctx, done := as.observe(ctx, "Migrate", "", &err)
+	defer done()
+	return as.run(ctx, opWrite, func(db *gorm.DB) error {
+		table := as.migrationsTable()
+		if err := db.Table(table).AutoMigrate(&schemaMigration{}); err != nil {
+			return MigrationError{Err: err}
+		}
+		var applied []int
+		if err := db.Table(table).Pluck("version", &applied).Error; err != nil {
+			return MigrationError{Err: err}
+		}
+		done := make(map[int]bool, len(applied))
+		for _, v := range applied {
+			done[v] = true
+		}
+		for _, m := range migrations {
+			if done[m.Version] {
+				continue
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := m.Up(as.allIdentities(tx)); err != nil {
+					return err
+				}
+				return tx.Table(table).Create(&schemaMigration{Version: m.Version, AppliedAt: time.Now().UTC()}).Error
+			})
+			if err != nil {
+				return MigrationError{Version: m.Version, Description: m.Description, Err: err}
+			}
+		}
+		return nil
+	})
+}
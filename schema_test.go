@@ -0,0 +1,362 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// TestAutoMigrate_RecordsSchemaVersion verifies AutoMigrate records the
+// current schema version and repeated runs do not duplicate it.
+func TestAutoMigrate_RecordsSchemaVersion(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("second AutoMigrate failed: %v", err)
+	}
+
+	version, err := store.RecordedSchemaVersion(context.Background())
+	if err != nil {
+		t.Fatalf("RecordedSchemaVersion failed: %v", err)
+	}
+	if version != CurrentSchemaVersion || store.SchemaVersion() != CurrentSchemaVersion {
+		t.Errorf("recorded %d, store %d, want %d", version, store.SchemaVersion(), CurrentSchemaVersion)
+	}
+
+	var rows int64
+	if err := db.Model(&schemaMigration{}).Count(&rows).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if rows != int64(len(migrations)) {
+		t.Errorf("schema_migrations rows: got %d, want %d", rows, len(migrations))
+	}
+}
+
+// TestMigrate_StoresShareDatabase verifies stores with different
+// WithTableName tables in one database each migrate and record their own
+// table.
+func TestMigrate_StoresShareDatabase(t *testing.T) {
+	db, first := newTestStoreWithOptions(t)
+	second := NewAuthStore(db, WithTableName("tenant_identities"))
+	if err := second.AutoMigrate(); err != nil {
+		t.Fatalf("second store AutoMigrate: %v", err)
+	}
+	if !db.Migrator().HasTable("tenant_identities") || !db.Migrator().HasTable("tenant_identities_schema_migrations") {
+		t.Fatal("second store's tables were not created")
+	}
+
+	for _, store := range []*AuthStore{first, second} {
+		if err := store.VerifySchema(context.Background()); err != nil {
+			t.Errorf("%s: VerifySchema: %v", store.TableName(), err)
+		}
+		seedIdentity(t, store, newTestIdentity().withIdk("shared-"+store.TableName()).build())
+	}
+	if _, err := first.FindIdentity("shared-tenant_identities"); err == nil {
+		t.Error("first store sees the second store's identity")
+	}
+	var rows int64
+	if err := db.Model(&schemaMigration{}).Count(&rows).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if rows != int64(len(migrations)) {
+		t.Errorf("schema_migrations rows: got %d, want %d", rows, len(migrations))
+	}
+}
+
+// TestVerifySchema verifies VerifySchema accepts a migrated database and
+// rejects an unmigrated or newer one.
+func TestVerifySchema(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	if err := store.VerifySchema(context.Background()); err != nil {
+		t.Fatalf("VerifySchema on migrated database: %v", err)
+	}
+
+	if err := db.Create(&schemaMigration{Version: CurrentSchemaVersion + 1}).Error; err != nil {
+		t.Fatalf("record newer version: %v", err)
+	}
+	if err := store.VerifySchema(context.Background()); !errors.Is(err, ErrSchemaVersionMismatch) {
+		t.Errorf("newer database: expected ErrSchemaVersionMismatch, got %v", err)
+	}
+
+	if err := db.Migrator().DropTable(&schemaMigration{}); err != nil {
+		t.Fatalf("drop schema_migrations: %v", err)
+	}
+	version, err := store.RecordedSchemaVersion(context.Background())
+	if err != nil || version != 0 {
+		t.Errorf("unmigrated database: got version %d err %v, want 0 nil", version, err)
+	}
+	if err := store.VerifySchema(context.Background()); !errors.Is(err, ErrSchemaVersionMismatch) {
+		t.Errorf("unmigrated database: expected ErrSchemaVersionMismatch, got %v", err)
+	}
+}
+
+// TestMigrations_Ordered verifies the migration list is contiguous from 1 and
+// ends at CurrentSchemaVersion.
+func TestMigrations_Ordered(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migrations[%d].Version = %d, want %d", i, m.Version, i+1)
+		}
+		if m.Up == nil || m.Description == "" {
+			t.Errorf("migration %d is missing Up or Description", m.Version)
+		}
+	}
+	if last := migrations[len(migrations)-1].Version; last != CurrentSchemaVersion {
+		t.Errorf("last migration %d, CurrentSchemaVersion %d", last, CurrentSchemaVersion)
+	}
+}
+
+// TestMigrate_AppliesOnlyPending verifies Migrate runs unapplied versions in
+// order and skips recorded ones.
+func TestMigrate_AppliesOnlyPending(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+
+	var ran []int
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = append(append([]Migration(nil), saved...),
+		Migration{Version: len(saved) + 1, Description: "test a", Up: func(*gorm.DB) error {
+			ran = append(ran, len(saved)+1)
+			return nil
+		}},
+		Migration{Version: len(saved) + 2, Description: "test b", Up: func(*gorm.DB) error {
+			ran = append(ran, len(saved)+2)
+			return nil
+		}},
+	)
+
+	for i := 0; i < 2; i++ {
+		if err := store.Migrate(context.Background()); err != nil {
+			t.Fatalf("Migrate run %d failed: %v", i+1, err)
+		}
+	}
+	if len(ran) != 2 || ran[0] != len(saved)+1 || ran[1] != len(saved)+2 {
+		t.Errorf("applied %v, want [%d %d] once each", ran, len(saved)+1, len(saved)+2)
+	}
+
+	var rows int64
+	if err := db.Model(&schemaMigration{}).Count(&rows).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if rows != int64(len(migrations)) {
+		t.Errorf("schema_migrations rows: got %d, want %d", rows, len(migrations))
+	}
+}
+
+// TestMigrate_FailureRollsBack verifies a failing migration is not recorded,
+// its changes are rolled back and the error names the migration.
+func TestMigrate_FailureRollsBack(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+
+	boom := errors.New("boom")
+	next := CurrentSchemaVersion + 1
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = append(append([]Migration(nil), saved...), Migration{
+		Version:     next,
+		Description: "failing",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("CREATE TABLE migrate_probe (id INTEGER)").Error; err != nil {
+				return err
+			}
+			return boom
+		},
+	})
+
+	err := store.Migrate(context.Background())
+	var migrationErr MigrationError
+	if !errors.As(err, &migrationErr) || migrationErr.Version != next || !errors.Is(err, boom) {
+		t.Fatalf("expected MigrationError for v%d wrapping boom, got %v", next, err)
+	}
+	if !strings.Contains(err.Error(), "failing") {
+		t.Errorf("error does not name the migration: %v", err)
+	}
+	if db.Migrator().HasTable("migrate_probe") {
+		t.Error("failed migration's changes were not rolled back")
+	}
+	version, err := store.RecordedSchemaVersion(context.Background())
+	if err != nil || version != CurrentSchemaVersion {
+		t.Errorf("recorded version %d (err %v), want %d", version, err, CurrentSchemaVersion)
+	}
+}
+
+// TestMigrate_AddsMacColumn verifies migration 2 adds the mac column to a
+// table created before it existed.
+func TestMigrate_AddsMacColumn(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	if err := db.Migrator().DropColumn(&identityRecord{}, "mac"); err != nil {
+		t.Fatalf("drop column: %v", err)
+	}
+	if err := db.Where("version = ?", 2).Delete(&schemaMigration{}).Error; err != nil {
+		t.Fatalf("delete version: %v", err)
+	}
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if !db.Migrator().HasColumn(&identityRecord{}, "mac") {
+		t.Error("mac column not added")
+	}
+	if err := store.VerifySchema(context.Background()); err != nil {
+		t.Errorf("VerifySchema failed: %v", err)
+	}
+}
+
+// TestMigrate_AddsVersionColumn verifies migration 3 adds the version
+// column, zero for existing rows, to a table created before it existed.
+func TestMigrate_AddsVersionColumn(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("mig-version").build())
+	if err := db.Migrator().DropColumn(&identityRecord{}, "version"); err != nil {
+		t.Fatalf("drop column: %v", err)
+	}
+	if err := db.Where("version = ?", 3).Delete(&schemaMigration{}).Error; err != nil {
+		t.Fatalf("delete version: %v", err)
+	}
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if v := storedVersion(t, db, "mig-version"); v != 0 {
+		t.Errorf("existing row version: got %d, want 0", v)
+	}
+	if err := store.VerifySchema(context.Background()); err != nil {
+		t.Errorf("VerifySchema failed: %v", err)
+	}
+}
+
+// TestMigrate_AddsTimestampColumns verifies migration 4 adds created_at and
+// updated_at, and that rows predating them read with zero timestamps.
+func TestMigrate_AddsTimestampColumns(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("mig-time").build())
+	for _, column := range timestampColumns {
+		if err := db.Migrator().DropColumn(&identityRecord{}, column); err != nil {
+			t.Fatalf("drop column %s: %v", column, err)
+		}
+	}
+	if err := db.Where("version = ?", 4).Delete(&schemaMigration{}).Error; err != nil {
+		t.Fatalf("delete version: %v", err)
+	}
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	_, meta, err := store.FindIdentityWithMetadata(context.Background(), "mig-time")
+	if err != nil {
+		t.Fatalf("FindIdentityWithMetadata failed: %v", err)
+	}
+	if !meta.CreatedAt.IsZero() || !meta.UpdatedAt.IsZero() {
+		t.Errorf("existing row: got %+v, want zero timestamps", meta)
+	}
+	if err := store.VerifySchema(context.Background()); err != nil {
+		t.Errorf("VerifySchema failed: %v", err)
+	}
+}
+
+// TestMigrate_AddsDeletedAtColumn verifies migration 5 adds the indexed
+// deleted_at column, leaving existing rows live.
+func TestMigrate_AddsDeletedAtColumn(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithSoftDelete())
+	seedIdentity(t, store, newTestIdentity().withIdk("mig-deleted").build())
+	if err := db.Migrator().DropIndex(&identityRecord{}, "DeletedAt"); err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+	if err := db.Migrator().DropColumn(&identityRecord{}, "deleted_at"); err != nil {
+		t.Fatalf("drop column: %v", err)
+	}
+	if err := db.Where("version = ?", 5).Delete(&schemaMigration{}).Error; err != nil {
+		t.Fatalf("delete version: %v", err)
+	}
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if !db.Migrator().HasIndex(&identityRecord{}, "DeletedAt") {
+		t.Error("deleted_at index not created")
+	}
+	if _, err := store.FindIdentity("mig-deleted"); err != nil {
+		t.Errorf("existing row: FindIdentity failed: %v", err)
+	}
+}
+
+// TestMigrationError_Format verifies the message for versioned and
+// bookkeeping failures.
+func TestMigrationError_Format(t *testing.T) {
+	cause := errors.New("no such table")
+	tests := []struct {
+		err  MigrationError
+		want string
+	}{
+		{MigrationError{Version: 3, Description: "add mac", Err: cause}, "migration v3 (add mac) failed: no such table"},
+		{MigrationError{Err: cause}, "migration auto failed: no such table"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+		if !errors.Is(tt.err, cause) {
+			t.Errorf("%q does not unwrap to its cause", tt.want)
+		}
+	}
+}
+
+// TestAutoMigrate_ReturnsMigrationError verifies AutoMigrate surfaces a
+// bookkeeping failure as a MigrationError.
+func TestAutoMigrate_ReturnsMigrationError(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	broken := errors.New("read failed")
+	err := db.Callback().Query().Before("gorm:query").Register("test:fail_pluck", func(tx *gorm.DB) {
+		if tx.Statement.Table == "schema_migrations" {
+			_ = tx.AddError(broken)
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	err = store.AutoMigrate()
+	var migrationErr MigrationError
+	if !errors.As(err, &migrationErr) || migrationErr.Version != 0 || !errors.Is(err, broken) {
+		t.Errorf("expected bookkeeping MigrationError, got %v", err)
+	}
+}
+
+// mysqlDialector reports itself as MySQL, so dialect-specific migrations
+// can be built, in a DryRun session, without a MySQL server.
+type mysqlDialector struct {
+	gorm.Dialector
+}
+
+func (mysqlDialector) Name() string { return "mysql" }
+
+// TestMigrate_CaseSensitiveKeysOnMySQL verifies migration 6 gives the key
+// columns a binary collation and MaxIdkLength on MySQL only.
+func TestMigrate_CaseSensitiveKeysOnMySQL(t *testing.T) {
+	up := migrations[5].Up
+	for dialect, want := range map[string]string{"sqlite": "", "mysql": "ALTER TABLE `sqrl_identities` MODIFY idk VARCHAR(256)"} {
+		db := openTestDB(t)
+		if dialect == "mysql" {
+			db = db.Session(&gorm.Session{DryRun: true})
+			db.Dialector = mysqlDialector{db.Dialector}
+		}
+		var executed string
+		err := db.Callback().Raw().Before("gorm:raw").Register("test:capture", func(tx *gorm.DB) {
+			executed = tx.Statement.SQL.String()
+		})
+		if err != nil {
+			t.Fatalf("register callback: %v", err)
+		}
+		if err := up(db.Table("sqrl_identities")); err != nil {
+			t.Fatalf("%s: migration failed: %v", dialect, err)
+		}
+		if !strings.HasPrefix(executed, want) || (want == "") != (executed == "") {
+			t.Errorf("%s: executed %q, want prefix %q", dialect, executed, want)
+		}
+		if want != "" && strings.Count(executed, "utf8mb4_bin") != 3 {
+			t.Errorf("%s: executed %q, want three binary collations", dialect, executed)
+		}
+	}
+}
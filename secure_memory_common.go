@@ -1,7 +1,15 @@
 package gormauthstore
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"runtime"
+	"strings"
+	"sync"
+	"unicode/utf8"
 
 	ssp "github.com/dxcSithLord/server-go-ssp"
 )
@@ -41,6 +49,11 @@ func ScrambleBytes(b []byte) {
 // 1. Clearing the string reference (prevents further access via this variable)
 // 2. Wiping a copy of the data (reduces copies in memory)
 // 3. Allowing GC to reclaim the original string memory.
+//
+// No unsafe string/slice header manipulation is involved, so literals and
+// heap strings are handled identically. A recover guard ensures that any
+// failure while wiping the copy degrades to clearing the reference rather
+// than propagating a panic into the caller's cleanup path.
 func WipeString(s *string) {
 	if s == nil {
 		return
@@ -49,6 +62,13 @@ func WipeString(s *string) {
 		return
 	}
 
+	defer func() {
+		_ = recover()
+		// Clear the string reference
+		// The original backing memory will be garbage collected
+		*s = ""
+	}()
+
 	// Copy string contents to a mutable byte slice
 	// This is safe because we're creating a new allocation
 	dataCopy := []byte(*s)
@@ -56,14 +76,38 @@ func WipeString(s *string) {
 	// Wipe the copy to reduce sensitive data copies in memory
 	WipeBytes(dataCopy)
 
-	// Clear the string reference
-	// The original backing memory will be garbage collected
-	*s = ""
-
 	// Ensure the wiped copy isn't optimised away
 	runtime.KeepAlive(dataCopy)
 }
 
+// ScrambleString is the randomising companion to WipeString. It overwrites a
+// copy of the string's contents with cryptographically random bytes, rather
+// than zeros, and then clears the reference.
+//
+// The same limitations as WipeString apply: the original backing memory is
+// never modified in place, so string literals and other read-only data are
+// safe to pass. It is a no-op for nil pointers and empty strings.
+func ScrambleString(s *string) {
+	if s == nil {
+		return
+	}
+	if *s == "" {
+		return
+	}
+
+	defer func() {
+		_ = recover()
+		*s = ""
+	}()
+
+	dataCopy := []byte(*s)
+	if _, err := rand.Read(dataCopy); err != nil {
+		ScrambleBytes(dataCopy)
+	}
+
+	runtime.KeepAlive(dataCopy)
+}
+
 // ClearIdentity securely wipes all sensitive fields from a SqrlIdentity struct.
 // This function should be called when an identity is no longer needed to minimise
 // the window of exposure for cryptographic keys in memory.
@@ -102,6 +146,30 @@ func ClearIdentity(identity *ssp.SqrlIdentity) {
 	runtime.KeepAlive(identity)
 }
 
+// CloneIdentity returns a deep copy of src, or nil for a nil src. Every
+// string field is copied into new memory, so the clone shares nothing with
+// src and survives ClearIdentity on it. Use it to hand an identity to
+// another layer, or to keep one, before wiping the original:
+//
+//	kept := CloneIdentity(identity)
+//	ClearIdentity(identity)
+func CloneIdentity(src *ssp.SqrlIdentity) *ssp.SqrlIdentity {
+	if src == nil {
+		return nil
+	}
+	return &ssp.SqrlIdentity{
+		Idk:      strings.Clone(src.Idk),
+		Suk:      strings.Clone(src.Suk),
+		Vuk:      strings.Clone(src.Vuk),
+		Pidk:     strings.Clone(src.Pidk),
+		SQRLOnly: src.SQRLOnly,
+		Hardlock: src.Hardlock,
+		Disabled: src.Disabled,
+		Rekeyed:  strings.Clone(src.Rekeyed),
+		Btn:      src.Btn,
+	}
+}
+
 // SecureIdentityWrapper provides RAII-style automatic cleanup for SqrlIdentity.
 // The wrapper ensures that sensitive cryptographic material is wiped from memory
 // when the identity is no longer needed.
@@ -112,23 +180,32 @@ func ClearIdentity(identity *ssp.SqrlIdentity) {
 //	if err != nil { ... }
 //	defer wrapper.Destroy()
 //	// Access via wrapper.Identity
+//
+// Destroy, IsValid and GetIdentity are safe for concurrent use, so a handler
+// and a deferred cleanup may race on one wrapper. Reading the Identity field
+// directly is not synchronized; use GetIdentity when another goroutine may
+// call Destroy. A wrapper must not be copied after first use.
 type SecureIdentityWrapper struct {
 	Identity *ssp.SqrlIdentity
-	wiped    bool
+
+	mu    sync.Mutex
+	wiped bool
 }
 
 // NewSecureIdentityWrapper creates a new wrapper around an existing identity.
 func NewSecureIdentityWrapper(identity *ssp.SqrlIdentity) *SecureIdentityWrapper {
-	return &SecureIdentityWrapper{
-		Identity: identity,
-		wiped:    false,
-	}
+	return &SecureIdentityWrapper{Identity: identity}
 }
 
 // Destroy securely wipes the identity and marks the wrapper as invalid.
 // This method is idempotent - calling it multiple times is safe.
 func (w *SecureIdentityWrapper) Destroy() {
-	if w == nil || w.wiped {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wiped {
 		return
 	}
 
@@ -141,18 +218,53 @@ func (w *SecureIdentityWrapper) Destroy() {
 
 // IsValid returns true if the wrapper still contains a valid identity.
 func (w *SecureIdentityWrapper) IsValid() bool {
-	return w != nil && !w.wiped && w.Identity != nil
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !w.wiped && w.Identity != nil
 }
 
 // GetIdentity returns the wrapped identity if valid, otherwise returns nil.
 // This is a safer alternative to directly accessing the Identity field.
+// Once any Destroy has returned, it returns nil.
 func (w *SecureIdentityWrapper) GetIdentity() *ssp.SqrlIdentity {
-	if !w.IsValid() {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wiped {
 		return nil
 	}
 	return w.Identity
 }
 
+// Wipe is an alias for Destroy, kept for code written against the earlier
+// Identity/Wipe/IsWiped wrapper API. That API's Identity accessor is the
+// exported Identity field.
+//
+// Deprecated: Use Destroy. Wipe will be removed in the next release.
+func (w *SecureIdentityWrapper) Wipe() {
+	w.Destroy()
+}
+
+// IsWiped reports whether the wrapper no longer holds a valid identity. It is
+// the negation of IsValid.
+//
+// Deprecated: Use !IsValid(). IsWiped will be removed in the next release.
+func (w *SecureIdentityWrapper) IsWiped() bool {
+	return !w.IsValid()
+}
+
+// DefaultValidator is the identity key check a store applies when no
+// WithValidator is given: ValidateIdk. Custom validators can call it to
+// extend the built-in rules instead of restating them.
+func DefaultValidator(idk string) error {
+	return ValidateIdk(idk)
+}
+
 // ValidateIdk performs basic validation on an Identity Key.
 // Returns an error if the Idk is empty, too long, or contains invalid characters.
 //
@@ -160,18 +272,32 @@ func (w *SecureIdentityWrapper) GetIdentity() *ssp.SqrlIdentity {
 // - Cannot be empty
 // - Maximum length: 256 characters (reasonable upper bound)
 // - Should contain only URL-safe characters (alphanumeric, +, /, =, -, _, .)
+//
+// Accepted keys are ASCII and so already in Unicode NFC: decomposed
+// sequences and combining marks are rejected as invalid characters, so a
+// key has exactly one stored form.
 func ValidateIdk(idk string) error {
+	return validateIdk(idk, MaxIdkLength)
+}
+
+// validateIdk is ValidateIdk with an explicit length limit. A limit other
+// than MaxIdkLength is named in the error.
+func validateIdk(idk string, maxIdkLength int) error {
 	if idk == "" {
 		return ErrEmptyIdentityKey
 	}
 
-	if len(idk) > MaxIdkLength {
+	if len(idk) > maxIdkLength {
+		if maxIdkLength != MaxIdkLength {
+			return fmt.Errorf("%w of %d bytes", ErrIdentityKeyTooLong, maxIdkLength)
+		}
 		return ErrIdentityKeyTooLong
 	}
 
-	// Basic character validation for URL-safe base64-like strings
-	for _, c := range idk {
-		if !isValidIdkChar(c) {
+	// Every valid character is ASCII, so a byte scan is exact: any byte of a
+	// multi-byte UTF-8 sequence is >= 0x80 and rejected by the table.
+	for i := 0; i < len(idk); i++ {
+		if !idkCharTable[idk[i]] {
 			return ErrInvalidIdentityKeyFormat
 		}
 	}
@@ -179,17 +305,191 @@ func ValidateIdk(idk string) error {
 	return nil
 }
 
+// EqualIdk reports whether two identity keys are equal without leaking, via
+// timing, how many leading bytes match. Both keys are first hashed with
+// SHA-256 to fixed-length digests, which are compared with
+// subtle.ConstantTimeCompare, so keys of different lengths are not rejected
+// early either. Hashing cost still grows with the keys' lengths, so timing
+// can reveal length (public for SQRL keys), but never content.
+func EqualIdk(a, b string) bool {
+	da := sha256.Sum256([]byte(a))
+	db := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(da[:], db[:]) == 1
+}
+
+// ValidateIdentity performs the checks SaveIdentity applies before
+// persisting an identity: it must be non-nil, carry a valid Idk, and its
+// Suk, Vuk, Pidk and Rekeyed must each be at most MaxFieldLength bytes.
+func ValidateIdentity(identity *ssp.SqrlIdentity) error {
+	return validateIdentity(identity, MaxFieldLength)
+}
+
+// validateIdentity is ValidateIdentity with an explicit field length limit.
+// An oversized field yields ErrFieldTooLong wrapped with the field name,
+// never its value.
+func validateIdentity(identity *ssp.SqrlIdentity, maxFieldLength int) error {
+	if identity == nil {
+		return ErrNilIdentity
+	}
+	if err := ValidateIdk(identity.Idk); err != nil {
+		return err
+	}
+	return validateFieldLengths(identity, maxFieldLength)
+}
+
+// validateFieldLengths checks Suk, Vuk, Pidk and Rekeyed against
+// maxFieldLength, naming the first oversized field in the error.
+func validateFieldLengths(identity *ssp.SqrlIdentity, maxFieldLength int) error {
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"suk", identity.Suk},
+		{"vuk", identity.Vuk},
+		{"pidk", identity.Pidk},
+		{"rekeyed", identity.Rekeyed},
+	} {
+		if len(field.value) > maxFieldLength {
+			return fmt.Errorf("%w: %s exceeds %d bytes", ErrFieldTooLong, field.name, maxFieldLength)
+		}
+	}
+	return nil
+}
+
+// ValidateIdentities validates a slice of identities without touching the
+// database, for pre-flight checks before a bulk import. The result maps each
+// failing input index to its first validation error; valid entries are
+// absent, so an empty map means the whole slice is valid.
+func ValidateIdentities(identities []*ssp.SqrlIdentity) map[int]error {
+	failures := make(map[int]error)
+	for i, identity := range identities {
+		if err := ValidateIdentity(identity); err != nil {
+			failures[i] = err
+		}
+	}
+	return failures
+}
+
+// IdkValidationDetail describes why an Identity Key was rejected. It never
+// holds the key itself, so it is safe to surface in API error messages.
+type IdkValidationDetail struct {
+	// Length is the byte length of the rejected key.
+	Length int
+
+	// Index is the byte offset of the first invalid character, or -1 when
+	// the key was rejected for its length rather than its content.
+	Index int
+
+	// Rune is the first invalid character. Only meaningful when Index >= 0.
+	Rune rune
+}
+
+// String formats the detail without echoing the key.
+func (d *IdkValidationDetail) String() string {
+	if d.Index < 0 {
+		return fmt.Sprintf("identity key length %d", d.Length)
+	}
+	return fmt.Sprintf("invalid character %U at byte %d", d.Rune, d.Index)
+}
+
+// ValidateIdkDetailed applies the same rules as ValidateIdk and additionally
+// reports where validation failed. On ErrInvalidIdentityKeyFormat the detail
+// carries the byte index and rune of the first invalid character. Returns a
+// nil detail and nil error for a valid key.
+//
+// ValidateIdk remains the gate used internally by the store; this variant is
+// intended for building client-facing error messages.
+func ValidateIdkDetailed(idk string) (*IdkValidationDetail, error) {
+	detail := &IdkValidationDetail{Length: len(idk), Index: -1}
+
+	if idk == "" {
+		return detail, ErrEmptyIdentityKey
+	}
+
+	if len(idk) > MaxIdkLength {
+		return detail, ErrIdentityKeyTooLong
+	}
+
+	for i, c := range idk {
+		if !isValidIdkChar(c) {
+			detail.Index = i
+			detail.Rune = c
+			return detail, ErrInvalidIdentityKeyFormat
+		}
+	}
+
+	return nil, nil
+}
+
+// maxVerboseInvalidChars bounds the invalid characters ValidateIdkVerbose
+// reports individually, so an oversized hostile key cannot make it build an
+// unbounded error.
+const maxVerboseInvalidChars = 16
+
+// ValidateIdkVerbose applies the same rules as ValidateIdk but reports every
+// failing rule instead of the first, joined with errors.Join: the length
+// limit and each invalid character with its byte index and rune. Each
+// cause wraps its sentinel (ErrEmptyIdentityKey, ErrIdentityKeyTooLong,
+// ErrInvalidIdentityKeyFormat), so errors.Is matches any of them. Past
+// maxVerboseInvalidChars invalid characters the rest are summarised in one
+// error. Like ValidateIdkDetailed it never echoes the key.
+//
+// ValidateIdk remains the fast path; use this to tell a client everything
+// wrong with a key at once.
+func ValidateIdkVerbose(idk string) error {
+	if idk == "" {
+		return ErrEmptyIdentityKey
+	}
+	var errs []error
+	if len(idk) > MaxIdkLength {
+		errs = append(errs, fmt.Errorf("%w: %d bytes", ErrIdentityKeyTooLong, len(idk)))
+	}
+	invalid := 0
+	for i, c := range idk {
+		if isValidIdkChar(c) {
+			continue
+		}
+		invalid++
+		if invalid <= maxVerboseInvalidChars {
+			errs = append(errs, fmt.Errorf("%w: %U at byte %d", ErrInvalidIdentityKeyFormat, c, i))
+		}
+	}
+	if extra := invalid - maxVerboseInvalidChars; extra > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d more invalid characters", ErrInvalidIdentityKeyFormat, extra))
+	}
+	return errors.Join(errs...)
+}
+
+// idkCharTable marks the bytes valid in an Identity Key. Validation runs on
+// every store call, so a lookup replaces a chain of range comparisons.
+var idkCharTable = func() (table [256]bool) {
+	for c := 'a'; c <= 'z'; c++ {
+		table[c] = true
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		table[c] = true
+	}
+	for c := '0'; c <= '9'; c++ {
+		table[c] = true
+	}
+	for _, c := range "+/=-_." {
+		table[c] = true
+	}
+	return table
+}()
+
 // isValidIdkChar checks if a character is valid for an Identity Key.
 // Valid characters are alphanumeric plus common URL-safe characters: +, /, =, -, _, .
 func isValidIdkChar(c rune) bool {
-	return (c >= 'a' && c <= 'z') ||
-		(c >= 'A' && c <= 'Z') ||
-		(c >= '0' && c <= '9') ||
-		c == '+' || c == '/' || c == '=' || c == '-' || c == '_' || c == '.'
+	return c >= 0 && c < utf8.RuneSelf && idkCharTable[c]
 }
 
 // Constants for validation.
 const (
 	// MaxIdkLength is the maximum allowed length for an Identity Key.
 	MaxIdkLength = 256
+
+	// MaxFieldLength is the default maximum length of Suk, Vuk, Pidk and
+	// Rekeyed. See WithMaxFieldLength.
+	MaxFieldLength = 4096
 )
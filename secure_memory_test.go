@@ -3,8 +3,12 @@ package gormauthstore
 import (
 	"bytes"
 	"errors"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"unsafe"
 
 	ssp "github.com/dxcSithLord/server-go-ssp"
 )
@@ -72,6 +76,31 @@ func TestWipeBytes_NilSlice(t *testing.T) {
 	WipeBytes(nilSlice)
 }
 
+// TestWipeBytes_DeadStore verifies that zeroing is not elided when the wiped
+// slice is never read again, which is the dead store an optimizing compiler
+// would otherwise be free to drop. The backing array is observed separately.
+func TestWipeBytes_DeadStore(t *testing.T) {
+	backing := new([64]byte)
+	fillAndWipe(backing[8:56])
+
+	for i, b := range backing {
+		if b != 0 {
+			t.Fatalf("byte %d not wiped: got %#x", i, b)
+		}
+	}
+}
+
+// fillAndWipe writes secret-looking data into b and wipes it; b is dead
+// once the function returns.
+//
+//go:noinline
+func fillAndWipe(b []byte) {
+	for i := range b {
+		b[i] = 0xA5
+	}
+	WipeBytes(b)
+}
+
 func TestScrambleBytes(t *testing.T) {
 	original := []byte("sensitive data")
 	data := make([]byte, len(original))
@@ -158,6 +187,77 @@ func TestWipeString_EmptyString(t *testing.T) {
 	}
 }
 
+// TestWipeString_NoPanic verifies that WipeString never panics and always
+// clears the reference, whatever memory backs the string.
+func TestWipeString_NoPanic(t *testing.T) {
+	const literal = "literal-in-rodata"
+
+	tests := []struct {
+		name  string
+		value func() string
+	}{
+		{name: "heap string", value: func() string { return string([]byte("heap-allocated-secret")) }},
+		{name: "string literal", value: func() string { return literal }},
+		{name: "concatenated", value: func() string { return strings.Repeat("ab", 64) + literal }},
+		{name: "substring of literal", value: func() string { return literal[3:9] }},
+		{name: "empty string", value: func() string { return "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("WipeString panicked: %v", r)
+				}
+			}()
+
+			s := tt.value()
+			WipeString(&s)
+			if s != "" {
+				t.Errorf("string not cleared: got %q", s)
+			}
+		})
+	}
+
+	if literal != "literal-in-rodata" {
+		t.Error("wiping a copy must not modify the original literal")
+	}
+}
+
+func TestScrambleString(t *testing.T) {
+	const literal = "scramble-literal"
+
+	inputs := map[string]string{
+		"heap string":    string([]byte("scramble-heap-secret")),
+		"string literal": literal,
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			s := input
+			ScrambleString(&s)
+			if s != "" {
+				t.Errorf("string not cleared: got %q", s)
+			}
+		})
+	}
+
+	if literal != "scramble-literal" {
+		t.Error("scrambling a copy must not modify the original literal")
+	}
+}
+
+func TestScrambleString_NilAndEmpty(t *testing.T) {
+	// Should not panic
+	ScrambleString(nil)
+
+	s := ""
+	ScrambleString(&s)
+	if s != "" {
+		t.Errorf("empty string changed: %q", s)
+	}
+}
+
 func TestClearIdentity(t *testing.T) {
 	// Use heap-allocated strings (from byte slices) to avoid read-only memory issues
 	// In real usage, database reads return heap-allocated strings
@@ -209,6 +309,38 @@ func TestClearIdentity(t *testing.T) {
 	}
 }
 
+// TestCloneIdentity verifies the clone equals the source, shares no string
+// memory with it and survives ClearIdentity on it.
+func TestCloneIdentity(t *testing.T) {
+	src := &ssp.SqrlIdentity{
+		Idk:      string([]byte("clone_idk")),
+		Suk:      string([]byte("clone_suk")),
+		Vuk:      string([]byte("clone_vuk")),
+		Pidk:     string([]byte("clone_pidk")),
+		Rekeyed:  string([]byte("clone_rekeyed")),
+		SQRLOnly: true,
+		Hardlock: true,
+		Disabled: true,
+		Btn:      3,
+	}
+	want := *src
+
+	clone := CloneIdentity(src)
+	if clone == src || *clone != want {
+		t.Fatalf("got %+v, want a separate copy of %+v", clone, want)
+	}
+	if unsafe.StringData(clone.Suk) == unsafe.StringData(src.Suk) {
+		t.Error("clone shares Suk memory with the source")
+	}
+	ClearIdentity(src)
+	if *clone != want {
+		t.Errorf("ClearIdentity on the source changed the clone: got %+v, want %+v", *clone, want)
+	}
+	if CloneIdentity(nil) != nil {
+		t.Error("CloneIdentity(nil) is not nil")
+	}
+}
+
 func TestClearIdentity_NilIdentity(t *testing.T) {
 	// Should not panic
 	ClearIdentity(nil)
@@ -235,6 +367,40 @@ func TestClearIdentity_EmptyFields(t *testing.T) {
 	}
 }
 
+// TestClearIdentity_ResetsEveryField sets every exported ssp.SqrlIdentity
+// field and asserts ClearIdentity zeroes all of them. ClearIdentity has a
+// single definition shared by all build variants, so this untagged test
+// covers every platform, and a field added upstream fails it until
+// ClearIdentity handles it.
+func TestClearIdentity_ResetsEveryField(t *testing.T) {
+	identity := &ssp.SqrlIdentity{}
+	v := reflect.ValueOf(identity).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		switch fv := v.Field(i); fv.Kind() {
+		case reflect.String:
+			fv.SetString(string([]byte("clear-" + field.Name)))
+		case reflect.Bool:
+			fv.SetBool(true)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			fv.SetInt(int64(i + 1))
+		default:
+			t.Fatalf("field %s has kind %s; extend this test and ClearIdentity", field.Name, fv.Kind())
+		}
+	}
+
+	ClearIdentity(identity)
+
+	for i := 0; i < v.NumField(); i++ {
+		if field := v.Type().Field(i); field.IsExported() && !v.Field(i).IsZero() {
+			t.Errorf("%s not reset: %v", field.Name, v.Field(i).Interface())
+		}
+	}
+}
+
 func TestSecureIdentityWrapper_Basic(t *testing.T) {
 	identity := &ssp.SqrlIdentity{
 		Idk: string([]byte("test_idk")),
@@ -292,6 +458,37 @@ func TestSecureIdentityWrapper_NilWrapper(t *testing.T) {
 	}
 }
 
+// TestSecureIdentityWrapper_DeprecatedAliases verifies Wipe and IsWiped
+// behave exactly like Destroy and !IsValid.
+func TestSecureIdentityWrapper_DeprecatedAliases(t *testing.T) {
+	identity := &ssp.SqrlIdentity{
+		Idk: string([]byte("alias_idk")),
+		Suk: string([]byte("alias_suk")),
+	}
+
+	wrapper := NewSecureIdentityWrapper(identity)
+	if wrapper.IsWiped() != !wrapper.IsValid() {
+		t.Error("IsWiped should equal !IsValid before wipe")
+	}
+
+	wrapper.Wipe()
+
+	if !wrapper.IsWiped() || wrapper.IsValid() {
+		t.Error("wrapper should be wiped after Wipe")
+	}
+	if identity.Suk != "" || wrapper.Identity != nil {
+		t.Error("Wipe should clear the identity like Destroy")
+	}
+
+	// Idempotent and nil-safe like the canonical methods.
+	wrapper.Wipe()
+	var nilWrapper *SecureIdentityWrapper
+	nilWrapper.Wipe()
+	if !nilWrapper.IsWiped() {
+		t.Error("nil wrapper should report wiped")
+	}
+}
+
 func TestSecureIdentityWrapper_NilIdentity(t *testing.T) {
 	wrapper := NewSecureIdentityWrapper(nil)
 
@@ -303,6 +500,48 @@ func TestSecureIdentityWrapper_NilIdentity(t *testing.T) {
 	wrapper.Destroy()
 }
 
+// TestSecureIdentityWrapper_ConcurrentDestroy hammers one wrapper with
+// Destroy, IsValid and GetIdentity from many goroutines. Run under -race;
+// once any Destroy has returned, GetIdentity must return nil.
+func TestSecureIdentityWrapper_ConcurrentDestroy(t *testing.T) {
+	for round := 0; round < 50; round++ {
+		wrapper := NewSecureIdentityWrapper(&ssp.SqrlIdentity{
+			Idk: string([]byte("concurrent_idk")),
+			Suk: string([]byte("concurrent_suk")),
+		})
+
+		var (
+			wg        sync.WaitGroup
+			destroyed atomic.Bool
+		)
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 20; i++ {
+					switch (g + i) % 3 {
+					case 0:
+						wrapper.Destroy()
+						destroyed.Store(true)
+					case 1:
+						_ = wrapper.IsValid()
+					default:
+						after := destroyed.Load()
+						if id := wrapper.GetIdentity(); id != nil && after {
+							t.Errorf("GetIdentity returned %p after Destroy completed", id)
+						}
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		if wrapper.IsValid() || wrapper.GetIdentity() != nil {
+			t.Fatal("wrapper still valid after concurrent Destroy")
+		}
+	}
+}
+
 func TestValidateIdk_Valid(t *testing.T) {
 	validIdks := []string{
 		"abc123",
@@ -383,6 +622,227 @@ func TestValidateIdk_Invalid(t *testing.T) {
 	}
 }
 
+func TestValidateIdkDetailed_Valid(t *testing.T) {
+	detail, err := ValidateIdkDetailed("valid-idk_123")
+	if err != nil {
+		t.Fatalf("expected valid, got error: %v", err)
+	}
+	if detail != nil {
+		t.Errorf("expected nil detail for valid key, got %+v", detail)
+	}
+}
+
+func TestValidateIdkDetailed_InvalidCharacter(t *testing.T) {
+	tests := []struct {
+		name      string
+		idk       string
+		wantIndex int
+		wantRune  rune
+	}{
+		{name: "space", idk: "abc def", wantIndex: 3, wantRune: ' '},
+		{name: "first char", idk: "@abc", wantIndex: 0, wantRune: '@'},
+		{name: "multibyte", idk: "ab\u00e9cd", wantIndex: 2, wantRune: '\u00e9'},
+		{name: "leading multibyte", idk: "\u00e9", wantIndex: 0, wantRune: '\u00e9'},
+		{name: "newline", idk: "abc\n", wantIndex: 3, wantRune: '\n'},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detail, err := ValidateIdkDetailed(tt.idk)
+			if !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+				t.Fatalf("expected ErrInvalidIdentityKeyFormat, got %v", err)
+			}
+			if detail == nil {
+				t.Fatal("expected detail, got nil")
+			}
+			if detail.Index != tt.wantIndex {
+				t.Errorf("Index: got %d, want %d", detail.Index, tt.wantIndex)
+			}
+			if detail.Rune != tt.wantRune {
+				t.Errorf("Rune: got %U, want %U", detail.Rune, tt.wantRune)
+			}
+			if detail.Length != len(tt.idk) {
+				t.Errorf("Length: got %d, want %d", detail.Length, len(tt.idk))
+			}
+		})
+	}
+}
+
+func TestValidateIdkDetailed_LengthErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		idk         string
+		expectedErr error
+	}{
+		{name: "empty", idk: "", expectedErr: ErrEmptyIdentityKey},
+		{name: "too long", idk: strings.Repeat("a", MaxIdkLength+1), expectedErr: ErrIdentityKeyTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detail, err := ValidateIdkDetailed(tt.idk)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+			if detail == nil || detail.Index != -1 {
+				t.Errorf("expected detail with Index -1, got %+v", detail)
+			}
+		})
+	}
+}
+
+// TestValidateIdkVerbose verifies every failing rule is reported and each
+// cause matches its sentinel.
+func TestValidateIdkVerbose(t *testing.T) {
+	if err := ValidateIdkVerbose("valid-idk_123"); err != nil {
+		t.Errorf("valid key: got %v", err)
+	}
+	if err := ValidateIdkVerbose(""); !errors.Is(err, ErrEmptyIdentityKey) {
+		t.Errorf("empty key: expected ErrEmptyIdentityKey, got %v", err)
+	}
+
+	err := ValidateIdkVerbose(strings.Repeat("a", MaxIdkLength) + "b c\u00e9")
+	if !errors.Is(err, ErrIdentityKeyTooLong) || !errors.Is(err, ErrInvalidIdentityKeyFormat) {
+		t.Fatalf("expected both length and format causes, got %v", err)
+	}
+	causes := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(causes) != 3 {
+		t.Fatalf("causes: got %d, want 3: %v", len(causes), err)
+	}
+	for _, want := range []string{"U+0020 at byte 257", "U+00E9 at byte 259"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not report %q: %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "aaaa") {
+		t.Errorf("error echoes the key: %v", err)
+	}
+	if ValidateIdk("b c") != ErrInvalidIdentityKeyFormat {
+		t.Error("ValidateIdk must stay a single-error path")
+	}
+}
+
+// TestValidateIdkVerbose_BoundsInvalidCharacters verifies a key full of
+// invalid characters yields a bounded error.
+func TestValidateIdkVerbose_BoundsInvalidCharacters(t *testing.T) {
+	err := ValidateIdkVerbose(strings.Repeat("@", 100))
+	causes := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(causes) != maxVerboseInvalidChars+1 {
+		t.Fatalf("causes: got %d, want %d", len(causes), maxVerboseInvalidChars+1)
+	}
+	if !strings.Contains(err.Error(), "84 more invalid characters") {
+		t.Errorf("missing summary: %v", err)
+	}
+}
+
+func TestValidateIdkDetailed_StringDoesNotEchoKey(t *testing.T) {
+	idk := "secret-key-material with-space"
+	detail, err := ValidateIdkDetailed(idk)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	msg := detail.String()
+	if strings.Contains(msg, "secret-key-material") {
+		t.Errorf("detail string leaks key: %s", msg)
+	}
+	if !strings.Contains(msg, "U+0020") || !strings.Contains(msg, "19") {
+		t.Errorf("detail string missing rune or index: %s", msg)
+	}
+}
+
+// ValidateIdkDetailed must accept and reject exactly the same inputs as ValidateIdk.
+func TestValidateIdkDetailed_MatchesValidateIdk(t *testing.T) {
+	inputs := []string{"", "ok", "not ok", "idk@x", strings.Repeat("b", MaxIdkLength), strings.Repeat("b", MaxIdkLength+1)}
+	for _, idk := range inputs {
+		_, detailedErr := ValidateIdkDetailed(idk)
+		if err := ValidateIdk(idk); !errors.Is(detailedErr, err) {
+			t.Errorf("mismatch for %q: ValidateIdk=%v ValidateIdkDetailed=%v", idk, err, detailedErr)
+		}
+	}
+}
+
+func TestValidateIdentity(t *testing.T) {
+	if err := ValidateIdentity(nil); !errors.Is(err, ErrNilIdentity) {
+		t.Errorf("nil identity: expected ErrNilIdentity, got %v", err)
+	}
+	if err := ValidateIdentity(&ssp.SqrlIdentity{Idk: ""}); !errors.Is(err, ErrEmptyIdentityKey) {
+		t.Errorf("empty idk: expected ErrEmptyIdentityKey, got %v", err)
+	}
+	if err := ValidateIdentity(&ssp.SqrlIdentity{Idk: "valid-idk"}); err != nil {
+		t.Errorf("valid identity: expected nil, got %v", err)
+	}
+}
+
+// TestValidateIdentity_FieldLength verifies each secret-bearing field is
+// accepted at MaxFieldLength, rejected one byte beyond it, and that the error
+// names the field without echoing its value.
+func TestValidateIdentity_FieldLength(t *testing.T) {
+	fields := map[string]func(*ssp.SqrlIdentity, string){
+		"suk":     func(id *ssp.SqrlIdentity, v string) { id.Suk = v },
+		"vuk":     func(id *ssp.SqrlIdentity, v string) { id.Vuk = v },
+		"pidk":    func(id *ssp.SqrlIdentity, v string) { id.Pidk = v },
+		"rekeyed": func(id *ssp.SqrlIdentity, v string) { id.Rekeyed = v },
+	}
+	for name, set := range fields {
+		t.Run(name, func(t *testing.T) {
+			atLimit := &ssp.SqrlIdentity{Idk: "valid-idk"}
+			set(atLimit, strings.Repeat("a", MaxFieldLength))
+			if err := ValidateIdentity(atLimit); err != nil {
+				t.Errorf("at limit: expected nil, got %v", err)
+			}
+
+			overLimit := &ssp.SqrlIdentity{Idk: "valid-idk"}
+			set(overLimit, strings.Repeat("b", MaxFieldLength+1))
+			err := ValidateIdentity(overLimit)
+			if !errors.Is(err, ErrFieldTooLong) {
+				t.Fatalf("over limit: expected ErrFieldTooLong, got %v", err)
+			}
+			if !strings.Contains(err.Error(), name) || strings.Contains(err.Error(), "bbbb") {
+				t.Errorf("error should name %s without its value: %v", name, err)
+			}
+		})
+	}
+}
+
+func TestValidateIdentities(t *testing.T) {
+	identities := []*ssp.SqrlIdentity{
+		{Idk: "row-0-ok"},
+		nil,
+		{Idk: ""},
+		{Idk: "row-3-ok"},
+		{Idk: "row 4 bad"},
+		{Idk: strings.Repeat("x", MaxIdkLength+1)},
+	}
+
+	failures := ValidateIdentities(identities)
+
+	want := map[int]error{
+		1: ErrNilIdentity,
+		2: ErrEmptyIdentityKey,
+		4: ErrInvalidIdentityKeyFormat,
+		5: ErrIdentityKeyTooLong,
+	}
+	if len(failures) != len(want) {
+		t.Fatalf("expected %d failures, got %d: %v", len(want), len(failures), failures)
+	}
+	for idx, wantErr := range want {
+		if !errors.Is(failures[idx], wantErr) {
+			t.Errorf("index %d: expected %v, got %v", idx, wantErr, failures[idx])
+		}
+	}
+	for _, idx := range []int{0, 3} {
+		if err, ok := failures[idx]; ok {
+			t.Errorf("index %d should be valid, got %v", idx, err)
+		}
+	}
+}
+
+func TestValidateIdentities_Empty(t *testing.T) {
+	if failures := ValidateIdentities(nil); len(failures) != 0 {
+		t.Errorf("expected no failures for nil slice, got %v", failures)
+	}
+}
+
 func TestIsValidIdkChar(t *testing.T) {
 	validChars := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+/=-_."
 	invalidChars := " !@#$%^&*()[]{}|\\:;\"'<>,?\n\t\r"
@@ -435,6 +895,83 @@ func BenchmarkValidateIdk(b *testing.B) {
 	}
 }
 
+// isValidIdkCharChained is the original comparison-chain character check,
+// kept as the reference the lookup table must match.
+func isValidIdkCharChained(c rune) bool {
+	return (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') ||
+		c == '+' || c == '/' || c == '=' || c == '-' || c == '_' || c == '.'
+}
+
+// validateIdkRunes is the original per-rune ValidateIdk loop, kept as the
+// benchmark baseline and behavioural reference.
+func validateIdkRunes(idk string) error {
+	if idk == "" {
+		return ErrEmptyIdentityKey
+	}
+	if len(idk) > MaxIdkLength {
+		return ErrIdentityKeyTooLong
+	}
+	for _, c := range idk {
+		if !isValidIdkCharChained(c) {
+			return ErrInvalidIdentityKeyFormat
+		}
+	}
+	return nil
+}
+
+// TestIsValidIdkChar_MatchesReference verifies the lookup table accepts
+// exactly the characters the comparison chain did.
+func TestIsValidIdkChar_MatchesReference(t *testing.T) {
+	for c := rune(-1); c <= 0x10FFFF; c++ {
+		if isValidIdkChar(c) != isValidIdkCharChained(c) {
+			t.Fatalf("isValidIdkChar(%U) = %v, reference %v", c, isValidIdkChar(c), isValidIdkCharChained(c))
+		}
+	}
+}
+
+// TestValidateIdk_MatchesReference verifies the byte-scan fast path accepts
+// and rejects exactly what the per-rune loop did.
+func TestValidateIdk_MatchesReference(t *testing.T) {
+	inputs := []string{
+		"", "a", "k1vMZ8C9B2Q8h5K3x7N9m4P6w8R1t5Y2u9Z3v7C1d4E", "a+b/c=d-e_f.g",
+		"has space", "caf\u00e9", "\u00e9", "key\x00", "bad\xff", "\xc3", "ok\u4e16",
+		strings.Repeat("a", MaxIdkLength), strings.Repeat("a", MaxIdkLength+1),
+		strings.Repeat("\u00e9", MaxIdkLength/2), "tab\t", "emoji\U0001F600",
+	}
+	for c := 0; c < 256; c++ {
+		inputs = append(inputs, "x"+string([]byte{byte(c)})+"y", "x"+string(rune(c))+"y")
+	}
+	for _, idk := range inputs {
+		if got, want := ValidateIdk(idk), validateIdkRunes(idk); got != want {
+			t.Errorf("ValidateIdk(%q) = %v, reference %v", idk, got, want)
+		}
+	}
+}
+
+// BenchmarkValidateIdk_Realistic compares the byte-scan lookup against the
+// original per-rune loop on a 43-character base64url SQRL idk and on a
+// maximum-length key.
+func BenchmarkValidateIdk_Realistic(b *testing.B) {
+	keys := map[string]string{
+		"43":  "k1vMZ8C9B2Q8h5K3x7N9m4P6w8R1t5Y2u9Z3v7C1d4E",
+		"256": strings.Repeat("Zx9_-", MaxIdkLength/5) + "Zx9_-."[:MaxIdkLength%5],
+	}
+	for name, idk := range keys {
+		b.Run("table/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = ValidateIdk(idk)
+			}
+		})
+		b.Run("runes/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = validateIdkRunes(idk)
+			}
+		})
+	}
+}
+
 func BenchmarkSecureWrapper(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -447,3 +984,46 @@ func BenchmarkSecureWrapper(b *testing.B) {
 		wrapper.Destroy()
 	}
 }
+
+// TestEqualIdk verifies EqualIdk agrees with == across matching, prefix,
+// suffix and length differences.
+func TestEqualIdk(t *testing.T) {
+	const idk = "k1vMZ8C9B2Q8h5K3x7N9m4P6w8R1t5Y2u9Z3v7C1d4E"
+	tests := []struct {
+		a, b string
+	}{
+		{idk, idk},
+		{idk, "X" + idk[1:]},
+		{idk, idk[:len(idk)-1] + "X"},
+		{idk, idk[:len(idk)-1]},
+		{idk, idk + "A"},
+		{"", ""},
+		{"", idk},
+	}
+	for _, tt := range tests {
+		if got, want := EqualIdk(tt.a, tt.b), tt.a == tt.b; got != want {
+			t.Errorf("EqualIdk(%q, %q) = %v, want %v", tt.a, tt.b, got, want)
+		}
+	}
+}
+
+// BenchmarkEqualIdk compares timings for a full match and for mismatches at
+// the first and last byte; the three should be indistinguishable, unlike ==.
+func BenchmarkEqualIdk(b *testing.B) {
+	const idk = "k1vMZ8C9B2Q8h5K3x7N9m4P6w8R1t5Y2u9Z3v7C1d4E"
+	cases := []struct {
+		name  string
+		other string
+	}{
+		{"match", idk},
+		{"first-byte-differs", "X" + idk[1:]},
+		{"last-byte-differs", idk[:len(idk)-1] + "X"},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = EqualIdk(idk, c.other)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package gormauthstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// errSelfTestRollback aborts the self-test transaction once every step passed.
+var errSelfTestRollback = errors.New("self-test rollback")
+
+// SelfTest round-trips a synthetic identity through save, find and delete
+// against the real database, for deployment smoke tests. Everything runs in a
+// transaction that is always rolled back, so the check leaves no trace.
+// The returned error names the step that failed.
+func (as *AuthStore) SelfTest(ctx context.Context) (err error) {
+	ctx, done := as.observe(ctx, "SelfTest", "", &err)
+	defer done()
+	if err := as.usable(); err != nil {
+		return err
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("self-test: generate key: %w", err)
+	}
+	probe := &ssp.SqrlIdentity{
+		Idk:      "selftest-" + hex.EncodeToString(suffix),
+		Suk:      "selftest-suk",
+		Vuk:      "selftest-vuk",
+		SQRLOnly: true,
+		Btn:      1,
+	}
+
+	err = as.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txStore := as.WithTx(tx)
+		// Report once, as SelfTest, not once per step, and do not audit the
+		// probe's rolled-back writes.
+		txStore.cfg.errorObserver = nil
+		txStore.cfg.metrics = nil
+		txStore.cfg.tracer = nil
+		txStore.cfg.logger = nil
+
+		if err := txStore.SaveIdentityWithContext(ctx, probe); err != nil {
+			return fmt.Errorf("self-test save: %w", err)
+		}
+		found, err := txStore.FindIdentityWithContext(ctx, probe.Idk)
+		if err != nil {
+			return fmt.Errorf("self-test find: %w", err)
+		}
+		match := *found == *probe
+		ClearIdentity(found)
+		if !match {
+			return errors.New("self-test find: stored identity does not match")
+		}
+		if err := txStore.DeleteIdentityWithContext(ctx, probe.Idk); err != nil {
+			return fmt.Errorf("self-test delete: %w", err)
+		}
+		if _, err := txStore.FindIdentityWithContext(ctx, probe.Idk); !errors.Is(err, ssp.ErrNotFound) {
+			return fmt.Errorf("self-test verify delete: expected not found, got %v", err)
+		}
+		return errSelfTestRollback
+	})
+	if errors.Is(err, errSelfTestRollback) {
+		return nil
+	}
+	return err
+}
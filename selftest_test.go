@@ -0,0 +1,58 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// TestSelfTest_Passes verifies SelfTest succeeds and leaves no rows behind.
+func TestSelfTest_Passes(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+
+	if err := store.SelfTest(context.Background()); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+
+	var count int64
+	if err := db.Model(&identityRecord{}).Count(&count).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("SelfTest left %d rows behind", count)
+	}
+}
+
+// TestSelfTest_ReportsFailingStep verifies the error names the failing step.
+func TestSelfTest_ReportsFailingStep(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+
+	broken := errors.New("disk on fire")
+	err := db.Callback().Delete().Before("gorm:delete").Register("test:fail_delete", func(tx *gorm.DB) {
+		_ = tx.AddError(broken)
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	err = store.SelfTest(context.Background())
+	if !errors.Is(err, broken) || !strings.Contains(err.Error(), "self-test delete") {
+		t.Errorf("expected wrapped delete failure, got %v", err)
+	}
+}
+
+// TestSelfTest_MissingTable verifies SelfTest fails before migration.
+func TestSelfTest_MissingTable(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	if err := db.Migrator().DropTable(&identityRecord{}); err != nil {
+		t.Fatalf("drop table: %v", err)
+	}
+
+	err := store.SelfTest(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "self-test save") {
+		t.Errorf("expected save failure, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package gormauthstore
+
+import (
+	"context"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+	"gorm.io/gorm"
+)
+
+// FindIdentityIncludingDeleted reads an identity whether or not WithSoftDelete
+// has deleted it, for compliance queries over the retention period. The
+// returned IdentityMetadata carries DeletedAt, zero for a live identity.
+// Returns ssp.ErrNotFound only if no row with the key exists at all.
+func (as *AuthStore) FindIdentityIncludingDeleted(ctx context.Context, idk string) (_ *ssp.SqrlIdentity, _ IdentityMetadata, err error) {
+	ctx, done := as.observe(ctx, "FindIdentityIncludingDeleted", idk, &err)
+	defer done()
+	return as.loadIdentity(ctx, idk, as.allIdentities)
+}
+
+// PurgeDeleted permanently removes the identities WithSoftDelete deleted
+// more than olderThan ago and returns how many were removed. A negative
+// olderThan is treated as zero, purging every soft-deleted identity. It runs
+// as a single statement, under the write timeout.
+func (as *AuthStore) PurgeDeleted(olderThan time.Duration) (int64, error) {
+	return as.PurgeDeletedWithContext(as.baseContext(), olderThan)
+}
+
+// PurgeDeletedWithContext is PurgeDeleted with context support for timeout
+// and cancellation control.
+func (as *AuthStore) PurgeDeletedWithContext(ctx context.Context, olderThan time.Duration) (_ int64, err error) {
+	ctx, done := as.observe(ctx, "PurgeDeleted", "", &err)
+	defer done()
+	return as.purgeDeleted(ctx, olderThan, false)
+}
+
+// PurgeDeletedDryRun returns how many identities PurgeDeleted would remove
+// for olderThan, without modifying anything. It counts the same rows,
+// under the read timeout.
+func (as *AuthStore) PurgeDeletedDryRun(ctx context.Context, olderThan time.Duration) (_ int64, err error) {
+	ctx, done := as.observe(ctx, "PurgeDeletedDryRun", "", &err)
+	defer done()
+	return as.purgeDeleted(ctx, olderThan, true)
+}
+
+// purgeDeleted implements PurgeDeleted and, under dryRun, its dry run.
+func (as *AuthStore) purgeDeleted(ctx context.Context, olderThan time.Duration, dryRun bool) (int64, error) {
+	cutoff := as.now().Add(-max(olderThan, 0))
+	return as.bulkDelete(ctx, dryRun, func(db *gorm.DB) (*gorm.DB, error) {
+		return as.allIdentities(db).Where("deleted_at IS NOT NULL AND deleted_at <= ?", cutoff), nil
+	}, func(db *gorm.DB) *gorm.DB {
+		return db.Delete(&identityRecord{})
+	})
+}
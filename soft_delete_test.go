@@ -0,0 +1,170 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// TestWithSoftDelete_HidesDeleted verifies a soft-deleted identity stays in
+// the table but is absent to every ordinary read, and that
+// FindIdentityIncludingDeleted still returns it with its deletion time.
+func TestWithSoftDelete_HidesDeleted(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithSoftDelete())
+	ctx := context.Background()
+	identity := newTestIdentity().withIdk("soft-1").build()
+	seedIdentity(t, store, identity)
+	seedIdentity(t, store, newTestIdentity().withIdk("soft-2").build())
+	deletedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := atClock(store, deletedAt).DeleteIdentity("soft-1"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+	if n := countRows(t, db); n != 2 {
+		t.Errorf("rows after soft delete: got %d, want 2", n)
+	}
+	if _, err := store.FindIdentity("soft-1"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("FindIdentity: expected ssp.ErrNotFound, got %v", err)
+	}
+	if exists, err := store.ExistsIdentity("soft-1"); err != nil || exists {
+		t.Errorf("ExistsIdentity: got %v, %v, want false", exists, err)
+	}
+	if n, err := store.CountIdentities(); err != nil || n != 1 {
+		t.Errorf("CountIdentities: got %d, %v, want 1", n, err)
+	}
+	if listed, err := store.ListIdentities(0, 10); err != nil || len(listed) != 1 || listed[0].Idk != "soft-2" {
+		t.Errorf("ListIdentities: got %v, %v, want [soft-2]", idks(listed), err)
+	}
+
+	found, meta, err := store.FindIdentityIncludingDeleted(ctx, "soft-1")
+	if err != nil {
+		t.Fatalf("FindIdentityIncludingDeleted failed: %v", err)
+	}
+	if *found != *identity {
+		t.Errorf("identity: got %+v, want %+v", *found, *identity)
+	}
+	if !meta.DeletedAt.Equal(deletedAt) || meta.DeletedAt.Location() != time.UTC {
+		t.Errorf("DeletedAt: got %v, want %v", meta.DeletedAt, deletedAt)
+	}
+	if _, meta, err := store.FindIdentityIncludingDeleted(ctx, "soft-2"); err != nil || !meta.DeletedAt.IsZero() {
+		t.Errorf("live identity: got %+v, %v, want zero DeletedAt", meta, err)
+	}
+	if _, _, err := store.FindIdentityIncludingDeleted(ctx, "soft-missing"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("missing: expected ssp.ErrNotFound, got %v", err)
+	}
+}
+
+// TestWithSoftDelete_BulkDeletes verifies DeleteIdentities and DeleteWhere
+// soft-delete, count only rows they newly delete, and still honour
+// WithProtectHardlocked.
+func TestWithSoftDelete_BulkDeletes(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithSoftDelete(), WithProtectHardlocked())
+	seedIdentity(t, store, newTestIdentity().withIdk("soft-a").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("soft-b").withDisabled().build())
+	seedIdentity(t, store, newTestIdentity().withIdk("soft-c").withDisabled().build())
+	seedIdentity(t, store, newTestIdentity().withIdk("soft-locked").withHardlock().build())
+
+	if err := store.DeleteIdentities([]string{"soft-a", "soft-b"}); err != nil {
+		t.Fatalf("DeleteIdentities failed: %v", err)
+	}
+	disabled := true
+	deleted, err := store.DeleteWhere(context.Background(), IdentityFilter{Disabled: &disabled})
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteWhere: got %d, %v, want 1 (soft-b already deleted)", deleted, err)
+	}
+	if err := store.DeleteIdentity("soft-locked"); !errors.Is(err, ErrIdentityHardlocked) {
+		t.Errorf("hardlocked: expected ErrIdentityHardlocked, got %v", err)
+	}
+	if n, err := store.CountIdentities(); err != nil || n != 1 {
+		t.Errorf("CountIdentities: got %d, %v, want 1", n, err)
+	}
+	if n := countRows(t, db); n != 4 {
+		t.Errorf("rows: got %d, want 4", n)
+	}
+}
+
+// TestWithSoftDelete_SaveUndeletes verifies saving a soft-deleted key
+// brings the identity back, and renaming onto one is refused.
+func TestWithSoftDelete_SaveUndeletes(t *testing.T) {
+	_, store := newTestStoreWithOptions(t, WithSoftDelete())
+	seedIdentity(t, store, newTestIdentity().withIdk("soft-back").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("soft-other").build())
+	if err := store.DeleteIdentity("soft-back"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+
+	err := store.RenameIdentity(context.Background(), "soft-other", "soft-back")
+	if !errors.Is(err, ErrDuplicateIdentity) {
+		t.Errorf("RenameIdentity onto deleted key: expected ErrDuplicateIdentity, got %v", err)
+	}
+
+	seedIdentity(t, store, newTestIdentity().withIdk("soft-back").withBtn(4).build())
+	found, meta, err := store.FindIdentityIncludingDeleted(context.Background(), "soft-back")
+	if err != nil || found.Btn != 4 || !meta.DeletedAt.IsZero() {
+		t.Errorf("after re-save: got %+v, %+v, %v, want live with Btn 4", found, meta, err)
+	}
+}
+
+// TestPurgeDeleted verifies only identities deleted before the cutoff are
+// removed, and live ones never are, and that the dry run counts them
+// without removing them.
+func TestPurgeDeleted(t *testing.T) {
+	db, store := newTestStoreWithOptions(t, WithSoftDelete())
+	retention := 90 * 24 * time.Hour
+	deletedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	seedIdentity(t, store, newTestIdentity().withIdk("purge-old").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("purge-new").build())
+	seedIdentity(t, store, newTestIdentity().withIdk("purge-live").build())
+	if err := atClock(store, deletedAt).DeleteIdentity("purge-old"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+	if err := atClock(store, deletedAt.Add(60*24*time.Hour)).DeleteIdentity("purge-new"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+
+	purged, err := atClock(store, deletedAt.Add(retention-time.Hour)).PurgeDeleted(retention)
+	if err != nil || purged != 0 {
+		t.Errorf("within retention: got %d, %v, want 0", purged, err)
+	}
+	later := atClock(store, deletedAt.Add(retention+time.Hour))
+	if wouldPurge, err := later.PurgeDeletedDryRun(context.Background(), retention); err != nil || wouldPurge != 1 {
+		t.Errorf("PurgeDeletedDryRun: got %d, %v, want 1", wouldPurge, err)
+	}
+	if n := countRows(t, db); n != 3 {
+		t.Errorf("rows after dry run: got %d, want 3", n)
+	}
+	purged, err = later.PurgeDeleted(retention)
+	if err != nil || purged != 1 {
+		t.Errorf("after retention: got %d, %v, want 1", purged, err)
+	}
+	if _, _, err := store.FindIdentityIncludingDeleted(context.Background(), "purge-old"); !errors.Is(err, ssp.ErrNotFound) {
+		t.Errorf("purged identity: expected ssp.ErrNotFound, got %v", err)
+	}
+
+	purged, err = store.PurgeDeletedWithContext(context.Background(), -time.Hour)
+	if err != nil || purged != 1 {
+		t.Errorf("negative olderThan: got %d, %v, want 1", purged, err)
+	}
+	if n := countRows(t, db); n != 1 {
+		t.Errorf("rows: got %d, want only purge-live", n)
+	}
+}
+
+// TestWithoutSoftDelete_HardDeletes verifies deletes still remove rows when
+// the option is off.
+func TestWithoutSoftDelete_HardDeletes(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	seedIdentity(t, store, newTestIdentity().withIdk("hard-1").build())
+	if err := store.DeleteIdentity("hard-1"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("rows: got %d, want 0", n)
+	}
+	if purged, err := store.PurgeDeleted(0); err != nil || purged != 0 {
+		t.Errorf("PurgeDeleted: got %d, %v, want 0", purged, err)
+	}
+}
@@ -0,0 +1,163 @@
+package gormauthstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DialectorFunc builds a GORM dialector over an existing *sql.DB, typically
+// by passing it as the Conn of the driver's Config, e.g.
+//
+//	func(db *sql.DB) gorm.Dialector { return postgres.New(postgres.Config{Conn: db}) }
+type DialectorFunc func(sqlDB *sql.DB) gorm.Dialector
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]DialectorFunc{}
+)
+
+// RegisterDialect makes a dialect available to NewAuthStoreFromSQL under
+// name. The package registers none itself, so importing it never pulls in a
+// database driver; applications register the ones they link. Registering a
+// name again replaces the previous constructor.
+func RegisterDialect(name string, fn DialectorFunc) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[name] = fn
+}
+
+// registeredDialects returns the registered dialect names, sorted.
+func registeredDialects() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewAuthStoreFromSQL creates an AuthStore on an existing *sql.DB, so an
+// application can share one connection pool, with its own pool settings,
+// between its own queries and the identity store. dialect names a dialect
+// registered with RegisterDialect; an unknown name returns an error wrapping
+// ErrUnsupportedDialect that lists the registered ones.
+//
+// The store does not own sqlDB: closing it remains the caller's job, and
+// the store's Close leaves it open.
+func NewAuthStoreFromSQL(sqlDB *sql.DB, dialect string, opts ...Option) (*AuthStore, error) {
+	if sqlDB == nil {
+		return nil, ErrNilDatabase
+	}
+	dialectsMu.RLock()
+	fn, ok := dialects[dialect]
+	dialectsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (registered: %v)", ErrUnsupportedDialect, dialect, registeredDialects())
+	}
+	db, err := gorm.Open(fn(sqlDB), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	as := NewAuthStore(db, opts...)
+	as.borrowedPool = true
+	return as, nil
+}
+
+// Pool limits NewAuthStoreWithDialector applies to the connections it opens.
+const (
+	DefaultMaxOpenConns    = 25
+	DefaultMaxIdleConns    = 10
+	DefaultConnMaxLifetime = 5 * time.Minute
+)
+
+// NewAuthStoreWithDialector opens a GORM connection with dialector and
+// creates an AuthStore on it, so an application picks its driver, such as
+// pgx for CockroachDB, without wiring GORM itself, and tests can pass a
+// dialector that simulates failures. The pool gets DefaultMaxOpenConns,
+// DefaultMaxIdleConns and DefaultConnMaxLifetime; change them with
+// ConfigurePool. A dialector whose connection pool is not a *sql.DB keeps
+// its own.
+//
+// The store owns the connection: Close closes it. A nil dialector returns
+// ErrNilDatabase, and a failure to open the connection is returned as is.
+func NewAuthStoreWithDialector(dialector gorm.Dialector, opts ...Option) (*AuthStore, error) {
+	if dialector == nil {
+		return nil, ErrNilDatabase
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	as := NewAuthStore(db, opts...)
+	err = as.ConfigurePool(DefaultMaxOpenConns, DefaultMaxIdleConns, DefaultConnMaxLifetime)
+	if err != nil && !errors.Is(err, gorm.ErrInvalidDB) {
+		return nil, err
+	}
+	return as, nil
+}
+
+// Ping checks that the store's database is reachable, for readiness probes.
+// It pings the underlying *sql.DB, which reuses an idle pooled connection
+// when there is one, so it is cheap enough to call every few seconds. It
+// is bounded by ctx and by the read timeout, so a hung database fails the
+// probe instead of wedging it. Failures wrap ErrDatabaseUnavailable.
+func (as *AuthStore) Ping(ctx context.Context) (err error) {
+	ctx, done := as.observe(ctx, "Ping", "", &err)
+	defer done()
+	if err := as.usable(); err != nil {
+		return err
+	}
+	sqlDB, err := as.db.DB()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnavailable, err)
+	}
+	ctx, cancel := as.operationContext(ctx, opRead)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnavailable, err)
+	}
+	return nil
+}
+
+// Stats returns the statistics of the store's connection pool, such as open,
+// in-use and idle connections, for capacity planning. It is the zero value
+// for a store without a usable database.
+func (as *AuthStore) Stats() sql.DBStats {
+	if as.db == nil {
+		return sql.DBStats{}
+	}
+	sqlDB, err := as.db.DB()
+	if err != nil {
+		return sql.DBStats{}
+	}
+	return sqlDB.Stats()
+}
+
+// ConfigurePool sets the limits of the store's connection pool: at most
+// maxOpen open and maxIdle idle connections, each reused for at most
+// maxLifetime. Values follow database/sql: maxOpen <= 0 means unlimited,
+// maxIdle <= 0 keeps no idle connections and maxLifetime <= 0 reuses
+// connections forever. The pool is shared with the *gorm.DB, or the
+// NewAuthStoreFromSQL *sql.DB, the store was created from.
+func (as *AuthStore) ConfigurePool(maxOpen, maxIdle int, maxLifetime time.Duration) error {
+	if err := as.usable(); err != nil {
+		return err
+	}
+	sqlDB, err := as.db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(maxOpen)
+	sqlDB.SetMaxIdleConns(maxIdle)
+	sqlDB.SetConnMaxLifetime(maxLifetime)
+	return nil
+}
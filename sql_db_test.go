@@ -0,0 +1,217 @@
+package gormauthstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// registerSQLiteDialect registers the sqlite dialect for the duration of a test.
+func registerSQLiteDialect(t *testing.T) {
+	t.Helper()
+	RegisterDialect("sqlite", func(sqlDB *sql.DB) gorm.Dialector {
+		return sqlite.New(sqlite.Config{Conn: sqlDB})
+	})
+	t.Cleanup(func() {
+		dialectsMu.Lock()
+		defer dialectsMu.Unlock()
+		delete(dialects, "sqlite")
+	})
+}
+
+// TestNewAuthStoreFromSQL verifies the store runs on the caller's pool and
+// accepts options.
+func TestNewAuthStoreFromSQL(t *testing.T) {
+	registerSQLiteDialect(t)
+
+	sqlDB, err := sql.Open(sqlite.DriverName, "file:fromsql?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+
+	store, err := NewAuthStoreFromSQL(sqlDB, "sqlite", WithReadTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("NewAuthStoreFromSQL failed: %v", err)
+	}
+	if store.cfg.readTimeout != time.Second {
+		t.Error("options were not applied")
+	}
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+	seedIdentity(t, store, newTestIdentity().withIdk("fromsql-idk").build())
+
+	var count int
+	if err := sqlDB.QueryRow("SELECT COUNT(*) FROM sqrl_identities WHERE idk = ?", "fromsql-idk").Scan(&count); err != nil {
+		t.Fatalf("query through caller pool: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("identity not visible through the shared pool: count %d", count)
+	}
+	if got, _ := store.db.DB(); got != sqlDB {
+		t.Error("store does not use the caller's *sql.DB")
+	}
+}
+
+// TestNewAuthStoreFromSQL_Errors verifies nil databases and unknown dialects
+// are rejected.
+func TestNewAuthStoreFromSQL_Errors(t *testing.T) {
+	registerSQLiteDialect(t)
+
+	if _, err := NewAuthStoreFromSQL(nil, "sqlite"); !errors.Is(err, ErrNilDatabase) {
+		t.Errorf("nil db: expected ErrNilDatabase, got %v", err)
+	}
+
+	sqlDB, err := sql.Open(sqlite.DriverName, ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer sqlDB.Close()
+
+	_, err = NewAuthStoreFromSQL(sqlDB, "oracle")
+	if !errors.Is(err, ErrUnsupportedDialect) {
+		t.Fatalf("unknown dialect: expected ErrUnsupportedDialect, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"oracle"`) || !strings.Contains(err.Error(), "sqlite") {
+		t.Errorf("error should name the dialect and list registered ones: %v", err)
+	}
+}
+
+// TestPing verifies Ping succeeds on a live database and fails with
+// ErrDatabaseUnavailable, keeping the cause, once it is closed or the
+// context is done.
+func TestPing(t *testing.T) {
+	db, store := newTestStoreWithOptions(t)
+	ctx := context.Background()
+	if err := store.Ping(ctx); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err := store.Ping(cancelled)
+	if !errors.Is(err, ErrDatabaseUnavailable) || !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled context: expected ErrDatabaseUnavailable wrapping context.Canceled, got %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	sqlDB.Close()
+	if err := store.Ping(ctx); !errors.Is(err, ErrDatabaseUnavailable) {
+		t.Errorf("closed database: expected ErrDatabaseUnavailable, got %v", err)
+	}
+
+	if err := NewAuthStore(nil).Ping(ctx); !errors.Is(err, ErrNilDatabase) {
+		t.Errorf("nil database: expected ErrNilDatabase, got %v", err)
+	}
+}
+
+// TestConfigurePoolAndStats verifies the pool limits are applied and
+// reported through Stats.
+func TestConfigurePoolAndStats(t *testing.T) {
+	_, store := newTestStoreWithOptions(t)
+	if err := store.ConfigurePool(3, 2, time.Minute); err != nil {
+		t.Fatalf("ConfigurePool failed: %v", err)
+	}
+	seedIdentity(t, store, newTestIdentity().withIdk("pool-1").build())
+
+	stats := store.Stats()
+	if stats.MaxOpenConnections != 3 {
+		t.Errorf("MaxOpenConnections: got %d, want 3", stats.MaxOpenConnections)
+	}
+	if stats.OpenConnections < 1 || stats.Idle > 2 {
+		t.Errorf("stats: got %+v, want an open connection and at most 2 idle", stats)
+	}
+
+	nilStore := NewAuthStore(nil)
+	if stats := nilStore.Stats(); stats != (sql.DBStats{}) {
+		t.Errorf("nil db Stats: got %+v, want zero", stats)
+	}
+	if err := nilStore.ConfigurePool(1, 1, 0); !errors.Is(err, ErrNilDatabase) {
+		t.Errorf("nil db ConfigurePool: expected ErrNilDatabase, got %v", err)
+	}
+}
+
+// failingDialector is the sqlite dialector with every statement failing as
+// if the connection had dropped.
+type failingDialector struct {
+	gorm.Dialector
+}
+
+func (d failingDialector) Initialize(db *gorm.DB) error {
+	if err := d.Dialector.Initialize(db); err != nil {
+		return err
+	}
+	db.ConnPool = failingPool{}
+	return nil
+}
+
+// failingPool is a gorm.ConnPool whose every call fails with
+// driver.ErrBadConn.
+type failingPool struct{}
+
+func (failingPool) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, driver.ErrBadConn
+}
+
+func (failingPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, driver.ErrBadConn
+}
+
+func (failingPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, driver.ErrBadConn
+}
+
+func (failingPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+// TestNewAuthStoreWithDialector verifies the store opens and owns its
+// connection with the default pool limits, and that a dialector can
+// simulate a failing database.
+func TestNewAuthStoreWithDialector(t *testing.T) {
+	store, err := NewAuthStoreWithDialector(sqlite.Open(filepath.Join(t.TempDir(), "dialector.db")))
+	if err != nil {
+		t.Fatalf("NewAuthStoreWithDialector failed: %v", err)
+	}
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+	seedIdentity(t, store, newTestIdentity().withIdk("dial-1").build())
+	if _, err := store.FindIdentity("dial-1"); err != nil {
+		t.Errorf("FindIdentity failed: %v", err)
+	}
+	if stats := store.Stats(); stats.MaxOpenConnections != DefaultMaxOpenConns {
+		t.Errorf("MaxOpenConnections: got %d, want %d", stats.MaxOpenConnections, DefaultMaxOpenConns)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := store.db.Exec("SELECT 1").Error; err == nil {
+		t.Error("Close left the connection open")
+	}
+
+	failing, err := NewAuthStoreWithDialector(failingDialector{sqlite.Open(":memory:")})
+	if err != nil {
+		t.Fatalf("NewAuthStoreWithDialector(failing) failed: %v", err)
+	}
+	if _, err := failing.FindIdentity("dial-1"); !errors.Is(err, ErrTransient) {
+		t.Errorf("failing dialector: expected ErrTransient, got %v", err)
+	}
+
+	if _, err := NewAuthStoreWithDialector(nil); !errors.Is(err, ErrNilDatabase) {
+		t.Errorf("nil dialector: expected ErrNilDatabase, got %v", err)
+	}
+}
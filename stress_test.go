@@ -0,0 +1,128 @@
+package gormauthstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ssp "github.com/dxcSithLord/server-go-ssp"
+)
+
+// stressDurationEnv overrides how long TestStress_AllOperations runs. The
+// default keeps the regular test run fast; `make test-stress` raises it.
+const stressDurationEnv = "GORMAUTHSTORE_STRESS_DURATION"
+
+// stressDuration returns the configured stress duration, defaulting to d.
+func stressDuration(t *testing.T, d time.Duration) time.Duration {
+	t.Helper()
+	v := os.Getenv(stressDurationEnv)
+	if v == "" {
+		return d
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil {
+		t.Fatalf("invalid %s %q: %v", stressDurationEnv, v, err)
+	}
+	return parsed
+}
+
+// TestStress_AllOperations hammers every store operation from many goroutines
+// over a small shared key space for a bounded duration. It is meant to be run
+// under -race: any shared mutable state added to AuthStore must survive it.
+func TestStress_AllOperations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+
+	_, store := newTestStoreWithOptions(t,
+		WithReadTimeout(5*time.Second),
+		WithWriteTimeout(5*time.Second),
+	)
+
+	const (
+		workers = 16
+		keys    = 8
+	)
+	key := func(i int) string { return fmt.Sprintf("stress-%d", i) }
+
+	// Operations that touch a key another goroutine has just deleted or
+	// renamed fail in well-defined ways; anything else is a real failure.
+	expected := func(err error) bool {
+		return err == nil ||
+			errors.Is(err, ssp.ErrNotFound) ||
+			errors.Is(err, ErrIdentityDisabled) ||
+			errors.Is(err, ErrDuplicateIdentity)
+	}
+
+	ops := []func(ctx context.Context, r *rand.Rand) error{
+		func(ctx context.Context, r *rand.Rand) error {
+			id := newTestIdentity().withIdk(key(r.IntN(keys))).withBtn(r.IntN(4)).build()
+			if r.IntN(4) == 0 {
+				id.Disabled = true
+			}
+			return store.SaveIdentityWithContext(ctx, id)
+		},
+		func(ctx context.Context, r *rand.Rand) error {
+			_, err := store.FindIdentityWithContext(ctx, key(r.IntN(keys)))
+			return err
+		},
+		func(ctx context.Context, r *rand.Rand) error {
+			id, err := store.FindIdentitySecureWithContext(ctx, key(r.IntN(keys)))
+			if err == nil {
+				id.Destroy()
+			}
+			return err
+		},
+		func(ctx context.Context, r *rand.Rand) error {
+			_, err := store.FindActiveIdentity(ctx, key(r.IntN(keys)))
+			return err
+		},
+		func(ctx context.Context, r *rand.Rand) error {
+			return store.DeleteIdentityWithContext(ctx, key(r.IntN(keys)))
+		},
+		func(ctx context.Context, r *rand.Rand) error {
+			return store.RenameIdentity(ctx, key(r.IntN(keys)), key(r.IntN(keys)))
+		},
+		func(ctx context.Context, r *rand.Rand) error {
+			_, err := store.ClaimAndDisable(ctx, key(r.IntN(keys)))
+			return err
+		},
+	}
+
+	deadline := time.Now().Add(stressDuration(t, 500*time.Millisecond))
+	var (
+		wg    sync.WaitGroup
+		total atomic.Int64
+	)
+	errs := make(chan error, workers)
+
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(seed uint64) {
+			defer wg.Done()
+			r := rand.New(rand.NewPCG(seed, seed))
+			ctx := ContextWithCorrelationID(context.Background(), fmt.Sprintf("worker-%d", seed))
+			for time.Now().Before(deadline) {
+				if err := ops[r.IntN(len(ops))](ctx, r); !expected(err) {
+					errs <- err
+					return
+				}
+				total.Add(1)
+			}
+		}(uint64(w))
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error under load: %v", err)
+	}
+	t.Logf("%d operations across %d workers", total.Load(), workers)
+}
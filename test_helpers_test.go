@@ -1,6 +1,9 @@
 package gormauthstore
 
 import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
 	"testing"
 
 	ssp "github.com/dxcSithLord/server-go-ssp"
@@ -116,6 +119,34 @@ func newTestStoreWithDB(t *testing.T) (*gorm.DB, *AuthStore) {
 	return db, store
 }
 
+// testDBSeq numbers the private in-memory databases created by
+// newTestStoreWithOptions.
+var testDBSeq atomic.Int64
+
+// newTestStoreWithOptions creates an AuthStore configured with opts on a
+// private in-memory SQLite database, so tests that count or list rows are not
+// affected by identities seeded by other tests. It returns both the
+// underlying *gorm.DB and the *AuthStore.
+func newTestStoreWithOptions(t *testing.T, opts ...Option) (*gorm.DB, *AuthStore) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:testdb-%d?mode=memory&cache=shared", testDBSeq.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get underlying sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	store := NewAuthStore(db, opts...)
+	if err := store.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+	return db, store
+}
+
 // seedIdentity saves a test identity and fails the test on error.
 func seedIdentity(t *testing.T, store *AuthStore, identity *ssp.SqrlIdentity) {
 	t.Helper()
@@ -123,3 +154,23 @@ func seedIdentity(t *testing.T, store *AuthStore, identity *ssp.SqrlIdentity) {
 		t.Fatalf("failed to seed identity %q: %v", identity.Idk, err)
 	}
 }
+
+// idks returns the identity keys of identities, for compact assertions.
+func idks(identities []*ssp.SqrlIdentity) []string {
+	keys := make([]string, len(identities))
+	for i, id := range identities {
+		keys[i] = id.Idk
+	}
+	return keys
+}
+
+// fmtKeys formats keys as "[a b c]" for comparison with expected strings.
+func fmtKeys(keys []string) string {
+	return fmt.Sprint(keys)
+}
+
+// testKey returns a deterministic size-byte key filled with b, for the
+// encryption, integrity and idk pepper options.
+func testKey(size int, b byte) []byte {
+	return bytes.Repeat([]byte{b}, size)
+}